@@ -0,0 +1,204 @@
+package huffman
+
+// AdaptiveHuffmanTree 是自适应Huffman编码（FGK算法）使用的Huffman树
+// 编码器和解码器从相同的初始状态开始，每处理一个字节后按照相同的方式更新树，因此不需要传输码表
+//
+// 树中的节点按照编号排列，编号大的节点权重不小于编号小的节点，并且兄弟节点的编号相邻（sibling property）。
+// 还没有出现过的字节共享一个权重为0的NYT（not yet transmitted）节点，
+// 字节第一次出现时先输出NYT节点的编码，再输出8比特的原始字节
+type AdaptiveHuffmanTree struct {
+	Root   *HuffmanNode
+	nyt    *HuffmanNode
+	leaves [MaxSymbolNum]*HuffmanNode
+	// 按照编号从大到小排列的所有节点，nodes[i].order == i
+	nodes []*HuffmanNode
+	// 编码时记录从叶子节点到根节点的路径
+	path []byte
+}
+
+// NewAdaptiveHuffmanTree 创建一棵只有NYT节点的自适应Huffman树
+func NewAdaptiveHuffmanTree() *AdaptiveHuffmanTree {
+	root := &HuffmanNode{}
+	return &AdaptiveHuffmanTree{
+		Root:  root,
+		nyt:   root,
+		nodes: []*HuffmanNode{root},
+	}
+}
+
+// Encode 将字节b编码后写入w，然后更新树
+func (t *AdaptiveHuffmanTree) Encode(w *BitsWriter, b byte) {
+	if leaf := t.leaves[b]; leaf != nil {
+		t.writePath(w, leaf)
+	} else {
+		t.writePath(w, t.nyt)
+		w.writeBits(uint64(b), 8)
+	}
+	t.Update(b)
+}
+
+// writePath 写入从根节点到nd的路径，左0右1
+func (t *AdaptiveHuffmanTree) writePath(w *BitsWriter, nd *HuffmanNode) {
+	t.path = t.path[:0]
+	for cur := nd; cur.Parent != nil; cur = cur.Parent {
+		if cur.IsRight() {
+			t.path = append(t.path, 1)
+		} else {
+			t.path = append(t.path, 0)
+		}
+	}
+
+	// 路径可能超过64比特，每64比特写入一次
+	var v uint64 = 0
+	var n uint = 0
+	for i := len(t.path) - 1; i >= 0; i-- {
+		v = v<<1 | uint64(t.path[i])
+		n++
+		if n == MaxUint64Len {
+			w.writeBits(v, n)
+			v, n = 0, 0
+		}
+	}
+	if n > 0 {
+		w.writeBits(v, n)
+	}
+}
+
+// Decode 从buf的第pos个比特开始解码一个字节，end为有效比特数，然后更新树
+// 返回解码得到的字节和消耗的比特数
+func (t *AdaptiveHuffmanTree) Decode(buf []byte, pos, end uint64) (byte, uint64, error) {
+	p := pos
+	cur := t.Root
+	for !cur.IsLeaf() {
+		if p >= end {
+			return 0, 0, ErrBitsExhausted
+		}
+		if buf[p/8]>>(7-p%8)&1 == 0 {
+			cur = cur.Left
+		} else {
+			cur = cur.Right
+		}
+		p++
+	}
+
+	b := cur.Byte
+	if cur == t.nyt {
+		if end-p < 8 {
+			return 0, 0, ErrBitsExhausted
+		}
+		b = byte(peekBits(buf, p, 8))
+		p += 8
+	}
+	t.Update(b)
+
+	return b, p - pos, nil
+}
+
+// Update 将字节b的权重加1，并调整树使其保持sibling property
+func (t *AdaptiveHuffmanTree) Update(b byte) {
+	q := t.leaves[b]
+	if q == nil {
+		q = t.split(b)
+	}
+
+	// q和NYT节点是兄弟时，父节点和q的权重相同，只能和同权重的叶子节点交换
+	if q.Parent != nil && (q.Parent.Left == t.nyt || q.Parent.Right == t.nyt) {
+		t.swap(q, t.leader(q, true))
+		q.Weight++
+		q = q.Parent
+	}
+	for q != t.Root {
+		// 交换后q成为同权重的节点中编号最大的节点，权重加1后仍然满足sibling property
+		t.swap(q, t.leader(q, false))
+		q.Weight++
+		q = q.Parent
+	}
+	q.Weight++
+}
+
+// split 将NYT节点分裂成新的NYT节点和字节b的叶子节点，返回新的叶子节点
+func (t *AdaptiveHuffmanTree) split(b byte) *HuffmanNode {
+	parent := t.nyt
+	leaf := &HuffmanNode{Parent: parent, Byte: b, order: len(t.nodes)}
+	nyt := &HuffmanNode{Parent: parent, order: len(t.nodes) + 1}
+	parent.Left = nyt
+	parent.Right = leaf
+
+	t.nodes = append(t.nodes, leaf, nyt)
+	t.leaves[b] = leaf
+	t.nyt = nyt
+
+	return leaf
+}
+
+// leader 返回和nd权重相同的节点中编号最大的节点，leafOnly为true时只考虑叶子节点
+func (t *AdaptiveHuffmanTree) leader(nd *HuffmanNode, leafOnly bool) *HuffmanNode {
+	ret := nd
+	for i := nd.order - 1; i >= 0 && t.nodes[i].Weight == nd.Weight; i-- {
+		if !leafOnly || t.nodes[i].IsLeaf() {
+			ret = t.nodes[i]
+		}
+	}
+	return ret
+}
+
+// swap 交换两个节点在树中的位置和编号，两个节点都不能是对方的祖先
+func (t *AdaptiveHuffmanTree) swap(a, b *HuffmanNode) {
+	if a == b {
+		return
+	}
+
+	pa, pb := a.Parent, b.Parent
+	if pa == pb {
+		pa.Left, pa.Right = pa.Right, pa.Left
+	} else {
+		if pa.Left == a {
+			pa.Left = b
+		} else {
+			pa.Right = b
+		}
+		if pb.Left == b {
+			pb.Left = a
+		} else {
+			pb.Right = a
+		}
+		a.Parent, b.Parent = pb, pa
+	}
+
+	t.nodes[a.order], t.nodes[b.order] = b, a
+	a.order, b.order = b.order, a.order
+}
+
+// CompressBytesAdaptive 使用自适应Huffman编码压缩一个字节切片，不需要码表
+// 返回压缩后的字节切片，压缩后的有效比特数
+func CompressBytesAdaptive(data []byte) ([]byte, uint64, error) {
+	w := NewBitsWriter()
+	tree := NewAdaptiveHuffmanTree()
+	for _, b := range data {
+		tree.Encode(w, b)
+	}
+
+	return w.Buf(), w.BitLen(), nil
+}
+
+// DecompressBytesAdaptive 解压缩使用自适应Huffman编码压缩的字节切片
+// 输入参数包括压缩了的字节切片本身和字节切片中有效比特数
+func DecompressBytesAdaptive(data []byte, bitLen uint64) ([]byte, error) {
+	if (bitLen+7)/8 > uint64(len(data)) {
+		return nil, ErrBitsExhausted
+	}
+
+	ret := make([]byte, 0, len(data))
+	tree := NewAdaptiveHuffmanTree()
+	var pos uint64 = 0
+	for pos < bitLen {
+		b, n, err := tree.Decode(data, pos, bitLen)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, b)
+		pos += n
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,155 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// checkSiblingProperty 检查自适应Huffman树的权重和节点编号是否满足sibling property
+func checkSiblingProperty(t *testing.T, tree *AdaptiveHuffmanTree) {
+	for i, nd := range tree.nodes {
+		require.Equal(t, i, nd.order)
+		if i > 0 {
+			require.LessOrEqual(t, nd.Weight, tree.nodes[i-1].Weight)
+		}
+		if !nd.IsLeaf() {
+			require.Equal(t, nd.Left.Weight+nd.Right.Weight, nd.Weight)
+			require.Equal(t, nd, nd.Left.Parent)
+			require.Equal(t, nd, nd.Right.Parent)
+			// 兄弟节点编号相邻，右孩子的编号更大
+			require.Equal(t, nd.Right.order+1, nd.Left.order)
+		}
+	}
+	require.Equal(t, tree.Root, tree.nodes[0])
+	require.EqualValues(t, 0, tree.nyt.Weight)
+}
+
+func TestAdaptiveHuffmanTree_Update(t *testing.T) {
+	tree := NewAdaptiveHuffmanTree()
+	checkSiblingProperty(t, tree)
+
+	data := []byte("abracadabra, the quick brown fox jumps over the lazy dog")
+	for i, b := range data {
+		tree.Update(b)
+		checkSiblingProperty(t, tree)
+		require.EqualValues(t, i+1, tree.Root.Weight)
+	}
+	require.EqualValues(t, 5+1, tree.leaves['a'].Weight)
+
+	// 出现次数多的字节编码更短
+	require.Less(t, tree.leaves['a'].depth(), tree.leaves['z'].depth())
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		tree.Update(byte(rnd.ExpFloat64() * 20))
+	}
+	checkSiblingProperty(t, tree)
+}
+
+func TestCompressBytesAdaptive(t *testing.T) {
+	text, err := os.ReadFile(s1)
+	require.Nil(t, err)
+
+	allBytes := make([]byte, 0, 1024)
+	for i := 0; i < 1024; i++ {
+		allBytes = append(allBytes, byte(i*7))
+	}
+	cases := [][]byte{
+		nil,
+		{'x'},
+		bytes.Repeat([]byte{0}, 1000),
+		[]byte("abracadabra"),
+		allBytes,
+		mixedData(1 << 16),
+		text,
+	}
+	for _, data := range cases {
+		compressed, bitLen, err := CompressBytesAdaptive(data)
+		require.Nil(t, err)
+		require.EqualValues(t, (bitLen+7)/8, len(compressed))
+
+		recovered, err := DecompressBytesAdaptive(compressed, bitLen)
+		require.Nil(t, err)
+		require.True(t, bytes.Equal(data, recovered))
+	}
+
+	// 第一个字节是NYT节点的空编码加上8比特的原始字节，之后相同的字节只需要1比特
+	compressed, bitLen, err := CompressBytesAdaptive([]byte("aaaa"))
+	require.Nil(t, err)
+	require.EqualValues(t, 8+1+1+1, bitLen)
+	require.Equal(t, []byte{'a', 0xe0}, compressed)
+
+	// 比特位不足
+	_, err = DecompressBytesAdaptive(compressed, 20)
+	require.ErrorIs(t, err, ErrBitsExhausted)
+	_, err = DecompressBytesAdaptive(compressed[:1], bitLen)
+	require.ErrorIs(t, err, ErrBitsExhausted)
+}
+
+func TestWriter_Adaptive(t *testing.T) {
+	data := mixedData(1 << 18)
+	stream := compressStream(t, data, WithBlockSize(8192), WithAdaptive())
+
+	got, blocks := parseStream(t, stream)
+	require.Equal(t, data, got)
+	require.Equal(t, 32, blocks)
+	types, _ := blockTypes(t, stream)
+	for _, typ := range types {
+		require.Contains(t, []byte{BlockTypeAdaptive, BlockTypeStored}, typ)
+	}
+	require.Contains(t, types, BlockTypeAdaptive)
+
+	// 并行压缩的结果和串行压缩一致
+	require.Equal(t, stream, compressStream(t, data, WithBlockSize(8192), WithAdaptive(), WithConcurrency(4)))
+
+	r, err := NewReader(bytes.NewReader(stream))
+	require.Nil(t, err)
+	require.Nil(t, iotest.TestReader(r, data))
+
+	r, err = NewReader(bytes.NewReader(stream), WithReaderConcurrency(4))
+	require.Nil(t, err)
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, r)
+	require.Nil(t, err)
+	require.Equal(t, data, buf.Bytes())
+
+	// 随机数据压缩后变大，直接存储
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+	types, _ = blockTypes(t, compressStream(t, random, WithAdaptive()))
+	require.Equal(t, []byte{BlockTypeStored}, types)
+}
+
+func TestSeekableReader_Adaptive(t *testing.T) {
+	data := mixedData(1 << 17)
+	stream := compressStream(t, data, WithBlockSize(4096), WithAdaptive(), WithSeekIndex(DefaultCheckpointInterval))
+
+	sr, err := OpenSeekable(bytes.NewReader(stream))
+	require.Nil(t, err)
+	buf := make([]byte, 10000)
+	n, err := sr.ReadAt(buf, 50000)
+	require.Nil(t, err)
+	require.Equal(t, data[50000:60000], buf[:n])
+	require.Nil(t, iotest.TestReader(sr, data))
+}
+
+func TestCompressAndDecompress_Adaptive(t *testing.T) {
+	dir := t.TempDir()
+	binname := filepath.Join(dir, "test.bin")
+	recovername := filepath.Join(dir, "recover.txt")
+	require.Nil(t, CompressFile(s1, binname, WithAdaptive()))
+	require.Nil(t, DecompressFile(binname, recovername))
+
+	originalHash, err := Sha256SumFile(s1)
+	require.Nil(t, err)
+	afterHash, err := Sha256SumFile(recovername)
+	require.Nil(t, err)
+	require.Equal(t, originalHash, afterHash)
+}
@@ -0,0 +1,515 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 归档文件：把一个目录树中的所有普通文件打包到一个文件中，每个文件单独压缩成一个压缩流（格式见container.go），
+// 文件末尾的中央目录记录了每个文件的路径、大小、偏移和校验和，因此可以列出归档中的文件或者只解压其中一个文件。
+//
+// 归档文件格式如下：（大端序）
+// HEADER
+//   - START_FLAG						2 bytes (uint16)
+//   - VERSION							1 byte
+//
+// DATA
+//   - 每个文件的压缩流，按照中央目录中的顺序依次排列
+//
+// CENTRAL DIRECTORY
+//   - ENTRY NUM						4 bytes (uint32)
+//   - 每个文件：
+//   - NAME_LEN						2 bytes (uint16)
+//   - NAME							n bytes 以/分隔的相对路径
+//   - BYTE SIZE BEFORE COMPRESSION	8 bytes (uint64)
+//   - OFFSET						8 bytes (uint64) 压缩流相对于归档文件开头的偏移
+//   - BYTE SIZE AFTER COMPRESSION	8 bytes (uint64) 压缩流的字节数
+//   - CRC32 CHECKSUM				4 bytes (uint32) 原始数据的校验和
+//
+// TAIL
+//   - DIRECTORY OFFSET				8 bytes (uint64) 中央目录相对于归档文件开头的偏移
+//   - CRC32 CHECKSUM				4 bytes (uint32) 中央目录的校验和
+//   - END_FLAG						2 bytes (uint16)
+
+const (
+	ArchiveStartFlag uint16 = 0x5241 // "RA"
+	ArchiveEndFlag   uint16 = 0x4145 // "AE"
+	// ArchiveVersion1 是当前的归档文件格式版本
+	ArchiveVersion1 byte = 1
+
+	archiveHeaderSize = Uint16ByteSize + 1
+	archiveTailSize   = Uint64ByteSize + Uint32ByteSize + Uint16ByteSize
+	// archiveEntryFixedSize 是中央目录中每个文件除了路径以外的字节数
+	archiveEntryFixedSize = Uint16ByteSize + 3*Uint64ByteSize + Uint32ByteSize
+)
+
+var (
+	ErrInvalidArchive       = fmt.Errorf("invalid archive")
+	ErrInvalidArchiveEntry  = fmt.Errorf("invalid archive entry")
+	ErrArchiveEntryNotFound = fmt.Errorf("archive entry not found")
+	ErrArchiveWriterClosed  = fmt.Errorf("archive writer already closed")
+)
+
+// ArchiveEntry 是中央目录中记录的一个文件
+type ArchiveEntry struct {
+	Name           string // 以/分隔的相对路径
+	OriginalSize   uint64 // 压缩前的字节数
+	Offset         uint64 // 压缩流相对于归档文件开头的偏移
+	CompressedSize uint64 // 压缩流的字节数
+	Checksum       uint32 // 原始数据的CRC32校验和
+}
+
+// ArchiveWriter 把多个文件写入一个归档中，写入完成后调用Close写出中央目录
+type ArchiveWriter struct {
+	w           *countWriter
+	opts        []WriterOption
+	entries     []ArchiveEntry
+	names       map[string]struct{}
+	wroteHeader bool
+	closed      bool
+	err         error
+}
+
+// NewArchiveWriter 创建一个ArchiveWriter，归档数据写入w中
+// opts用于配置每个文件的压缩流；Close不会关闭w
+func NewArchiveWriter(w io.Writer, opts ...WriterOption) *ArchiveWriter {
+	return &ArchiveWriter{
+		w:     &countWriter{w: w},
+		opts:  opts,
+		names: make(map[string]struct{}),
+	}
+}
+
+// Add 读入r中的所有数据，作为路径为name的文件压缩写入归档
+// name必须是以/分隔的相对路径，不能包含..，也不能和已经写入的文件重复
+func (a *ArchiveWriter) Add(name string, r io.Reader) error {
+	if a.err != nil {
+		return a.err
+	}
+	if a.closed {
+		return ErrArchiveWriterClosed
+	}
+	if err := checkArchiveName(name); err != nil {
+		return err
+	}
+	if _, ok := a.names[name]; ok {
+		return fmt.Errorf("%w: duplicate name %q", ErrInvalidArchiveEntry, name)
+	}
+
+	a.err = a.add(name, r)
+	return a.err
+}
+
+func (a *ArchiveWriter) add(name string, r io.Reader) error {
+	if err := a.writeHeader(); err != nil {
+		return err
+	}
+
+	offset := a.w.n
+	zw := NewWriter(a.w, a.opts...)
+	hash := crc32.New(crc32q)
+	n, err := io.Copy(zw, io.TeeReader(r, hash))
+	if err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	a.names[name] = struct{}{}
+	a.entries = append(a.entries, ArchiveEntry{
+		Name:           name,
+		OriginalSize:   uint64(n),
+		Offset:         offset,
+		CompressedSize: a.w.n - offset,
+		Checksum:       hash.Sum32(),
+	})
+	return nil
+}
+
+// Close 写出中央目录和归档文件尾，不会关闭底层的io.Writer
+func (a *ArchiveWriter) Close() error {
+	if a.closed {
+		return a.err
+	}
+	a.closed = true
+	if a.err != nil {
+		return a.err
+	}
+	if a.err = a.writeHeader(); a.err != nil {
+		return a.err
+	}
+
+	directoryOffset := a.w.n
+	directory := appendArchiveDirectory(nil, a.entries)
+	tail := writeUint64ToBytes(directoryOffset, nil)
+	tail = writeUint32ToBytes(crc32.Checksum(directory, crc32q), tail)
+	tail = writeUint16ToBytes(ArchiveEndFlag, tail)
+	if _, a.err = a.w.Write(append(directory, tail...)); a.err != nil {
+		return a.err
+	}
+	return nil
+}
+
+// Entries 返回已经写入归档的文件
+func (a *ArchiveWriter) Entries() []ArchiveEntry {
+	return append([]ArchiveEntry(nil), a.entries...)
+}
+
+func (a *ArchiveWriter) writeHeader() error {
+	if a.wroteHeader {
+		return nil
+	}
+	a.wroteHeader = true
+
+	header := writeUint16ToBytes(ArchiveStartFlag, nil)
+	header = append(header, ArchiveVersion1)
+	_, err := a.w.Write(header)
+	return err
+}
+
+// appendArchiveDirectory 将中央目录追加到buf中
+func appendArchiveDirectory(buf []byte, entries []ArchiveEntry) []byte {
+	buf = writeUint32ToBytes(uint32(len(entries)), buf)
+	for _, e := range entries {
+		buf = writeUint16ToBytes(uint16(len(e.Name)), buf)
+		buf = append(buf, e.Name...)
+		buf = writeUint64ToBytes(e.OriginalSize, buf)
+		buf = writeUint64ToBytes(e.Offset, buf)
+		buf = writeUint64ToBytes(e.CompressedSize, buf)
+		buf = writeUint32ToBytes(e.Checksum, buf)
+	}
+	return buf
+}
+
+// parseArchiveDirectory 解析中央目录，directoryOffset为中央目录的偏移，压缩流不能超出数据区
+func parseArchiveDirectory(directory []byte, directoryOffset uint64) ([]ArchiveEntry, error) {
+	br := &blockReader{r: bytes.NewReader(directory)}
+	num, err := br.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(num)*archiveEntryFixedSize > uint64(len(directory)) {
+		return nil, fmt.Errorf("%w: %d entries", ErrInvalidArchive, num)
+	}
+
+	entries := make([]ArchiveEntry, 0, num)
+	for i := uint32(0); i < num; i++ {
+		nameLen, err := br.readUint16()
+		if err != nil {
+			return nil, err
+		}
+		name, err := br.read(int(nameLen))
+		if err != nil {
+			return nil, err
+		}
+		e := ArchiveEntry{Name: string(name)}
+		if e.OriginalSize, err = br.readUint64(); err != nil {
+			return nil, err
+		}
+		if e.Offset, err = br.readUint64(); err != nil {
+			return nil, err
+		}
+		if e.CompressedSize, err = br.readUint64(); err != nil {
+			return nil, err
+		}
+		if e.Checksum, err = br.readUint32(); err != nil {
+			return nil, err
+		}
+
+		if err := checkArchiveName(e.Name); err != nil {
+			return nil, err
+		}
+		if e.Offset < archiveHeaderSize || e.Offset > directoryOffset || e.CompressedSize > directoryOffset-e.Offset {
+			return nil, fmt.Errorf("%w: entry %q out of range", ErrInvalidArchive, e.Name)
+		}
+		entries = append(entries, e)
+	}
+	if len(br.buf) != len(directory) {
+		return nil, fmt.Errorf("%w: %d trailing bytes in directory", ErrInvalidArchive, len(directory)-len(br.buf))
+	}
+
+	return entries, nil
+}
+
+// checkArchiveName 检查文件路径是否是不会超出解压目录的相对路径
+func checkArchiveName(name string) error {
+	if name == "" || len(name) > 0xFFFF || path.IsAbs(name) || path.Clean(name) != name ||
+		name == "." || name == ".." || strings.HasPrefix(name, "../") || strings.ContainsAny(name, "\\\x00") {
+		return fmt.Errorf("%w: bad name %q", ErrInvalidArchiveEntry, name)
+	}
+	return nil
+}
+
+// ArchiveReader 根据中央目录读取归档中的文件，每个文件可以单独解压
+type ArchiveReader struct {
+	r       io.ReaderAt
+	opts    []ReaderOption
+	entries []ArchiveEntry
+	index   map[string]int
+	closer  io.Closer
+}
+
+// NewArchiveReader 读入并检查归档的中央目录，size为归档的总字节数
+// opts用于配置每个文件的压缩流的解压
+func NewArchiveReader(r io.ReaderAt, size int64, opts ...ReaderOption) (*ArchiveReader, error) {
+	if size < archiveHeaderSize+archiveTailSize {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidArchive)
+	}
+	buf := make([]byte, archiveTailSize)
+	if _, err := r.ReadAt(buf[:archiveHeaderSize], 0); err != nil {
+		return nil, err
+	}
+	startFlag, _ := readNextUint16(buf, 0)
+	if startFlag != ArchiveStartFlag {
+		return nil, ErrInvalidStartFlag
+	}
+	if buf[Uint16ByteSize] != ArchiveVersion1 {
+		return nil, fmt.Errorf("%w: archive version %d", ErrUnsupportedVersion, buf[Uint16ByteSize])
+	}
+
+	// 文件尾
+	if _, err := r.ReadAt(buf, size-archiveTailSize); err != nil {
+		return nil, err
+	}
+	directoryOffset, _ := readNextUint64(buf, 0)
+	expectedChecksum, _ := readNextUint32(buf, Uint64ByteSize)
+	endFlag, _ := readNextUint16(buf, Uint64ByteSize+Uint32ByteSize)
+	if endFlag != ArchiveEndFlag {
+		return nil, ErrInvalidEndFlag
+	}
+	if directoryOffset < archiveHeaderSize || directoryOffset > uint64(size-archiveTailSize) {
+		return nil, fmt.Errorf("%w: directory offset %d", ErrInvalidArchive, directoryOffset)
+	}
+
+	// 中央目录
+	directory := make([]byte, uint64(size-archiveTailSize)-directoryOffset)
+	if _, err := r.ReadAt(directory, int64(directoryOffset)); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(directory, crc32q) != expectedChecksum {
+		return nil, ErrChecksumNotMatched
+	}
+	entries, err := parseArchiveDirectory(directory, directoryOffset)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse archive directory: %w", err)
+	}
+
+	index := make(map[string]int, len(entries))
+	for i, e := range entries {
+		if _, ok := index[e.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate name %q", ErrInvalidArchiveEntry, e.Name)
+		}
+		index[e.Name] = i
+	}
+
+	return &ArchiveReader{r: r, opts: opts, entries: entries, index: index}, nil
+}
+
+// OpenArchive 打开一个归档文件，使用完成后需要调用Close关闭
+func OpenArchive(name string, opts ...ReaderOption) (*ArchiveReader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	a, err := NewArchiveReader(f, info.Size(), opts...)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	a.closer = f
+
+	return a, nil
+}
+
+// Close 关闭OpenArchive打开的文件
+func (a *ArchiveReader) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+// Entries 返回归档中的所有文件，按照写入的顺序排列
+func (a *ArchiveReader) Entries() []ArchiveEntry {
+	return append([]ArchiveEntry(nil), a.entries...)
+}
+
+// Entry 查找路径为name的文件
+func (a *ArchiveReader) Entry(name string) (ArchiveEntry, bool) {
+	i, ok := a.index[name]
+	if !ok {
+		return ArchiveEntry{}, false
+	}
+	return a.entries[i], true
+}
+
+// WriteEntryTo 把路径为name的文件解压到w中，只读入该文件的压缩流
+// 返回写入的字节数，解压后的大小或者校验和与中央目录不一致时返回ErrCorruptBlock或ErrChecksumNotMatched
+func (a *ArchiveReader) WriteEntryTo(name string, w io.Writer) (int64, error) {
+	e, ok := a.Entry(name)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrArchiveEntryNotFound, name)
+	}
+
+	lr := &io.LimitedReader{R: io.NewSectionReader(a.r, int64(e.Offset), int64(e.CompressedSize)), N: int64(e.CompressedSize)}
+	zr, err := NewReader(lr, a.opts...)
+	if err != nil {
+		return 0, err
+	}
+	hw := &hashWriter{w: w, hash: crc32.New(crc32q)}
+	n, err := zr.WriteTo(hw)
+	if err != nil {
+		return n, err
+	}
+	if uint64(n) != e.OriginalSize || lr.N != 0 {
+		return n, ErrCorruptBlock
+	}
+	if hw.hash.Sum32() != e.Checksum {
+		return n, ErrChecksumNotMatched
+	}
+
+	return n, nil
+}
+
+// Extract 把路径为name的文件解压到dst中，dst所在的目录不存在时自动创建，解压失败时删除dst
+func (a *ArchiveReader) Extract(name, dst string) (err error) {
+	if _, ok := a.Entry(name); !ok {
+		return fmt.Errorf("%w: %q", ErrArchiveEntryNotFound, name)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	dstF, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := dstF.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	bw := bufio.NewWriter(dstF)
+	if _, err = a.WriteEntryTo(name, bw); err != nil {
+		return fmt.Errorf("can not extract %q: %w", name, err)
+	}
+	return bw.Flush()
+}
+
+// ExtractAll 把归档中的所有文件解压到dir目录下，保持原来的目录结构
+func (a *ArchiveReader) ExtractAll(dir string) error {
+	for _, e := range a.entries {
+		if err := a.Extract(e.Name, filepath.Join(dir, filepath.FromSlash(e.Name))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashWriter 在写入的同时计算校验和
+type hashWriter struct {
+	w    io.Writer
+	hash hash.Hash32
+}
+
+func (hw *hashWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.hash.Write(p[:n])
+	return n, err
+}
+
+// CreateArchive 把src目录下的所有普通文件打包压缩到dst归档中，src也可以是单个文件
+// 文件按照路径的字典序写入，符号链接和其他特殊文件会被跳过，opts的含义和NewArchiveWriter相同
+func CreateArchive(src, dst string, opts ...WriterOption) (err error) {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	dstF, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := dstF.Close(); err == nil {
+			err = cerr
+		}
+		// 和Extract一样，失败时不留下不完整的归档
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+	// dst在src目录下时不能把正在写入的归档本身打包进去
+	dstInfo, err := dstF.Stat()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(dstF)
+	aw := NewArchiveWriter(bw, opts...)
+	err = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if os.SameFile(info, dstInfo) {
+			return nil
+		}
+
+		name := filepath.Base(p)
+		if srcInfo.IsDir() {
+			rel, err := filepath.Rel(src, p)
+			if err != nil {
+				return err
+			}
+			name = filepath.ToSlash(rel)
+		}
+		return addArchiveFile(aw, name, p)
+	})
+	if err != nil {
+		return err
+	}
+	if err = aw.Close(); err != nil {
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+
+	log.Printf("successfully archived %d files into %s\n", len(aw.entries), dst)
+
+	return nil
+}
+
+// addArchiveFile 把文件filename以name为路径写入归档
+func addArchiveFile(aw *ArchiveWriter, name, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return aw.Add(name, f)
+}
@@ -0,0 +1,137 @@
+package huffman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateArchive(t *testing.T) {
+	data, err := os.ReadFile(s1)
+	require.Nil(t, err)
+	data2, err := os.ReadFile("test/test_data2.txt")
+	require.Nil(t, err)
+
+	src := t.TempDir()
+	files := map[string][]byte{
+		"a.txt":          data,
+		"sub/b.txt":      data2,
+		"sub/deep/c.bin": {1, 2, 3},
+		"sub/empty":      {},
+	}
+	for name, content := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		require.Nil(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.Nil(t, os.WriteFile(p, content, 0644))
+	}
+
+	// 归档写在src目录下，不会把自己打包进去
+	dst := filepath.Join(src, "out.hfa")
+	require.Nil(t, CreateArchive(src, dst, WithConcurrency(2)))
+
+	a, err := OpenArchive(dst, WithReaderConcurrency(2))
+	require.Nil(t, err)
+	defer a.Close()
+	entries := a.Entries()
+	require.Len(t, entries, len(files))
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name)
+		require.Equal(t, uint64(len(files[e.Name])), e.OriginalSize)
+	}
+	require.Equal(t, []string{"a.txt", "sub/b.txt", "sub/deep/c.bin", "sub/empty"}, names)
+
+	// 只解压一个文件
+	var buf bytes.Buffer
+	n, err := a.WriteEntryTo("sub/b.txt", &buf)
+	require.Nil(t, err)
+	require.Equal(t, int64(len(data2)), n)
+	require.Equal(t, data2, buf.Bytes())
+	_, err = a.WriteEntryTo("missing", &buf)
+	require.ErrorIs(t, err, ErrArchiveEntryNotFound)
+
+	out := t.TempDir()
+	require.Nil(t, a.ExtractAll(out))
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		require.Nil(t, err)
+		require.Equal(t, content, got)
+	}
+
+	// src是单个文件时以文件名作为路径
+	single := filepath.Join(out, "single.hfa")
+	require.Nil(t, CreateArchive(s1, single))
+	b, err := OpenArchive(single)
+	require.Nil(t, err)
+	defer b.Close()
+	require.Len(t, b.Entries(), 1)
+	require.Equal(t, "test_data.txt", b.Entries()[0].Name)
+
+	// 打包失败时不留下不完整的归档
+	failed := filepath.Join(out, "failed.hfa")
+	require.ErrorIs(t, CreateArchive(src, failed, WithAdaptive(), WithLZ77()), ErrConflictingModels)
+	_, err = os.Stat(failed)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestArchiveWriter_InvalidName(t *testing.T) {
+	aw := NewArchiveWriter(&bytes.Buffer{})
+	for _, name := range []string{"", "/abs", "../up", ".", "..", "a/../../b", "./a", "a//b", "a\\b"} {
+		require.ErrorIs(t, aw.Add(name, bytes.NewReader(nil)), ErrInvalidArchiveEntry, name)
+	}
+	require.Nil(t, aw.Add("a", bytes.NewReader([]byte("x"))))
+	require.ErrorIs(t, aw.Add("a", bytes.NewReader(nil)), ErrInvalidArchiveEntry)
+	require.Nil(t, aw.Close())
+	require.ErrorIs(t, aw.Add("b", bytes.NewReader(nil)), ErrArchiveWriterClosed)
+}
+
+func TestArchiveReader_Corrupt(t *testing.T) {
+	var buf bytes.Buffer
+	aw := NewArchiveWriter(&buf)
+	require.Nil(t, aw.Add("first", bytes.NewReader(bytes.Repeat([]byte("hello huffman "), 100))))
+	require.Nil(t, aw.Add("second", bytes.NewReader([]byte("second file"))))
+	require.Nil(t, aw.Close())
+	archive := buf.Bytes()
+
+	// 损坏第一个文件的压缩流不影响解压第二个文件
+	first := aw.Entries()[0]
+	broken := append([]byte(nil), archive...)
+	broken[first.Offset+first.CompressedSize/2] ^= 0xFF
+	a, err := NewArchiveReader(bytes.NewReader(broken), int64(len(broken)))
+	require.Nil(t, err)
+	var out bytes.Buffer
+	_, err = a.WriteEntryTo("first", &out)
+	require.NotNil(t, err)
+	out.Reset()
+	_, err = a.WriteEntryTo("second", &out)
+	require.Nil(t, err)
+	require.Equal(t, "second file", out.String())
+
+	// 中央目录被修改
+	broken = append([]byte(nil), archive...)
+	broken[len(broken)-archiveTailSize-1] ^= 0xFF
+	_, err = NewArchiveReader(bytes.NewReader(broken), int64(len(broken)))
+	require.ErrorIs(t, err, ErrChecksumNotMatched)
+
+	_, err = NewArchiveReader(bytes.NewReader(archive[:10]), 10)
+	require.ErrorIs(t, err, ErrInvalidArchive)
+	_, err = NewArchiveReader(bytes.NewReader(archive[1:]), int64(len(archive)-1))
+	require.ErrorIs(t, err, ErrInvalidStartFlag)
+
+	// 结束标志是归档自己的标志，不是压缩文件的结束标志
+	require.Equal(t, ArchiveEndFlag, uint16(archive[len(archive)-2])<<8|uint16(archive[len(archive)-1]))
+	broken = append([]byte(nil), archive...)
+	writeUint16ToBytes(CompressedFileEndFlag, broken[:len(broken)-Uint16ByteSize])
+	_, err = NewArchiveReader(bytes.NewReader(broken), int64(len(broken)))
+	require.ErrorIs(t, err, ErrInvalidEndFlag)
+
+	// 空的归档
+	buf.Reset()
+	require.Nil(t, NewArchiveWriter(&buf).Close())
+	a, err = NewArchiveReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.Nil(t, err)
+	require.Len(t, a.Entries(), 0)
+}
@@ -0,0 +1,164 @@
+package huffman
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// MaxSymbolNum 字节符号的数量
+	MaxSymbolNum = 256
+)
+
+var (
+	ErrInvalidCodeLengths = fmt.Errorf("invalid code lengths")
+)
+
+// CodeLengths 返回Huffman树中每个字节的编码长度
+// 返回的切片以字节为下标，长度为MaxSymbolNum，没有出现的字节编码长度为0
+func (t *HuffmanTree) CodeLengths() []uint8 {
+	lengths := make([]uint8, MaxSymbolNum)
+	for _, leaf := range t.Leaves {
+		lengths[leaf.Byte] = uint8(leaf.WideCode.BitLen())
+	}
+
+	return lengths
+}
+
+// CodeLengths 返回WideHuffmanEncTable中每个字节的编码长度
+// 返回的切片以字节为下标，长度为MaxSymbolNum，没有出现的字节编码长度为0
+func (h WideHuffmanEncTable) CodeLengths() []uint8 {
+	lengths := make([]uint8, MaxSymbolNum)
+	for k, v := range h {
+		lengths[k] = uint8(v.BitLen())
+	}
+
+	return lengths
+}
+
+// NewCanonicalHuffmanEncTable 根据Huffman树中每个字节的编码长度创建范式Huffman编码表
+// 范式Huffman编码只依赖于(字节, 编码长度)，相同的编码长度总是得到相同的编码表
+func NewCanonicalHuffmanEncTable(tree *HuffmanTree) WideHuffmanEncTable {
+	table, err := NewEncTableFromLengths(tree.CodeLengths())
+	if err != nil {
+		// Huffman树得到的编码长度一定是合法的
+		panic(err)
+	}
+
+	return table
+}
+
+// NewEncTableFromLengths 根据每个字节的编码长度创建范式Huffman编码表
+// lengths以字节为下标，编码长度为0表示该字节不在编码表中
+func NewEncTableFromLengths(lengths []uint8) (WideHuffmanEncTable, error) {
+	codes, err := canonicalCodes(lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	table := make(WideHuffmanEncTable, len(codes))
+	for k, code := range codes {
+		table[k] = code
+	}
+
+	return table, nil
+}
+
+// NewDecTableFromLengths 根据每个字节的编码长度创建范式Huffman解码表
+// lengths以字节为下标，编码长度为0表示该字节不在解码表中
+func NewDecTableFromLengths(lengths []uint8) (WideHuffmanDecTable, error) {
+	codes, err := canonicalCodes(lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	table := NewWideHuffmanDecTable(len(codes))
+	for k, code := range codes {
+		table[wideKey(code)] = k
+	}
+
+	return table, nil
+}
+
+// canonicalCodes 按照范式Huffman编码的规则分配编码
+// 编码长度短的字节排在前面，长度相同时按字节从小到大排列，然后依次分配连续的编码
+func canonicalCodes(lengths []uint8) (map[byte]*WideHuffmanCode, error) {
+	if len(lengths) > MaxSymbolNum {
+		return nil, fmt.Errorf("%w: too many symbols %d", ErrInvalidCodeLengths, len(lengths))
+	}
+
+	symbolCodes, err := canonicalSymbolCodes(lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make(map[byte]*WideHuffmanCode, len(symbolCodes))
+	for i, code := range symbolCodes {
+		if code != nil {
+			codes[byte(i)] = code
+		}
+	}
+
+	return codes, nil
+}
+
+// canonicalSymbolCodes 按照范式Huffman编码的规则给每个符号序号分配编码
+// lengths以符号序号为下标，返回的切片与lengths一一对应，编码长度为0的符号没有编码
+func canonicalSymbolCodes(lengths []uint8) ([]*WideHuffmanCode, error) {
+	symbols := make([]int, 0, len(lengths))
+	for i, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		if l > MaxWideHuffmanCodeBitLen {
+			return nil, fmt.Errorf("%w: code length %d of %d exceeds %d", ErrInvalidCodeLengths, l, i, MaxWideHuffmanCodeBitLen)
+		}
+		symbols = append(symbols, i)
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return lengths[symbols[i]] < lengths[symbols[j]]
+	})
+
+	if err := checkKraft(lengths, symbols); err != nil {
+		return nil, err
+	}
+
+	codes := make([]*WideHuffmanCode, len(lengths))
+	var code uint64 = 0
+	var prevLen uint8 = 0
+	for i, s := range symbols {
+		l := lengths[s]
+		if i > 0 {
+			code++
+		}
+		code <<= l - prevLen
+		prevLen = l
+		codes[s] = newCode(code, int(l))
+	}
+
+	return codes, nil
+}
+
+// checkKraft 检查Kraft不等式，编码空间不能被超额分配
+// symbols需要按编码长度升序排列
+func checkKraft(lengths []uint8, symbols []int) error {
+	// left为当前长度下还没有被分配的编码数量
+	var left uint64 = 1
+	var prevLen uint8 = 0
+	for i, s := range symbols {
+		l := lengths[s]
+		for ; prevLen < l; prevLen++ {
+			left <<= 1
+			// 剩余的编码数量已经足够分配给剩下的所有字节
+			if left >= uint64(len(symbols)-i) {
+				return nil
+			}
+		}
+		if left == 0 {
+			return fmt.Errorf("%w: code space oversubscribed", ErrInvalidCodeLengths)
+		}
+		left--
+	}
+
+	return nil
+}
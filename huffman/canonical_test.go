@@ -0,0 +1,69 @@
+package huffman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEncTableFromLengths(t *testing.T) {
+	// RFC 1951 3.2.2中的例子：ABCDEFGH的编码长度为(3, 3, 3, 3, 3, 2, 4, 4)
+	lengths := make([]uint8, MaxSymbolNum)
+	for i, l := range []uint8{3, 3, 3, 3, 3, 2, 4, 4} {
+		lengths['A'+i] = l
+	}
+	expect := map[byte]string{
+		'A': "010", 'B': "011", 'C': "100", 'D': "101",
+		'E': "110", 'F': "00", 'G': "1110", 'H': "1111",
+	}
+
+	table, err := NewEncTableFromLengths(lengths)
+	require.Nil(t, err)
+	require.Equal(t, len(expect), table.ItemNum())
+	for k, v := range expect {
+		require.Equal(t, v, table.Get(k).String())
+	}
+	require.Equal(t, lengths, table.CodeLengths())
+
+	decTable, err := NewDecTableFromLengths(lengths)
+	require.Nil(t, err)
+	require.Equal(t, len(expect), decTable.ItemNum())
+	for k, v := range expect {
+		got, ok := decTable.Get(NewWideHuffmanCodeFromString(v))
+		require.True(t, ok)
+		require.Equal(t, k, got)
+	}
+}
+
+func TestNewEncTableFromLengths_Invalid(t *testing.T) {
+	_, err := NewEncTableFromLengths([]uint8{1, 1, 1})
+	require.ErrorIs(t, err, ErrInvalidCodeLengths)
+
+	_, err = NewEncTableFromLengths([]uint8{MaxWideHuffmanCodeBitLen + 1})
+	require.ErrorIs(t, err, ErrInvalidCodeLengths)
+
+	_, err = NewDecTableFromLengths(make([]uint8, MaxSymbolNum+1))
+	require.ErrorIs(t, err, ErrInvalidCodeLengths)
+}
+
+// 相同的频数总是得到相同的范式编码表和相同的序列化结果
+func TestNewCanonicalHuffmanEncTable_Reproducible(t *testing.T) {
+	freq := Frequencies{'a': 2, 'b': 2, 'c': 2, 'e': 2, 'f': 1, 'g': 7, 'h': 7}
+
+	table := NewCanonicalHuffmanEncTable(NewHuffmanTree(freq))
+	ser, err := table.Serialize()
+	require.Nil(t, err)
+
+	for i := 0; i < 20; i++ {
+		other := NewCanonicalHuffmanEncTable(NewHuffmanTree(freq))
+		require.True(t, table.Equals(other))
+
+		otherSer, err := other.Serialize()
+		require.Nil(t, err)
+		require.Equal(t, ser, otherSer)
+	}
+
+	fromLengths, err := NewEncTableFromLengths(NewHuffmanTree(freq).CodeLengths())
+	require.Nil(t, err)
+	require.True(t, table.Equals(fromLengths))
+}
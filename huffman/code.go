@@ -5,25 +5,40 @@ import (
 	"strings"
 )
 
-type Frequencies map[byte]uint64
-
-func (f Frequencies) Increment(key byte) {
-	f[key]++
-}
+// Frequencies 记录每个字节的出现频数
+type Frequencies = SymbolFrequencies[byte]
 
+// HuffmanCodeInterface 是Huffman编码的通用接口，HuffmanCode和WideHuffmanCode都实现了该接口
+// ByteEncTable和ByteDecTable通过它读写编码，不超过MaxHuffmanCodeBitLen比特的编码可以使用更紧凑的HuffmanCode
 type HuffmanCodeInterface interface {
 	fmt.Stringer
 	BitLen() int
+	// Value 以uint64的形式返回右对齐的比特位
+	Value() uint64
 	AppendOne()
 	AppendZero()
-	ReverseNew() HuffmanCodeInterface
-	Clone() HuffmanCodeInterface
 }
 
+var (
+	_ HuffmanCodeInterface = (*HuffmanCode)(nil)
+	_ HuffmanCodeInterface = (*WideHuffmanCode)(nil)
+)
+
 const (
-	MaxHuffmanCodeBitLen = 24 // 允许最长的编码比特位到24位
+	MaxHuffmanCodeBitLen     = 24 // 允许最长的编码比特位到24位
+	MaxWideHuffmanCodeBitLen = 64 // WideHuffmanCode允许最长的编码比特位到64位
 )
 
+// newCode 根据右对齐的比特位和比特位长度创建WideHuffmanCode
+func newCode(bits uint64, bitLen int) *WideHuffmanCode {
+	return &WideHuffmanCode{bits: bits, bitLen: uint8(bitLen)}
+}
+
+// wideKey 返回编码的值拷贝，用作解码表的键
+func wideKey(code *WideHuffmanCode) WideHuffmanCode {
+	return *code
+}
+
 // 用一个uint32类型代表一个huffman的二进制编码格式
 // 高8位存比特位长度，低24位存比特位本身
 // 比特位本身的最高位放在Uint32中低24位的最高位
@@ -48,6 +63,14 @@ func NewHuffmanCodeFromString(s string) *HuffmanCode {
 	return code
 }
 
+// newHuffmanCode 根据右对齐的比特位和比特位长度创建对象
+func newHuffmanCode(bits uint32, bitLen int) *HuffmanCode {
+	code := &HuffmanCode{}
+	code.bits = (bits << (MaxHuffmanCodeBitLen - bitLen)) & 0x00FFFFFF
+	code.setBitLen(uint8(bitLen))
+	return code
+}
+
 // BitLen 返回比特位长度
 func (h *HuffmanCode) BitLen() int {
 	// 高8位
@@ -76,6 +99,11 @@ func (h *HuffmanCode) BitsUntouched() uint32 {
 	return (h.bits & 0x00FFFFFF)
 }
 
+// Value 以uint64的形式返回右对齐的比特位
+func (h *HuffmanCode) Value() uint64 {
+	return uint64(h.BitsUntouched() >> (MaxHuffmanCodeBitLen - h.BitLen()))
+}
+
 // AllBits 以uint32的形式返回带有bitlen的比特位
 func (h *HuffmanCode) AllBits() uint32 {
 	return h.bits
@@ -153,3 +181,102 @@ func (h *HuffmanCode) Clone() *HuffmanCode {
 		bits: h.bits,
 	}
 }
+
+// WideHuffmanCode 用于表示超过24位的Huffman编码，最长64位
+// bits中的比特位右对齐存放，比特位本身的最高位在bits的第bitLen-1位
+type WideHuffmanCode struct {
+	bits   uint64
+	bitLen uint8
+}
+
+// NewWideHuffmanCodeFromString 从01字符串中创建对象
+func NewWideHuffmanCodeFromString(s string) *WideHuffmanCode {
+	code := &WideHuffmanCode{}
+
+	for _, ch := range s {
+		if ch == '0' {
+			code.AppendZero()
+		} else if ch == '1' {
+			code.AppendOne()
+		} else {
+			panic(fmt.Sprintf("character must be either '0' or '1', but found %c", ch))
+		}
+	}
+
+	return code
+}
+
+// BitLen 返回比特位长度
+func (h *WideHuffmanCode) BitLen() int {
+	return int(h.bitLen)
+}
+
+// Bits 以uint64的形式返回比特位本身
+// 有效比特位的最高位移到从uint64最高位开始
+func (h *WideHuffmanCode) Bits() uint64 {
+	if h.bitLen == 0 {
+		return 0
+	}
+	return h.bits << (MaxWideHuffmanCodeBitLen - int(h.bitLen))
+}
+
+// Value 以uint64的形式返回右对齐的比特位
+func (h *WideHuffmanCode) Value() uint64 {
+	return h.bits
+}
+
+// 实现fmt.Stringer接口
+func (h *WideHuffmanCode) String() string {
+	bitLen := h.BitLen()
+	res := strings.Builder{}
+	res.Grow(bitLen)
+
+	for i := bitLen - 1; i >= 0; i-- {
+		if (h.bits>>i)&1 == 0 {
+			res.WriteByte('0')
+		} else {
+			res.WriteByte('1')
+		}
+	}
+
+	return res.String()
+}
+
+// AppendOne 往比特位后追加1，比特位长度已经达到MaxWideHuffmanCodeBitLen时panic
+func (h *WideHuffmanCode) AppendOne() {
+	h.checkAppend()
+	h.bits = (h.bits << 1) | 1
+	h.bitLen++
+}
+
+// AppendZero 往比特位后追加0，比特位长度已经达到MaxWideHuffmanCodeBitLen时panic
+func (h *WideHuffmanCode) AppendZero() {
+	h.checkAppend()
+	h.bits <<= 1
+	h.bitLen++
+}
+
+// checkAppend 检查是否还能追加比特位
+func (h *WideHuffmanCode) checkAppend() {
+	if h.bitLen >= MaxWideHuffmanCodeBitLen {
+		panic(fmt.Sprintf("huffman code %s already has %d bits", h.String(), MaxWideHuffmanCodeBitLen))
+	}
+}
+
+// ReverseNew 逆序比特位并返回新的对象
+func (h *WideHuffmanCode) ReverseNew() *WideHuffmanCode {
+	clone := &WideHuffmanCode{bitLen: h.bitLen}
+	for i := 0; i < int(h.bitLen); i++ {
+		clone.bits = (clone.bits << 1) | ((h.bits >> i) & 1)
+	}
+
+	return clone
+}
+
+// Clone 返回对象的拷贝
+func (h *WideHuffmanCode) Clone() *WideHuffmanCode {
+	return &WideHuffmanCode{
+		bits:   h.bits,
+		bitLen: h.bitLen,
+	}
+}
@@ -109,3 +109,46 @@ func TestHuffmanClone(t *testing.T) {
 	clone := code.Clone()
 	require.EqualValues(t, code.Bits(), clone.Bits())
 }
+
+func TestWideHuffmanCode(t *testing.T) {
+	ss := []string{
+		"0",
+		"1011",
+		"100110010100111011010101",
+		"1001100101001110110101011",
+		"1111111111111111111111111111111111111111111111111111111111111110",
+		"0000000000000000000000000000000000000000000000000000000000000001",
+	}
+	for _, s := range ss {
+		code := NewWideHuffmanCodeFromString(s)
+		require.EqualValues(t, s, code.String())
+		require.EqualValues(t, len(s), code.BitLen())
+		require.EqualValues(t, reverseString(s), code.ReverseNew().String())
+		require.EqualValues(t, code.Bits(), code.Clone().Bits())
+		require.EqualValues(t, s, BytesToString(writeUint64ToBytes(code.Bits(), nil), len(s)))
+	}
+
+	// 不超过24位时，HuffmanCode和WideHuffmanCode的值相同
+	for i := 0; i < 10; i++ {
+		s := randomOneZeroString()
+		require.EqualValues(t, NewHuffmanCodeFromString(s).Value(), NewWideHuffmanCodeFromString(s).Value())
+	}
+
+	require.Panics(t, func() { NewWideHuffmanCodeFromString("0120") })
+
+	// 超过64位时panic，而不是丢掉比特位
+	full := NewWideHuffmanCodeFromString(strings.Repeat("1", MaxWideHuffmanCodeBitLen))
+	require.Panics(t, func() { full.AppendOne() })
+	require.Panics(t, func() { full.AppendZero() })
+	require.Equal(t, MaxWideHuffmanCodeBitLen, full.BitLen())
+}
+
+func TestNewCode(t *testing.T) {
+	code := newCode(0x5, 3)
+	require.Equal(t, "101", code.String())
+	require.Equal(t, "101", code.ReverseNew().String())
+
+	code = newCode(0x1000001, 25)
+	require.Equal(t, "1000000000000000000000001", code.String())
+	require.Equal(t, *code, wideKey(code.Clone()))
+}
@@ -1,10 +1,12 @@
 package huffman
 
 import (
+	"bufio"
 	"fmt"
 	"hash/crc32"
 	"io"
 	"log"
+	"math"
 	"os"
 	"path"
 )
@@ -14,28 +16,61 @@ const (
 	CompressedFileEndFlag   uint16 = 0x414E
 )
 
+// 压缩文件格式版本，VERSION紧跟在START_FLAG之后
+const (
+	// FileVersion1 是没有VERSION字段的旧格式，该位置是文件名长度的高字节，由于文件名不超过255字节所以总是为0
+	FileVersion1 byte = 0
+	// FileVersion2 使用64位的大小字段，数据区为压缩流
+	FileVersion2 byte = 2
+	// FileVersion3 在FileVersion2的基础上记录变换链，数据区为变换后的帧的压缩流，只在使用了变换时写出
+	FileVersion3 byte = 3
+	// FileVersion4 在FileVersion3的基础上记录源文件的元数据（格式见metadata.go），只在使用了WithFileMetadata时写出
+	FileVersion4 byte = 4
+)
+
 var (
 	ErrCanNotParseFileHeader = fmt.Errorf("can not parse file header")
 )
 
-// compressBytesWith 使用给定的Huffman编码表压缩字节切片
+// compressBytesWith 使用给定的Huffman编码表压缩字节切片，HuffmanEncTable、WideHuffmanEncTable和EscapeEncTable都可以使用
+// 码表中没有的字节在带有转义码时编码为转义码加上8比特的原始字节，否则返回错误
 // 返回压缩后的字节切片，压缩后的有效比特数
-func compressBytesWith(data []byte, table HuffmanEncTable) ([]byte, uint64, error) {
-	w := NewBitsWriter()
-	var totalBits uint64 = 0
+func compressBytesWith(data []byte, table ByteEncTable) ([]byte, uint64, error) {
+	// 先把码表展开成以字节为下标的数组，避免在循环中查map
+	var values [MaxSymbolNum]uint64
+	var bitLens [MaxSymbolNum]uint
+	for i := 0; i < MaxSymbolNum; i++ {
+		if code, ok := table.Code(byte(i)); ok {
+			values[i] = code.Value()
+			bitLens[i] = uint(code.BitLen())
+		}
+	}
 
-	// 遍历data，编码每个字节
+	escape := escapeOf(table)
+
+	// 预估压缩后的比特数，减少缓冲区扩容
+	var totalBits uint64 = 0
 	for i, b := range data {
-		code := table.Get(b)
-		if code == nil {
+		if bitLens[b] != 0 {
+			totalBits += uint64(bitLens[b])
+			continue
+		}
+		if escape == nil {
 			return nil, 0, fmt.Errorf("code for %b(%c at %d) not found", b, b, i)
 		}
-		bitlen := code.BitLen()
-		totalBits += uint64(bitlen)
-		err := w.WriteUint32(code.Bits(), uint8(bitlen))
-		if err != nil {
-			return nil, 0, fmt.Errorf(err.Error())
+		totalBits += uint64(escape.BitLen()) + 8
+	}
+
+	w := NewBitsWriter()
+	w.Grow(totalBits)
+	// 遍历data，编码每个字节
+	for _, b := range data {
+		if bitLens[b] != 0 {
+			w.writeBits(values[b], bitLens[b])
+			continue
 		}
+		w.writeBits(escape.Value(), uint(escape.BitLen()))
+		w.writeBits(uint64(b), 8)
 	}
 	return w.Buf(), totalBits, nil
 }
@@ -47,121 +82,239 @@ func CompressBytes(data []byte) ([]byte, uint64, error) {
 	freq := CountFrequencies(data)
 	// 构建Huffman树
 	tree := NewHuffmanTree(freq)
-	// 获取Huffman编码表
-	table := NewHuffmanEncTable(tree)
+	// 获取范式Huffman编码表
+	table := NewCanonicalHuffmanEncTable(tree)
 
 	return compressBytesWith(data, table)
 }
 
+// CompressFileOption 用于配置CompressFile
+// WriterOption也是CompressFileOption，用于配置文件的压缩流
+type CompressFileOption interface {
+	applyCompressFile(c *compressFileConfig)
+}
+
+// compressFileConfig 是CompressFile的配置
+type compressFileConfig struct {
+	writerOpts []WriterOption
+	transforms []Transform // 变换链
+	metadata   bool        // 是否记录源文件的元数据
+	err        error
+}
+
+// compressFileOption 是只对CompressFile有效的选项
+type compressFileOption func(c *compressFileConfig)
+
+func (o compressFileOption) applyCompressFile(c *compressFileConfig) {
+	o(c)
+}
+
+func (o WriterOption) applyCompressFile(c *compressFileConfig) {
+	c.writerOpts = append(c.writerOpts, o)
+}
+
+// WithTransforms 设置压缩前按顺序执行的变换链，变换链中每个变换的ID记录在文件头中，DecompressFile自动执行逆变换
+// 直接使用Writer时可以通过NewTransformWriter变换数据
+func WithTransforms(chain ...Transform) CompressFileOption {
+	return compressFileOption(func(c *compressFileConfig) {
+		if len(chain) > MaxTransformNum {
+			c.err = ErrTooManyTransforms
+			return
+		}
+		for _, t := range chain {
+			if t == nil || t.ID() == 0 {
+				c.err = ErrInvalidTransform
+				return
+			}
+		}
+		c.transforms = chain
+	})
+}
+
+// WithFileMetadata 在文件头中记录源文件的权限位、修改时间和所有者（只在Linux上记录）
+// DecompressFile通过WithRestoreMetadata恢复这些元数据
+func WithFileMetadata() CompressFileOption {
+	return compressFileOption(func(c *compressFileConfig) {
+		c.metadata = true
+	})
+}
+
+// DecompressFileOption 用于配置DecompressFile
+// ReaderOption也是DecompressFileOption，用于配置文件的压缩流
+type DecompressFileOption interface {
+	applyDecompressFile(c *decompressFileConfig)
+}
+
+// decompressFileConfig 是DecompressFile的配置
+type decompressFileConfig struct {
+	readerOpts      []ReaderOption
+	restoreMetadata bool // 是否恢复文件头中记录的元数据
+}
+
+// decompressFileOption 是只对DecompressFile有效的选项
+type decompressFileOption func(c *decompressFileConfig)
+
+func (o decompressFileOption) applyDecompressFile(c *decompressFileConfig) {
+	o(c)
+}
+
+func (o ReaderOption) applyDecompressFile(c *decompressFileConfig) {
+	c.readerOpts = append(c.readerOpts, o)
+}
+
+// WithRestoreMetadata 把文件头中记录的元数据恢复到解压出的文件上
+// 所有者只有在Linux上以root用户解压时才会恢复，没有记录元数据的文件不受影响
+func WithRestoreMetadata() DecompressFileOption {
+	return decompressFileOption(func(c *decompressFileConfig) {
+		c.restoreMetadata = true
+	})
+}
+
 // CompressFile 压缩一个文件
-// 将src文件压缩，然后写入到dst文件中
+// 将src文件压缩，然后写入到dst文件中，opts用于配置压缩流（例如通过WithConcurrency并行压缩）和文件头（例如WithTransforms）
 //
 // 压缩文件格式如下：（大端序）
 // HEADER
 //   - START_FLAG						2 bytes (uint16)
+//   - VERSION							1 byte
 //   - SRC_FILENAME_LEN					2 bytes (uint16)
-//   - BYTE SIZE BEFORE COMPRESSION		4 bytes (uint32)
-//   - BYTE SIZE AFTER COMPRESSION		4 bytes (uint32)
+//   - BYTE SIZE BEFORE COMPRESSION		8 bytes (uint64)
+//   - BYTE SIZE AFTER COMPRESSION		8 bytes (uint64) 数据区的字节数
 //   - SRC_FILENAME						n bytes
+//   - TRANSFORM NUM					1 byte  只有FileVersion3和FileVersion4有该字段，FileVersion4中可以为0
+//   - TRANSFORM ID 1 ... TRANSFORM ID N	TRANSFORM NUM bytes 按照压缩时执行的顺序排列
+//   - METADATA							只有FileVersion4有该字段，格式见metadata.go
 //
 // DATA
-//   - HUFFMAN TABLE
-//     -- HUFFMAN TABLE SIZE 	4 bytes (uint32)
-//     -- HUFFMAN TABLE DATA
-//   - COMPRESSED DATA
-//     -- VALID BIT LEN			4 bytes (uint32) + 1 bytes = 5 bytes
-//     -- COMPRESSED BIT
+//   - 压缩流，格式见container.go；FileVersion3为变换后的帧（格式见transform.go）的压缩流
 //
 // TAIL
-//   - CRC32 CHECKSUM	  	4 bytes (uint32)
+//   - CRC32 CHECKSUM	  	4 bytes (uint32) 文件头的校验和，数据区由压缩流自己校验
 //   - END_FLAG				2 bytes (uint16)
-func CompressFile(src, dst string) error {
+//
+// 没有通过WithTransforms指定变换链时写出FileVersion2格式的文件，通过WithFileMetadata记录元数据时写出FileVersion4格式的文件
+// 旧版本（FileVersion1）的压缩文件没有VERSION字段，格式见decompressFileV1
+func CompressFile(src, dst string, opts ...CompressFileOption) (err error) {
+	cfg := &compressFileConfig{}
+	for _, opt := range opts {
+		opt.applyCompressFile(cfg)
+	}
+	if cfg.err != nil {
+		return cfg.err
+	}
+
 	srcF, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer srcF.Close()
 
-	// 读入源文件内容
-	allSrcBytes, err := io.ReadAll(srcF)
+	// 准备写入目标文件
+	dstF, err := os.Create(dst)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if cerr := dstF.Close(); err == nil {
+			err = cerr
+		}
+	}()
 
-	// 执行源文件压缩
-	freq := CountFrequencies(allSrcBytes)
-	tree := NewHuffmanTree(freq)
-	encTable := NewHuffmanEncTable(tree)
+	// 以流的方式压缩源文件，不需要一次性读入整个文件
+	bw := bufio.NewWriter(dstF)
+	cw := &countWriter{w: bw}
+	zw := NewWriter(cw, cfg.writerOpts...)
+	transforms := transformIDs(cfg.transforms)
+	var meta *FileMetadata
+	if cfg.metadata {
+		info, err := srcF.Stat()
+		if err != nil {
+			return err
+		}
+		meta = newFileMetadata(info)
+	}
 
-	compressedBytes, bitLen, err := compressBytesWith(allSrcBytes, encTable)
-	if err != nil {
+	// 压缩前后的大小要等压缩完成才知道，这里先占位，压缩完成后再回写文件头
+	filenameNoDir := path.Base(src)
+	header := appendFileHeader(nil, filenameNoDir, 0, 0, transforms, meta)
+	if _, err = dstF.Write(header); err != nil {
 		return err
 	}
 
-	// Huffman码表
-	encTableSer, err := encTable.Serialize()
+	var originalSize int64
+	if len(transforms) == 0 {
+		originalSize, err = io.Copy(zw, srcF)
+	} else {
+		tw := NewTransformWriter(zw, cfg.transforms...)
+		if originalSize, err = io.Copy(tw, srcF); err == nil {
+			err = tw.Close()
+		}
+	}
 	if err != nil {
 		return err
 	}
-
-	// 准备写入目标文件
-	dstF, err := os.Create(dst)
-	if err != nil {
+	if err = zw.Close(); err != nil {
 		return err
 	}
-	defer dstF.Close()
-
-	originalSize := uint32(len(allSrcBytes))
-	compressedSize := uint32(len(compressedBytes))
-	filenameNoDir := path.Base(src)
-	filenameNoDirSize := uint16(len(filenameNoDir))
-
-	// 27字节为文件的固定开销
-	var alloc uint32 = 27 + compressedSize + uint32(len(encTableSer))
-	dstBytes := make([]byte, 0, alloc)
-	// 写入文件头
-	dstBytes = writeUint16ToBytes(CompressedFileStartFlag, dstBytes) // 文件开始标识
-	dstBytes = writeUint16ToBytes(filenameNoDirSize, dstBytes)       // 文件名长度
-	dstBytes = writeUint32ToBytes(originalSize, dstBytes)            // 压缩前字节大小
-	dstBytes = writeUint32ToBytes(compressedSize, dstBytes)          // 压缩后字节大小
-	dstBytes = append(dstBytes, []byte(filenameNoDir)...)            // 源文件名
-
-	// 写入数据区
-	dstBytes = writeUint32ToBytes(uint32(len(encTableSer)), dstBytes) // Huffman码表大小
-	dstBytes = append(dstBytes, encTableSer...)                       // Huffman码表
-
-	// 根据实际比特长度计算压缩后需要占用多少个字节
-	bytesNeededAfterCompressed := bitLen / 8
-	slot := bitLen % 8
-	if slot != 0 {
-		bytesNeededAfterCompressed += 1
-	}
-
-	// 用5个字节来记录bitLen：
-	// bytesNeededAfterCompressed用4个字节
-	// slot用1个字节
-	dstBytes = writeUint32ToBytes(uint32(bytesNeededAfterCompressed), dstBytes)
-	dstBytes = append(dstBytes, byte(slot))
-	// dstBytes = writeUint64ToBytes(bitLen, dstBytes) // bitlen
-	dstBytes = append(dstBytes, compressedBytes...) // 压缩后数据本身
 
 	// 写入文件尾
-	checksum := crc32.Checksum(dstBytes, crc32q)
-	dstBytes = writeUint32ToBytes(checksum, dstBytes)              // 校验和
-	dstBytes = writeUint16ToBytes(CompressedFileEndFlag, dstBytes) // 结束标记
+	header = appendFileHeader(nil, filenameNoDir, uint64(originalSize), cw.n, transforms, meta)
+	tail := writeUint32ToBytes(crc32.Checksum(header, crc32q), nil) // 校验和
+	tail = writeUint16ToBytes(CompressedFileEndFlag, tail)          // 结束标记
+	if _, err = bw.Write(tail); err != nil {
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
 
-	// 一次性写入文件
-	n, err := dstF.Write(dstBytes)
-	if err != nil {
+	// 回写文件头
+	if _, err = dstF.WriteAt(header, 0); err != nil {
 		return err
 	}
 
-	log.Printf("successfully written %d bytes into %s\n", n, dst)
+	log.Printf("successfully written %d bytes into %s\n", uint64(len(header))+cw.n+uint64(len(tail)), dst)
 
 	return nil
 }
 
-func decompressBytesWith(data []byte, bitLen uint64, table HuffmanDecTable) ([]byte, error) {
+// appendFileHeader 将压缩文件头追加到buf中，meta不为nil时使用FileVersion4格式，否则transforms不为空时使用FileVersion3格式
+func appendFileHeader(buf []byte, filename string, originalSize, compressedSize uint64, transforms []byte, meta *FileMetadata) []byte {
+	version := FileVersion2
+	if meta != nil {
+		version = FileVersion4
+	} else if len(transforms) > 0 {
+		version = FileVersion3
+	}
+	buf = writeUint16ToBytes(CompressedFileStartFlag, buf) // 文件开始标识
+	buf = append(buf, version)                             // 文件格式版本
+	buf = writeUint16ToBytes(uint16(len(filename)), buf)   // 文件名长度
+	buf = writeUint64ToBytes(originalSize, buf)            // 压缩前字节大小
+	buf = writeUint64ToBytes(compressedSize, buf)          // 压缩后字节大小
+	buf = append(buf, []byte(filename)...)                 // 源文件名
+	if version >= FileVersion3 {
+		buf = append(buf, byte(len(transforms))) // 变换数量
+		buf = append(buf, transforms...)         // 变换ID
+	}
+	if version == FileVersion4 {
+		buf = appendFileMetadata(buf, meta) // 元数据
+	}
+	return buf
+}
+
+// countWriter 记录写入的字节数
+type countWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += uint64(n)
+	return n, err
+}
+
+func decompressBytesWith(data []byte, bitLen uint64, table ByteDecTable) ([]byte, error) {
 	reader := NewBitsReader(data, bitLen, table)
 
 	recovery, err := reader.ReadAll()
@@ -175,20 +328,220 @@ func decompressBytesWith(data []byte, bitLen uint64, table HuffmanDecTable) ([]b
 
 // DecompressBytes 解压缩一个字节切片
 // 输入参数包括压缩了的字节切片本身，字节切片中有效比特数和Huffman解码表
-func DecompressBytes(data []byte, bitLen uint64, table HuffmanDecTable) ([]byte, error) {
+func DecompressBytes(data []byte, bitLen uint64, table ByteDecTable) ([]byte, error) {
 	return decompressBytesWith(data, bitLen, table)
 }
 
 // DecompressFile 解压缩一个文件
 // 将src文件解压缩，然后写入到dst文件中
-func DecompressFile(src, dst string) error {
+//
+// 根据文件头中的版本选择解压方式，旧版本的压缩文件仍然可以解压
+// opts中的ReaderOption用于配置压缩流的解压，例如通过WithReaderConcurrency并行解压，只对FileVersion2及以后格式的文件有效
+// FileVersion3和FileVersion4格式的文件根据文件头中记录的变换链自动执行逆变换，自定义的变换需要先通过RegisterTransform注册
+// 通过WithRestoreMetadata可以恢复FileVersion4格式的文件中记录的权限位、修改时间和所有者
+func DecompressFile(src, dst string, opts ...DecompressFileOption) error {
+	cfg := &decompressFileConfig{}
+	for _, opt := range opts {
+		opt.applyDecompressFile(cfg)
+	}
+
 	srcF, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer srcF.Close()
 
-	srcBytes, err := io.ReadAll(srcF)
+	br := bufio.NewReader(srcF)
+	head, err := br.Peek(Uint16ByteSize + 1)
+	if err != nil {
+		return fmt.Errorf("can not parse file header: %v", err)
+	}
+	gotStartFlag, _ := readNextUint16(head, 0)
+	if gotStartFlag != CompressedFileStartFlag {
+		return fmt.Errorf("can not parse file header: %w", ErrInvalidStartFlag)
+	}
+
+	switch head[Uint16ByteSize] {
+	case FileVersion1:
+		return decompressFileV1(br, dst)
+	case FileVersion2, FileVersion3, FileVersion4:
+		return decompressFileV2(br, dst, cfg)
+	default:
+		return fmt.Errorf("%w: file version %d", ErrUnsupportedVersion, head[Uint16ByteSize])
+	}
+}
+
+// decompressFileV2 解压缩FileVersion2及以后格式的文件，格式见CompressFile
+func decompressFileV2(r io.Reader, dst string, cfg *decompressFileConfig) (err error) {
+	// 文件头
+	hr := &blockReader{r: r}
+	header, err := parseFileHeaderV2(hr)
+	if err != nil {
+		return fmt.Errorf("can not parse file header: %w", err)
+	}
+	headerChecksum := crc32.Checksum(hr.buf, crc32q)
+	chain, err := lookupTransforms(header.transforms)
+	if err != nil {
+		return fmt.Errorf("can not parse file header: %w", err)
+	}
+
+	// 创建目标文件准备写回，解压失败时删除
+	dstF, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := dstF.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	// 数据区
+	lr := &io.LimitedReader{R: r, N: int64(header.compressedSize)}
+	zr, err := NewReader(lr, cfg.readerOpts...)
+	if err != nil {
+		return fmt.Errorf("can not parse file data area: %w", err)
+	}
+	var n int64
+	if len(chain) == 0 {
+		// 并行解压时每个块直接写入目标文件中的对应位置
+		n, err = zr.WriteTo(dstF)
+	} else {
+		// 变换后的帧需要按照顺序逆变换
+		cw := &countWriter{w: dstF}
+		iw := NewInverseTransformWriter(cw, chain...)
+		if _, err = zr.WriteTo(iw); err == nil {
+			err = iw.Close()
+		}
+		n = int64(cw.n)
+	}
+	if err != nil {
+		return fmt.Errorf("can not parse file data area: %w", err)
+	}
+	if uint64(n) != header.originalSize || lr.N != 0 {
+		return fmt.Errorf("can not parse file data area: %w", ErrCorruptBlock)
+	}
+
+	// 文件尾
+	tr := &blockReader{r: r}
+	expectedChecksum, err := tr.readUint32()
+	if err != nil {
+		return fmt.Errorf("can not parse file tail: %w", err)
+	}
+	if expectedChecksum != headerChecksum {
+		return fmt.Errorf("can not parse file tail: %w", ErrChecksumNotMatched)
+	}
+	gotEndFlag, err := tr.readUint16()
+	if err != nil {
+		return fmt.Errorf("can not parse file tail: %w", err)
+	}
+	if gotEndFlag != CompressedFileEndFlag {
+		return fmt.Errorf("can not parse file tail: %w", ErrInvalidEndFlag)
+	}
+
+	// 数据全部写完之后才能恢复修改时间
+	if cfg.restoreMetadata && header.metadata != nil {
+		if err = header.metadata.restore(dstF); err != nil {
+			return fmt.Errorf("can not restore metadata: %w", err)
+		}
+	}
+
+	log.Printf("successfully written %d bytes into destination: %s\n", n, dst)
+
+	return nil
+}
+
+// fileHeader 是FileVersion2及以后格式的文件头中解压需要的字段
+type fileHeader struct {
+	originalSize   uint64
+	compressedSize uint64
+	transforms     []byte        // 变换链中每个变换的ID
+	metadata       *FileMetadata // 没有记录元数据时为nil
+}
+
+// parseFileHeaderV2 解析FileVersion2及以后格式的文件头
+func parseFileHeaderV2(br *blockReader) (*fileHeader, error) {
+	// 开始标记和版本已经检查过
+	head, err := br.read(Uint16ByteSize + 1)
+	if err != nil {
+		return nil, err
+	}
+	version := head[Uint16ByteSize]
+	filenameLen, err := br.readUint16()
+	if err != nil {
+		return nil, err
+	}
+	header := &fileHeader{}
+	if header.originalSize, err = br.readUint64(); err != nil {
+		return nil, err
+	}
+	if header.compressedSize, err = br.readUint64(); err != nil {
+		return nil, err
+	}
+	if header.compressedSize > math.MaxInt64 {
+		return nil, ErrCanNotParseFileHeader
+	}
+	// 源文件名字
+	if _, err := br.read(int(filenameLen)); err != nil {
+		return nil, err
+	}
+	if version == FileVersion2 {
+		return header, nil
+	}
+
+	// 变换链，FileVersion3中至少有一个变换
+	num, err := br.read(1)
+	if err != nil {
+		return nil, err
+	}
+	if num[0] == 0 && version == FileVersion3 {
+		return nil, ErrCanNotParseFileHeader
+	}
+	transforms, err := br.read(int(num[0]))
+	if err != nil {
+		return nil, err
+	}
+	if len(transforms) > 0 {
+		header.transforms = append([]byte(nil), transforms...)
+	}
+	if version == FileVersion3 {
+		return header, nil
+	}
+
+	// 元数据
+	if header.metadata, err = readFileMetadata(br); err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// decompressFileV1 解压缩FileVersion1格式的文件
+//
+// 压缩文件格式如下：（大端序）
+// HEADER
+//   - START_FLAG						2 bytes (uint16)
+//   - SRC_FILENAME_LEN					2 bytes (uint16)
+//   - BYTE SIZE BEFORE COMPRESSION		4 bytes (uint32)
+//   - BYTE SIZE AFTER COMPRESSION		4 bytes (uint32)
+//   - SRC_FILENAME						n bytes
+//
+// DATA
+//   - HUFFMAN TABLE
+//     -- HUFFMAN TABLE SIZE 	4 bytes (uint32)
+//     -- HUFFMAN TABLE DATA
+//   - COMPRESSED DATA
+//     -- VALID BIT LEN			4 bytes (uint32) + 1 bytes = 5 bytes
+//     -- COMPRESSED BIT
+//
+// TAIL
+//   - CRC32 CHECKSUM	  	4 bytes (uint32)
+//   - END_FLAG				2 bytes (uint16)
+func decompressFileV1(r io.Reader, dst string) error {
+	srcBytes, err := io.ReadAll(r)
 	if err != nil {
 		return err
 	}
@@ -230,7 +583,7 @@ func DecompressFile(src, dst string) error {
 	return nil
 }
 
-// 解析压缩文件头
+// 解析FileVersion1格式的压缩文件头
 func parseFileHeader(srcBytes []byte, cursor int) (newCursor int, err error) {
 	defer func() {
 		if p := recover(); p != nil {
@@ -300,7 +653,7 @@ func parseCompressedDataArea(srcBytes []byte, cursor int) (data []byte, newCurso
 	}
 	cursor += Uint32ByteSize
 
-	decTable, err := DeserializeHuffmanDecTable(srcBytes[cursor : cursor+int(huffTableLen)])
+	decTable, err := DeserializeWideHuffmanDecTable(srcBytes[cursor : cursor+int(huffTableLen)])
 	if err != nil {
 		return nil, 0, err
 	}
@@ -2,9 +2,11 @@ package huffman
 
 import (
 	"fmt"
+	"hash/crc32"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -42,7 +44,8 @@ func TestSaveHuffmanTablePretty(t *testing.T) {
 	// fmt.Printf("len(freq) = %d\n", len(freq))
 	tree := NewHuffmanTree(freq)
 
-	encTable := NewHuffmanEncTable(tree)
+	encTable, err := NewHuffmanEncTable(tree)
+	require.Nil(t, err)
 
 	prettyEncString := encTable.PrettyString()
 	outname := "test/test_data-huffman.txt"
@@ -93,3 +96,135 @@ func TestCompressAndDecompress(t *testing.T) {
 		os.Remove(recovername)
 	}
 }
+
+// 斜树输入下的压缩和解压缩，编码长度会超过24位，需要长度受限的编码才能正确还原
+func TestCompressAndDecompress_Skewed(t *testing.T) {
+	freq := fibonacciFrequencies(36)
+	data := make([]byte, 0, 1<<16)
+	for b, cnt := range freq {
+		if cnt > 2000 {
+			cnt = 2000
+		}
+		for i := uint64(0); i < cnt; i++ {
+			data = append(data, b)
+		}
+	}
+	// 这里使用原始频数构建码表，保证Huffman树足够高
+	table := NewWideHuffmanEncTable(NewHuffmanTree(freq))
+	dense, bitLen, err := compressBytesWith(data, table)
+	require.Nil(t, err)
+
+	ser, err := table.Serialize()
+	require.Nil(t, err)
+	decTable, err := DeserializeWideHuffmanDecTable(ser)
+	require.Nil(t, err)
+
+	recovered, err := decompressBytesWith(dense, bitLen, decTable)
+	require.Nil(t, err)
+	require.Equal(t, data, recovered)
+}
+
+// 使用超过24位的宽编码压缩和解压缩
+func TestCompressAndDecompress_WideCode(t *testing.T) {
+	freq := fibonacciFrequencies(40)
+	table := NewWideHuffmanEncTable(NewHuffmanTree(freq, MaxWideHuffmanCodeBitLen))
+	require.Equal(t, 39, table.Get(0).BitLen())
+
+	data := make([]byte, 0, 1<<12)
+	for i := 0; i < 1<<12; i++ {
+		data = append(data, byte(i%40))
+	}
+	dense, bitLen, err := compressBytesWith(data, table)
+	require.Nil(t, err)
+
+	ser, err := table.Serialize()
+	require.Nil(t, err)
+	decTable, err := DeserializeWideHuffmanDecTable(ser)
+	require.Nil(t, err)
+
+	recovered, err := decompressBytesWith(dense, bitLen, decTable)
+	require.Nil(t, err)
+	require.Equal(t, data, recovered)
+}
+
+// compressFileV1 按照FileVersion1格式压缩data，用于测试旧格式文件的解压
+func compressFileV1(t *testing.T, data []byte, filename string) []byte {
+	encTable := NewCanonicalHuffmanEncTable(NewHuffmanTree(CountFrequencies(data)))
+	compressedBytes, bitLen, err := compressBytesWith(data, encTable)
+	require.Nil(t, err)
+	encTableSer, err := encTable.Serialize()
+	require.Nil(t, err)
+
+	dstBytes := writeUint16ToBytes(CompressedFileStartFlag, nil)
+	dstBytes = writeUint16ToBytes(uint16(len(filename)), dstBytes)
+	dstBytes = writeUint32ToBytes(uint32(len(data)), dstBytes)
+	dstBytes = writeUint32ToBytes(uint32(len(compressedBytes)), dstBytes)
+	dstBytes = append(dstBytes, []byte(filename)...)
+	dstBytes = writeUint32ToBytes(uint32(len(encTableSer)), dstBytes)
+	dstBytes = append(dstBytes, encTableSer...)
+	dstBytes = writeUint32ToBytes(uint32(len(compressedBytes)), dstBytes)
+	dstBytes = append(dstBytes, byte(bitLen%8))
+	dstBytes = append(dstBytes, compressedBytes...)
+	dstBytes = writeUint32ToBytes(crc32.Checksum(dstBytes, crc32q), dstBytes)
+	return writeUint16ToBytes(CompressedFileEndFlag, dstBytes)
+}
+
+func TestDecompressFile_Versions(t *testing.T) {
+	data, err := os.ReadFile(s1)
+	require.Nil(t, err)
+	dir := t.TempDir()
+	recovername := filepath.Join(dir, "recover.txt")
+
+	// 旧格式的文件仍然可以解压
+	v1name := filepath.Join(dir, "v1.huf")
+	require.Nil(t, os.WriteFile(v1name, compressFileV1(t, data, "test_data.txt"), 0644))
+	require.Nil(t, DecompressFile(v1name, recovername))
+	got, err := os.ReadFile(recovername)
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+
+	// 新格式的文件头记录64位的大小
+	v2name := filepath.Join(dir, "v2.huf")
+	require.Nil(t, CompressFile(s1, v2name))
+	compressed, err := os.ReadFile(v2name)
+	require.Nil(t, err)
+	require.Equal(t, FileVersion2, compressed[Uint16ByteSize])
+	originalSize, err := readNextUint64(compressed, Uint16ByteSize+1+Uint16ByteSize)
+	require.Nil(t, err)
+	require.EqualValues(t, len(data), originalSize)
+	compressedSize, err := readNextUint64(compressed, Uint16ByteSize+1+Uint16ByteSize+Uint64ByteSize)
+	require.Nil(t, err)
+	headerSize := Uint16ByteSize + 1 + Uint16ByteSize + 2*Uint64ByteSize + len("test_data.txt")
+	require.EqualValues(t, len(compressed)-headerSize-Uint32ByteSize-Uint16ByteSize, compressedSize)
+
+	require.Nil(t, DecompressFile(v2name, recovername))
+	got, err = os.ReadFile(recovername)
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+
+	// 并行压缩和解压
+	require.Nil(t, CompressFile(s1, v2name, WithBlockSize(1024), WithConcurrency(4)))
+	require.Nil(t, DecompressFile(v2name, recovername, WithReaderConcurrency(4)))
+	got, err = os.ReadFile(recovername)
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+	require.Nil(t, CompressFile(s1, v2name))
+
+	// 未知的版本
+	broken := append([]byte(nil), compressed...)
+	broken[Uint16ByteSize] = 0xFF
+	require.Nil(t, os.WriteFile(v2name, broken, 0644))
+	require.ErrorIs(t, DecompressFile(v2name, recovername), ErrUnsupportedVersion)
+
+	// 文件头被破坏
+	broken = append([]byte(nil), compressed...)
+	broken[headerSize-1] ^= 0xFF
+	require.Nil(t, os.WriteFile(v2name, broken, 0644))
+	require.ErrorIs(t, DecompressFile(v2name, recovername), ErrChecksumNotMatched)
+	_, err = os.Stat(recovername)
+	require.True(t, os.IsNotExist(err))
+
+	// 文件被截断
+	require.Nil(t, os.WriteFile(v2name, compressed[:len(compressed)/2], 0644))
+	require.ErrorIs(t, DecompressFile(v2name, recovername), io.ErrUnexpectedEOF)
+}
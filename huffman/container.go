@@ -0,0 +1,615 @@
+package huffman
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// 压缩流（v2容器）格式如下：（大端序）
+// STREAM HEADER
+//   - START_FLAG					4 bytes (uint32)
+//   - VERSION						1 byte
+//   - FLAGS						1 byte  StreamFlagSeekIndex表示流中带有索引
+//
+// BLOCK 1 ... BLOCK N
+//   - BLOCK TYPE					1 byte
+//   - RAW SIZE					4 bytes (uint32) 块压缩前的字节数
+//   - TABLE
+//     -- BlockTypeHuffman			SYMBOL NUM 2 bytes (uint16) + SYMBOL NUM * (BYTE + CODE LEN) 2 bytes
+//     -- BlockTypeHuffmanRef		TABLE INDEX 4 bytes (uint32)，引用流中第TABLE INDEX个码表
+//     -- BlockTypeStored			无
+//     -- BlockTypeAdaptive			无，编码器和解码器同步更新自适应Huffman树
+//     -- BlockTypeContext			CONTEXT TABLES，每个上下文的码表，格式见context.go
+//     -- BlockTypePreset			TABLE ID 8 bytes (uint64)，预置码表的ID，格式见preset.go
+//     -- BlockTypeLZ77				LZ77 TABLES，字面量/长度码表和距离码表，格式见lz77.go
+//   - VALID BIT LEN				8 bytes (uint64) BlockTypeStored没有该字段
+//   - DATA						BlockTypeStored为RAW SIZE字节的原始数据，否则为(VALID BIT LEN + 7) / 8字节的压缩数据
+//   - CRC32 CHECKSUM				4 bytes (uint32) 从BLOCK TYPE到DATA所有字节的校验和
+//
+// SEEK INDEX（FLAGS中有StreamFlagSeekIndex时存在，格式见seekindex.go）
+//   - BLOCK TYPE					1 byte  固定为BlockTypeIndex
+//   - INDEX SIZE					4 bytes (uint32)
+//   - INDEX DATA					INDEX SIZE bytes
+//   - CRC32 CHECKSUM				4 bytes (uint32) 从BLOCK TYPE到INDEX DATA所有字节的校验和
+//
+// STREAM TAIL
+//   - BLOCK TYPE					1 byte  固定为BlockTypeEnd
+//   - CRC32 CHECKSUM				4 bytes (uint32) 所有块压缩前数据的校验和
+//   - INDEX OFFSET				8 bytes (uint64) SEEK INDEX在流中的字节偏移，FLAGS中有StreamFlagSeekIndex时存在
+//   - END_FLAG					4 bytes (uint32)
+//
+// 每个块使用范式Huffman编码，码表只存储每个字节的编码长度；BlockTypeAdaptive类型的块使用自适应Huffman编码，不存储码表；
+// BlockTypeContext类型的块以前一个字节作为上下文，每个上下文使用各自的码表；BlockTypeLZ77类型的块先用LZ77替换重复的字符串。
+// 每个块都可以单独校验和解码，一个块损坏不会影响其它块
+const (
+	StreamStartFlag uint32 = 0x48465353 // "HFSS"
+	StreamEndFlag   uint32 = 0x48465345 // "HFSE"
+
+	ContainerVersion byte = 2
+
+	DefaultBlockSize = 1 << 20 // 每个块默认1MiB
+	MaxBlockSize     = 1 << 30 // 每个块最大1GiB
+
+	// 自适应Huffman编码中一个字节最多使用的比特数：NYT节点的编码加上8比特的原始字节
+	maxAdaptiveCodeBitLen = MaxSymbolNum + 8
+)
+
+// 块类型
+const (
+	BlockTypeEnd        byte = 0 // 流结束
+	BlockTypeStored     byte = 1 // 不压缩，直接存储原始数据
+	BlockTypeHuffman    byte = 2 // 使用块中自带的码表压缩
+	BlockTypeHuffmanRef byte = 3 // 使用之前的块中的码表压缩
+	BlockTypeIndex      byte = 4 // 索引，不包含数据
+	BlockTypeAdaptive   byte = 5 // 使用自适应Huffman编码压缩，不需要码表
+	BlockTypeContext    byte = 6 // 使用order-1上下文模型压缩，每个上下文有各自的码表
+	BlockTypePreset     byte = 7 // 使用调用方提供的预置码表压缩，只存储码表的ID
+	BlockTypeLZ77       byte = 8 // 使用LZ77查找重复的字符串，字面量、长度和距离使用各自的码表压缩
+)
+
+// 流头中的标志位
+const (
+	StreamFlagSeekIndex byte = 1 << 0 // 流中带有索引，可以随机访问
+)
+
+var (
+	ErrCorruptBlock       = fmt.Errorf("corrupt block")
+	ErrUnknownBlockType   = fmt.Errorf("unknown block type")
+	ErrUnsupportedVersion = fmt.Errorf("unsupported version")
+)
+
+// blockTable 是流中的一个码表
+type blockTable struct {
+	index   uint32
+	lengths []uint8
+	// 预置码表的ID和码表本身，预置码表不一定是范式Huffman编码，lengths只用于计算压缩后的大小
+	presetID uint64
+	preset   ByteEncTable
+	// 预置码表中转义码的长度，0表示没有转义码，这时数据中不能有码表中没有的字节
+	escapeLen int
+}
+
+// rawBlock 是从流中读出的一个还没有解码的块
+type rawBlock struct {
+	blockType  byte
+	rawSize    uint32
+	lengths    []uint8       // BlockTypeHuffman的码表
+	tableIndex uint32        // BlockTypeHuffmanRef引用的码表
+	context    *contextModel // BlockTypeContext的上下文码表
+	presetID   uint64        // BlockTypePreset使用的预置码表的ID
+	lz77       *lz77Model    // BlockTypeLZ77的字面量/长度码表和距离码表
+	bitLen     uint64
+	payload    []byte
+}
+
+// blockPlan 是分析一个块得到的统计信息，和流中之前的块无关，可以并行计算
+type blockPlan struct {
+	freq     Frequencies
+	newTable []uint8 // 根据该块的频数构建的编码长度
+}
+
+// planBlock 统计块中的频数并构建编码长度
+func planBlock(data []byte) *blockPlan {
+	freq := CountFrequencies(data)
+	return &blockPlan{freq: freq, newTable: byteCodeLengths(freq)}
+}
+
+// chooseBlock 在使用新码表、引用last、使用预置码表和直接存储几种方式中选择压缩后最小的一种
+// last为流中最近的一个码表，nextIndex为新码表的编号，preset为预置码表，没有时为nil
+// 返回块类型、块使用的码表和之后的块可以引用的最近的码表
+//
+// 选择只依赖于之前的块的选择结果，计算量很小，并行压缩时按照块的顺序依次选择，保证输出和串行压缩一致
+func chooseBlock(plan *blockPlan, size int, last *blockTable, nextIndex uint32, preset *blockTable) (byte, *blockTable, *blockTable) {
+	newTable := &blockTable{index: nextIndex, lengths: plan.newTable}
+
+	blockType := BlockTypeHuffman
+	table := newTable
+	cost := codeLengthsCost(plan.freq, newTable.lengths) + uint64(codeLengthsSerSize(newTable.lengths))*8
+	if last != nil {
+		refCost := codeLengthsCost(plan.freq, last.lengths)
+		if refCost != 0 && refCost+Uint32ByteSize*8 <= cost {
+			blockType = BlockTypeHuffmanRef
+			table = last
+			cost = refCost + Uint32ByteSize*8
+		}
+	}
+	if preset != nil {
+		presetCost := presetCodeCost(plan.freq, preset)
+		if presetCost != 0 && presetCost+Uint64ByteSize*8 <= cost {
+			blockType = BlockTypePreset
+			table = preset
+			cost = presetCost + Uint64ByteSize*8
+		}
+	}
+	if cost >= uint64(size)*8 {
+		blockType = BlockTypeStored
+	}
+
+	if blockType == BlockTypeHuffman {
+		return blockType, table, newTable
+	}
+	return blockType, table, last
+}
+
+// buildBlock 使用给定的块类型和码表压缩一个块，返回包含块头和校验和的完整块
+func buildBlock(data []byte, blockType byte, table *blockTable) ([]byte, error) {
+	block := make([]byte, 0, 1+Uint32ByteSize+len(data)+Uint32ByteSize)
+	block = append(block, blockType)
+	block = writeUint32ToBytes(uint32(len(data)), block)
+
+	switch blockType {
+	case BlockTypeStored:
+		block = append(block, data...)
+	default:
+		encTable := table.preset
+		switch blockType {
+		case BlockTypeHuffman:
+			block = appendCodeLengths(block, table.lengths)
+		case BlockTypeHuffmanRef:
+			block = writeUint32ToBytes(table.index, block)
+		case BlockTypePreset:
+			block = writeUint64ToBytes(table.presetID, block)
+		}
+		if encTable == nil {
+			var err error
+			if encTable, err = NewEncTableFromLengths(table.lengths); err != nil {
+				return nil, err
+			}
+		}
+		compressedBytes, bitLen, err := compressBytesWith(data, encTable)
+		if err != nil {
+			return nil, err
+		}
+		block = writeUint64ToBytes(bitLen, block)
+		block = append(block, compressedBytes...)
+	}
+
+	return writeUint32ToBytes(crc32.Checksum(block, crc32q), block), nil
+}
+
+// buildAdaptiveBlock 使用自适应Huffman编码压缩一个块，压缩后比原始数据大时直接存储
+func buildAdaptiveBlock(data []byte) ([]byte, error) {
+	compressedBytes, bitLen, err := CompressBytesAdaptive(data)
+	if err != nil {
+		return nil, err
+	}
+	if bitLen+Uint64ByteSize*8 >= uint64(len(data))*8 {
+		return buildBlock(data, BlockTypeStored, nil)
+	}
+
+	block := make([]byte, 0, 1+Uint32ByteSize+Uint64ByteSize+len(compressedBytes)+Uint32ByteSize)
+	block = append(block, BlockTypeAdaptive)
+	block = writeUint32ToBytes(uint32(len(data)), block)
+	block = writeUint64ToBytes(bitLen, block)
+	block = append(block, compressedBytes...)
+
+	return writeUint32ToBytes(crc32.Checksum(block, crc32q), block), nil
+}
+
+// buildContextBlock 使用order-1上下文模型压缩一个块，压缩后比原始数据大时直接存储
+func buildContextBlock(data []byte) ([]byte, error) {
+	m, bits := planContextModel(data)
+	if bits+Uint64ByteSize*8 >= uint64(len(data))*8 {
+		return buildBlock(data, BlockTypeStored, nil)
+	}
+	compressedBytes, bitLen, err := compressContext(data, m)
+	if err != nil {
+		return nil, err
+	}
+
+	block := make([]byte, 0, 1+Uint32ByteSize+Uint64ByteSize+len(compressedBytes)+Uint32ByteSize)
+	block = append(block, BlockTypeContext)
+	block = writeUint32ToBytes(uint32(len(data)), block)
+	block = appendContextModel(block, m)
+	block = writeUint64ToBytes(bitLen, block)
+	block = append(block, compressedBytes...)
+
+	return writeUint32ToBytes(crc32.Checksum(block, crc32q), block), nil
+}
+
+// buildModelBlock 使用不需要码表选择的块类型（BlockTypeAdaptive、BlockTypeContext或BlockTypeLZ77）压缩一个块
+func buildModelBlock(data []byte, blockType byte) ([]byte, error) {
+	switch blockType {
+	case BlockTypeContext:
+		return buildContextBlock(data)
+	case BlockTypeLZ77:
+		return buildLZ77Block(data)
+	}
+	return buildAdaptiveBlock(data)
+}
+
+// codeLengthsCost 计算使用给定编码长度压缩后的比特数
+// 如果有字节不在码表中，返回0
+func codeLengthsCost(freq Frequencies, lengths []uint8) uint64 {
+	var bits uint64 = 0
+	for k, v := range freq {
+		if lengths[k] == 0 {
+			return 0
+		}
+		bits += v * uint64(lengths[k])
+	}
+	return bits
+}
+
+// presetCodeCost 计算使用预置码表压缩后的比特数，码表中没有的字节使用转义码加上8比特的原始字节
+// 如果有字节不在码表中并且码表没有转义码，返回0
+func presetCodeCost(freq Frequencies, preset *blockTable) uint64 {
+	if preset.escapeLen == 0 {
+		return codeLengthsCost(freq, preset.lengths)
+	}
+	var bits uint64 = 0
+	for k, v := range freq {
+		l := uint64(preset.lengths[k])
+		if l == 0 {
+			l = uint64(preset.escapeLen) + 8
+		}
+		bits += v * l
+	}
+	return bits
+}
+
+// codeLengthsSerSize 返回编码长度序列化后的字节数
+func codeLengthsSerSize(lengths []uint8) int {
+	n := 0
+	for _, l := range lengths {
+		if l != 0 {
+			n++
+		}
+	}
+	return Uint16ByteSize + 2*n
+}
+
+// appendCodeLengths 将编码长度序列化后追加到buf中
+// SYMBOL NUM 2 bytes (uint16) + SYMBOL NUM * (BYTE + CODE LEN)
+func appendCodeLengths(buf []byte, lengths []uint8) []byte {
+	n := 0
+	for _, l := range lengths {
+		if l != 0 {
+			n++
+		}
+	}
+	buf = writeUint16ToBytes(uint16(n), buf)
+	for k, l := range lengths {
+		if l != 0 {
+			buf = append(buf, byte(k), l)
+		}
+	}
+	return buf
+}
+
+// blockReadChunkSize 是blockReader一次最多预先分配的字节数
+// 块头中的长度来自不可信的输入，更长的数据随着读入逐步扩容，被损坏的长度不会导致一次分配大量内存
+const blockReadChunkSize = 1 << 20
+
+// blockReader 从io.Reader中读入块，同时记录读入的字节用于计算校验和
+type blockReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (br *blockReader) read(n int) ([]byte, error) {
+	start := len(br.buf)
+	for len(br.buf)-start < n {
+		chunk := n - (len(br.buf) - start)
+		if chunk > blockReadChunkSize {
+			chunk = blockReadChunkSize
+		}
+		cur := len(br.buf)
+		br.buf = append(br.buf, make([]byte, chunk)...)
+		if _, err := io.ReadFull(br.r, br.buf[cur:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return br.buf[start:], err
+		}
+	}
+	return br.buf[start:], nil
+}
+
+func (br *blockReader) readUint16() (uint16, error) {
+	b, err := br.read(Uint16ByteSize)
+	if err != nil {
+		return 0, err
+	}
+	return readNextUint16(b, 0)
+}
+
+func (br *blockReader) readUint32() (uint32, error) {
+	b, err := br.read(Uint32ByteSize)
+	if err != nil {
+		return 0, err
+	}
+	return readNextUint32(b, 0)
+}
+
+func (br *blockReader) readUint64() (uint64, error) {
+	b, err := br.read(Uint64ByteSize)
+	if err != nil {
+		return 0, err
+	}
+	return readNextUint64(b, 0)
+}
+
+// readStreamHeader 读入并检查流头，返回流头中的标志位
+func readStreamHeader(r io.Reader) (byte, error) {
+	br := &blockReader{r: r}
+	flag, err := br.readUint32()
+	if err != nil {
+		return 0, err
+	}
+	if flag != StreamStartFlag {
+		return 0, ErrInvalidStartFlag
+	}
+	header, err := br.read(2)
+	if err != nil {
+		return 0, err
+	}
+	if header[0] != ContainerVersion {
+		return 0, fmt.Errorf("%w: container version %d", ErrUnsupportedVersion, header[0])
+	}
+
+	return header[1], nil
+}
+
+// appendStreamHeader 将流头追加到buf中
+func appendStreamHeader(buf []byte, flags byte) []byte {
+	buf = writeUint32ToBytes(StreamStartFlag, buf)
+	return append(buf, ContainerVersion, flags)
+}
+
+// readBlock 从r中读入一个块
+// 遇到流尾时返回BlockTypeEnd类型的块；块的校验和不匹配时同时返回块和错误，调用方可以选择跳过该块
+func readBlock(r io.Reader) (*rawBlock, error) {
+	br := &blockReader{r: r}
+	b, err := br.read(1)
+	if err != nil {
+		return nil, err
+	}
+	blk := &rawBlock{blockType: b[0]}
+	if blk.blockType == BlockTypeEnd {
+		return blk, nil
+	}
+
+	if blk.rawSize, err = br.readUint32(); err != nil {
+		return nil, err
+	}
+	if blk.rawSize == 0 || blk.rawSize > MaxBlockSize {
+		return nil, ErrCorruptBlock
+	}
+
+	payloadSize := uint64(blk.rawSize)
+	switch blk.blockType {
+	case BlockTypeStored, BlockTypeIndex:
+	case BlockTypeHuffman, BlockTypeHuffmanRef, BlockTypePreset:
+		maxBitLen := uint64(MaxWideHuffmanCodeBitLen)
+		switch blk.blockType {
+		case BlockTypeHuffman:
+			blk.lengths, err = readCodeLengths(br)
+		case BlockTypeHuffmanRef:
+			blk.tableIndex, err = br.readUint32()
+		case BlockTypePreset:
+			// 预置码表可能带有转义码
+			blk.presetID, err = br.readUint64()
+			maxBitLen = maxEscapedBitLen
+		}
+		if err != nil {
+			return nil, err
+		}
+		if blk.bitLen, err = br.readUint64(); err != nil {
+			return nil, err
+		}
+		if blk.bitLen > uint64(blk.rawSize)*maxBitLen {
+			return nil, ErrCorruptBlock
+		}
+		payloadSize = (blk.bitLen + 7) / 8
+	case BlockTypeAdaptive, BlockTypeContext, BlockTypeLZ77:
+		maxBitLen := uint64(maxAdaptiveCodeBitLen)
+		switch blk.blockType {
+		case BlockTypeContext:
+			if blk.context, err = readContextModel(br); err != nil {
+				return nil, err
+			}
+			maxBitLen = contextMaxBitLen
+		case BlockTypeLZ77:
+			if blk.lz77, err = readLZ77Model(br); err != nil {
+				return nil, err
+			}
+			maxBitLen = lz77MaxBitsPerByte
+		}
+		if blk.bitLen, err = br.readUint64(); err != nil {
+			return nil, err
+		}
+		if blk.bitLen > uint64(blk.rawSize)*maxBitLen {
+			return nil, ErrCorruptBlock
+		}
+		payloadSize = (blk.bitLen + 7) / 8
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownBlockType, blk.blockType)
+	}
+
+	payload, err := br.read(int(payloadSize))
+	if err != nil {
+		return nil, err
+	}
+	calChecksum := crc32.Checksum(br.buf, crc32q)
+	blk.payload = payload
+
+	// 校验和本身不计入校验和，使用新的blockReader读入
+	expectedChecksum, err := (&blockReader{r: r}).readUint32()
+	if err != nil {
+		return nil, err
+	}
+	if expectedChecksum != calChecksum {
+		return blk, ErrChecksumNotMatched
+	}
+
+	return blk, nil
+}
+
+// readCodeLengths 读入序列化后的编码长度
+func readCodeLengths(br *blockReader) ([]uint8, error) {
+	n, err := br.readUint16()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 || n > MaxSymbolNum {
+		return nil, ErrCorruptBlock
+	}
+	items, err := br.read(2 * int(n))
+	if err != nil {
+		return nil, err
+	}
+	lengths := make([]uint8, MaxSymbolNum)
+	for i := 0; i < int(n); i++ {
+		lengths[items[2*i]] = items[2*i+1]
+	}
+	return lengths, nil
+}
+
+// readStreamTail 读入流尾（BLOCK TYPE之后的部分），检查所有数据的校验和
+func readStreamTail(r io.Reader, flags byte, checksum uint32) error {
+	br := &blockReader{r: r}
+	expectedChecksum, err := br.readUint32()
+	if err != nil {
+		return err
+	}
+	if expectedChecksum != checksum {
+		return ErrChecksumNotMatched
+	}
+	if flags&StreamFlagSeekIndex != 0 {
+		if _, err := br.readUint64(); err != nil {
+			return err
+		}
+	}
+	flag, err := br.readUint32()
+	if err != nil {
+		return err
+	}
+	if flag != StreamEndFlag {
+		return ErrInvalidEndFlag
+	}
+	return nil
+}
+
+// appendStreamTail 将流尾追加到buf中，indexOffset只在flags中有StreamFlagSeekIndex时写入
+func appendStreamTail(buf []byte, flags byte, checksum uint32, indexOffset uint64) []byte {
+	buf = append(buf, BlockTypeEnd)
+	buf = writeUint32ToBytes(checksum, buf)
+	if flags&StreamFlagSeekIndex != 0 {
+		buf = writeUint64ToBytes(indexOffset, buf)
+	}
+	return writeUint32ToBytes(StreamEndFlag, buf)
+}
+
+// decodeBlock 使用decoder解码一个BlockTypeHuffman或BlockTypeHuffmanRef类型的块
+// 块中的比特位应该刚好解码出RAW SIZE个字节
+func decodeBlock(blk *rawBlock, decoder *HuffmanDecoder) ([]byte, error) {
+	data := make([]byte, blk.rawSize)
+	var pos uint64 = 0
+	for i := range data {
+		b, n, err := decoder.decodeSymbol(blk.payload, pos, blk.bitLen)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+		}
+		data[i] = b
+		pos += n
+	}
+	if pos != blk.bitLen {
+		return nil, ErrCorruptBlock
+	}
+
+	return data, nil
+}
+
+// decodeAdaptiveBlock 解码一个BlockTypeAdaptive类型的块
+// 块中的比特位应该刚好解码出RAW SIZE个字节
+func decodeAdaptiveBlock(blk *rawBlock) ([]byte, error) {
+	data := make([]byte, blk.rawSize)
+	tree := NewAdaptiveHuffmanTree()
+	var pos uint64 = 0
+	for i := range data {
+		b, n, err := tree.Decode(blk.payload, pos, blk.bitLen)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+		}
+		data[i] = b
+		pos += n
+	}
+	if pos != blk.bitLen {
+		return nil, ErrCorruptBlock
+	}
+
+	return data, nil
+}
+
+// isModelBlock 判断块是否只能从块的开头顺序解码，这样的块不使用流中的码表，解码时一次解码整个块
+func isModelBlock(blockType byte) bool {
+	return blockType == BlockTypeAdaptive || blockType == BlockTypeContext || blockType == BlockTypeLZ77
+}
+
+// decodeModelBlock 解码一个BlockTypeAdaptive、BlockTypeContext或BlockTypeLZ77类型的块
+func decodeModelBlock(blk *rawBlock) ([]byte, error) {
+	switch blk.blockType {
+	case BlockTypeContext:
+		return decodeContextBlock(blk)
+	case BlockTypeLZ77:
+		return decodeLZ77Block(blk)
+	}
+	return decodeAdaptiveBlock(blk)
+}
+
+// blockTables 记录流中出现过的所有码表，并缓存最近使用的解码器
+type blockTables struct {
+	lengths [][]uint8
+	decoder *HuffmanDecoder
+	current int
+}
+
+// add 记录一个新的码表
+func (t *blockTables) add(lengths []uint8) {
+	t.lengths = append(t.lengths, lengths)
+}
+
+// decoderFor 返回块所使用的码表的解码器，BlockTypeHuffman的码表需要先通过add记录
+func (t *blockTables) decoderFor(blk *rawBlock) (*HuffmanDecoder, error) {
+	index := len(t.lengths) - 1
+	if blk.blockType == BlockTypeHuffmanRef {
+		index = int(blk.tableIndex)
+	}
+	if index < 0 || index >= len(t.lengths) {
+		return nil, fmt.Errorf("%w: table %d not found", ErrCorruptBlock, index)
+	}
+	if t.decoder != nil && t.current == index {
+		return t.decoder, nil
+	}
+
+	decoder, err := NewHuffmanDecoderFromLengths(t.lengths[index])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+	}
+	t.decoder = decoder
+	t.current = index
+
+	return decoder, nil
+}
@@ -0,0 +1,155 @@
+package huffman
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// blockTypes 返回流中每个块的类型和块结束的位置
+func blockTypes(t *testing.T, stream []byte) ([]byte, []int) {
+	r := bytes.NewReader(stream)
+	_, err := readStreamHeader(r)
+	require.Nil(t, err)
+
+	var types []byte
+	var ends []int
+	for {
+		blk, err := readBlock(r)
+		require.Nil(t, err)
+		if blk.blockType == BlockTypeEnd {
+			break
+		}
+		if blk.blockType == BlockTypeIndex {
+			continue
+		}
+		types = append(types, blk.blockType)
+		ends = append(ends, len(stream)-r.Len())
+	}
+
+	return types, ends
+}
+
+func TestContainer_BlockTypes(t *testing.T) {
+	// 随机数据无法压缩，直接存储
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+	stream := compressStream(t, random, WithBlockSize(1024))
+	types, _ := blockTypes(t, stream)
+	require.Equal(t, []byte{BlockTypeStored, BlockTypeStored, BlockTypeStored, BlockTypeStored}, types)
+
+	// 相同分布的块复用第一个块的码表
+	text := bytes.Repeat([]byte("abcdefghijklmnop"), 256)
+	stream = compressStream(t, text, WithBlockSize(1024))
+	types, _ = blockTypes(t, stream)
+	require.Equal(t, []byte{BlockTypeHuffman, BlockTypeHuffmanRef, BlockTypeHuffmanRef, BlockTypeHuffmanRef}, types)
+	data, _ := parseStream(t, stream)
+	require.Equal(t, text, data)
+
+	// 分布变化时使用新的码表，之后的块引用最近的码表
+	mixed := append(append([]byte(nil), text[:2048]...), bytes.Repeat([]byte("xyz"), 700)...)
+	stream = compressStream(t, mixed, WithBlockSize(1024))
+	types, _ = blockTypes(t, stream)
+	require.Equal(t, BlockTypeHuffman, types[2])
+	require.Equal(t, BlockTypeHuffmanRef, types[3])
+	data, _ = parseStream(t, stream)
+	require.Equal(t, mixed, data)
+}
+
+func TestContainer_SkipCorruptBlocks(t *testing.T) {
+	text := bytes.Repeat([]byte("go-huffman block container "), 200)
+	stream := compressStream(t, text, WithBlockSize(1000))
+	_, ends := blockTypes(t, stream)
+
+	// 破坏第二个块的数据
+	broken := append([]byte(nil), stream...)
+	broken[ends[1]-Uint32ByteSize-1] ^= 0xFF
+
+	r, err := NewReader(bytes.NewReader(broken))
+	require.Nil(t, err)
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, ErrChecksumNotMatched)
+
+	r, err = NewReader(bytes.NewReader(broken), WithSkipCorruptBlocks())
+	require.Nil(t, err)
+	got, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, []int{1}, r.CorruptBlocks())
+
+	expected := append([]byte(nil), text...)
+	copy(expected[1000:2000], make([]byte, 1000))
+	require.Equal(t, expected, got)
+
+	// 没有损坏的块
+	r, err = NewReader(bytes.NewReader(stream), WithSkipCorruptBlocks())
+	require.Nil(t, err)
+	got, err = io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, text, got)
+	require.Empty(t, r.CorruptBlocks())
+}
+
+// 块头中的长度被损坏时，只按照实际读入的数据分配内存
+func TestContainer_CorruptBlockHeader(t *testing.T) {
+	block := []byte{BlockTypeHuffmanRef}
+	block = writeUint32ToBytes(MaxBlockSize, block)
+	block = writeUint32ToBytes(0, block)
+	block = writeUint64ToBytes(uint64(MaxBlockSize)*MaxWideHuffmanCodeBitLen, block)
+	block = append(block, bytes.Repeat([]byte{0xA5}, 100)...)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := readBlock(bytes.NewReader(block))
+	runtime.ReadMemStats(&after)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(8*blockReadChunkSize))
+
+	stored := []byte{BlockTypeStored}
+	stored = writeUint32ToBytes(MaxBlockSize, stored)
+	stored = append(stored, 1, 2, 3)
+	_, err = readBlock(bytes.NewReader(stored))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	broken := appendStreamHeader(nil, 0)
+	broken = append(broken, block...)
+	r, err := NewReader(bytes.NewReader(broken))
+	require.Nil(t, err)
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestContainer_Invalid(t *testing.T) {
+	stream := compressStream(t, []byte("hello huffman"))
+
+	broken := append([]byte(nil), stream...)
+	broken[Uint32ByteSize] = ContainerVersion + 1
+	_, err := NewReader(bytes.NewReader(broken))
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	broken = append([]byte(nil), stream...)
+	broken[Uint32ByteSize+2] = 0xFF
+	r, err := NewReader(bytes.NewReader(broken))
+	require.Nil(t, err)
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, ErrUnknownBlockType)
+
+	// 引用不存在的码表
+	block := []byte{BlockTypeHuffmanRef}
+	block = writeUint32ToBytes(1, block)
+	block = writeUint32ToBytes(7, block)
+	block = writeUint64ToBytes(8, block)
+	block = append(block, 0)
+	block = writeUint32ToBytes(crc32.Checksum(block, crc32q), block)
+	broken = appendStreamHeader(nil, 0)
+	broken = append(broken, block...)
+	broken = appendStreamTail(broken, 0, 0, 0)
+	r, err = NewReader(bytes.NewReader(broken))
+	require.Nil(t, err)
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, ErrCorruptBlock)
+}
@@ -0,0 +1,340 @@
+package huffman
+
+import "fmt"
+
+// order-1上下文模型：以前一个字节作为上下文，每个上下文使用单独的Huffman码表，
+// 出现次数少、单独存储码表不划算的上下文共用一个fallback码表。块的第一个字节的上下文为0
+//
+// 上下文码表（CONTEXT TABLES）格式如下：
+//   - CONTEXT NUM					2 bytes (uint16) 有单独码表的上下文数量
+//   - CONTEXT 1 ... CONTEXT N
+//     -- CONTEXT BYTE				1 byte
+//     -- PACKED LENGTHS
+//   - HAS FALLBACK				1 byte  为1时后面是fallback码表
+//   - PACKED LENGTHS				fallback码表
+//
+// PACKED LENGTHS为紧凑存储的编码长度：
+//   - SYMBOL NUM - 1				1 byte
+//   - SYMBOL NUM * BYTE			按字节从小到大排列
+//   - CODE LEN					每个4比特，高4位在前，一共(SYMBOL NUM + 1) / 2 bytes
+const (
+	// contextMaxBitLen 是上下文码表的最大编码长度，编码长度可以用4比特存储
+	contextMaxBitLen = 15
+)
+
+// contextModel 是一个块的order-1上下文模型
+type contextModel struct {
+	tables   [MaxSymbolNum][]uint8 // 每个上下文的编码长度，为nil时使用fallback
+	fallback []uint8               // 没有上下文使用fallback时为nil
+}
+
+// contextCounts 是每个上下文中每个字节的频数
+type contextCounts [MaxSymbolNum][MaxSymbolNum]uint64
+
+// countContexts 统计data中每个上下文之后每个字节的频数
+func countContexts(data []byte) *contextCounts {
+	counts := new(contextCounts)
+	var prev byte = 0
+	for _, b := range data {
+		counts[prev][b]++
+		prev = b
+	}
+
+	return counts
+}
+
+// planContextModel 根据二维频数构建上下文模型，返回模型和压缩后的比特数（包括码表）
+// 单独的码表加上存储码表的开销比使用共用码表更小时，上下文才使用单独的码表
+func planContextModel(data []byte) (*contextModel, uint64) {
+	counts := countContexts(data)
+	var total [MaxSymbolNum]uint64
+	for ctx := range counts {
+		for b, cnt := range counts[ctx] {
+			total[b] += cnt
+		}
+	}
+	shared := contextCodeLengths(&total)
+
+	m := &contextModel{}
+	var rare [MaxSymbolNum]uint64
+	hasRare := false
+	var bits uint64 = (Uint16ByteSize + 1) * 8
+	for ctx := range counts {
+		freq := &counts[ctx]
+		if isZeroCounts(freq) {
+			continue
+		}
+		own := contextCodeLengths(freq)
+		ownCost := countsCost(freq, own) + uint64(1+packedLengthsSize(own))*8
+		if ownCost < countsCost(freq, shared) {
+			m.tables[ctx] = own
+			bits += ownCost
+			continue
+		}
+		for b, cnt := range freq {
+			rare[b] += cnt
+		}
+		hasRare = true
+	}
+	if hasRare {
+		m.fallback = contextCodeLengths(&rare)
+		bits += countsCost(&rare, m.fallback) + uint64(packedLengthsSize(m.fallback))*8
+	}
+
+	return m, bits
+}
+
+// contextCodeLengths 构建不超过contextMaxBitLen的编码长度
+func contextCodeLengths(counts *[MaxSymbolNum]uint64) []uint8 {
+	freq := make(Frequencies)
+	for b, cnt := range counts {
+		if cnt != 0 {
+			freq[byte(b)] = cnt
+		}
+	}
+
+	return byteCodeLengths(freq, contextMaxBitLen)
+}
+
+// isZeroCounts 判断频数是否全为0
+func isZeroCounts(counts *[MaxSymbolNum]uint64) bool {
+	for _, cnt := range counts {
+		if cnt != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// countsCost 计算使用给定编码长度压缩后的比特数
+func countsCost(counts *[MaxSymbolNum]uint64, lengths []uint8) uint64 {
+	var bits uint64 = 0
+	for b, cnt := range counts {
+		bits += cnt * uint64(lengths[b])
+	}
+	return bits
+}
+
+// packedLengthsSize 返回编码长度紧凑存储后的字节数
+func packedLengthsSize(lengths []uint8) int {
+	n := 0
+	for _, l := range lengths {
+		if l != 0 {
+			n++
+		}
+	}
+	return 1 + n + (n+1)/2
+}
+
+// appendPackedLengths 将编码长度紧凑存储后追加到buf中
+func appendPackedLengths(buf []byte, lengths []uint8) []byte {
+	var symbols []byte
+	for b, l := range lengths {
+		if l != 0 {
+			symbols = append(symbols, byte(b))
+		}
+	}
+	buf = append(buf, byte(len(symbols)-1))
+	buf = append(buf, symbols...)
+	for i := 0; i < len(symbols); i += 2 {
+		packed := lengths[symbols[i]] << 4
+		if i+1 < len(symbols) {
+			packed |= lengths[symbols[i+1]]
+		}
+		buf = append(buf, packed)
+	}
+	return buf
+}
+
+// readPackedLengths 读入紧凑存储的编码长度
+func readPackedLengths(br *blockReader) ([]uint8, error) {
+	header, err := br.read(1)
+	if err != nil {
+		return nil, err
+	}
+	n := int(header[0]) + 1
+	items, err := br.read(n + (n+1)/2)
+	if err != nil {
+		return nil, err
+	}
+	symbols, packed := items[:n], items[n:]
+
+	lengths := make([]uint8, MaxSymbolNum)
+	for i, b := range symbols {
+		if i > 0 && b <= symbols[i-1] {
+			return nil, ErrCorruptBlock
+		}
+		l := packed[i/2] >> 4
+		if i%2 == 1 {
+			l = packed[i/2] & 0x0F
+		}
+		if l == 0 {
+			return nil, ErrCorruptBlock
+		}
+		lengths[b] = l
+	}
+	return lengths, nil
+}
+
+// appendContextModel 将上下文码表序列化后追加到buf中
+func appendContextModel(buf []byte, m *contextModel) []byte {
+	n := 0
+	for _, lengths := range m.tables {
+		if lengths != nil {
+			n++
+		}
+	}
+	buf = writeUint16ToBytes(uint16(n), buf)
+	for ctx, lengths := range m.tables {
+		if lengths != nil {
+			buf = append(buf, byte(ctx))
+			buf = appendPackedLengths(buf, lengths)
+		}
+	}
+	if m.fallback == nil {
+		return append(buf, 0)
+	}
+	buf = append(buf, 1)
+	return appendPackedLengths(buf, m.fallback)
+}
+
+// readContextModel 读入上下文码表
+func readContextModel(br *blockReader) (*contextModel, error) {
+	n, err := br.readUint16()
+	if err != nil {
+		return nil, err
+	}
+	if n > MaxSymbolNum {
+		return nil, ErrCorruptBlock
+	}
+
+	m := &contextModel{}
+	for i := 0; i < int(n); i++ {
+		ctx, err := br.read(1)
+		if err != nil {
+			return nil, err
+		}
+		if m.tables[ctx[0]] != nil {
+			return nil, ErrCorruptBlock
+		}
+		if m.tables[ctx[0]], err = readPackedLengths(br); err != nil {
+			return nil, err
+		}
+	}
+
+	hasFallback, err := br.read(1)
+	if err != nil {
+		return nil, err
+	}
+	switch hasFallback[0] {
+	case 0:
+	case 1:
+		if m.fallback, err = readPackedLengths(br); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrCorruptBlock
+	}
+
+	return m, nil
+}
+
+// contextCodes 是展开成以字节为下标的数组的码表，避免在循环中查map
+type contextCodes struct {
+	values  [MaxSymbolNum]uint64
+	bitLens [MaxSymbolNum]uint
+}
+
+func newContextCodes(lengths []uint8) (*contextCodes, error) {
+	table, err := NewEncTableFromLengths(lengths)
+	if err != nil {
+		return nil, err
+	}
+	c := &contextCodes{}
+	for k, code := range table {
+		c.values[k] = code.Value()
+		c.bitLens[k] = uint(code.BitLen())
+	}
+	return c, nil
+}
+
+// compressContext 使用上下文模型压缩data，返回压缩后的字节切片和有效比特数
+func compressContext(data []byte, m *contextModel) ([]byte, uint64, error) {
+	var fallback *contextCodes
+	if m.fallback != nil {
+		var err error
+		if fallback, err = newContextCodes(m.fallback); err != nil {
+			return nil, 0, err
+		}
+	}
+	var codes [MaxSymbolNum]*contextCodes
+	for ctx, lengths := range m.tables {
+		codes[ctx] = fallback
+		if lengths != nil {
+			c, err := newContextCodes(lengths)
+			if err != nil {
+				return nil, 0, err
+			}
+			codes[ctx] = c
+		}
+	}
+
+	w := NewBitsWriter()
+	var prev byte = 0
+	for i, b := range data {
+		c := codes[prev]
+		if c == nil || c.bitLens[b] == 0 {
+			return nil, 0, fmt.Errorf("code for %b(%c at %d) not found in context %d", b, b, i, prev)
+		}
+		w.writeBits(c.values[b], c.bitLens[b])
+		prev = b
+	}
+
+	return w.Buf(), w.BitLen(), nil
+}
+
+// decodeContextBlock 解码一个BlockTypeContext类型的块
+// 块中的比特位应该刚好解码出RAW SIZE个字节
+func decodeContextBlock(blk *rawBlock) ([]byte, error) {
+	m := blk.context
+	var fallback *HuffmanDecoder
+	if m.fallback != nil {
+		var err error
+		if fallback, err = NewHuffmanDecoderFromLengths(m.fallback); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+		}
+	}
+	var decoders [MaxSymbolNum]*HuffmanDecoder
+	for ctx, lengths := range m.tables {
+		decoders[ctx] = fallback
+		if lengths != nil {
+			d, err := NewHuffmanDecoderFromLengths(lengths)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+			}
+			decoders[ctx] = d
+		}
+	}
+
+	data := make([]byte, blk.rawSize)
+	var pos uint64 = 0
+	var prev byte = 0
+	for i := range data {
+		d := decoders[prev]
+		if d == nil {
+			return nil, fmt.Errorf("%w: table for context %d not found", ErrCorruptBlock, prev)
+		}
+		b, n, err := d.decodeSymbol(blk.payload, pos, blk.bitLen)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+		}
+		data[i] = b
+		pos += n
+		prev = b
+	}
+	if pos != blk.bitLen {
+		return nil, ErrCorruptBlock
+	}
+
+	return data, nil
+}
@@ -0,0 +1,127 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackedLengths(t *testing.T) {
+	lengths := make([]uint8, MaxSymbolNum)
+	lengths['a'] = 1
+	lengths['b'] = 2
+	lengths['c'] = 3
+	lengths['z'] = 3
+	buf := appendPackedLengths(nil, lengths)
+	require.Len(t, buf, packedLengthsSize(lengths))
+	require.Equal(t, []byte{3, 'a', 'b', 'c', 'z', 0x12, 0x33}, buf)
+
+	got, err := readPackedLengths(&blockReader{r: bytes.NewReader(buf)})
+	require.Nil(t, err)
+	require.Equal(t, lengths, got)
+
+	// 奇数个字节
+	lengths['z'] = 0
+	lengths['c'] = 2
+	buf = appendPackedLengths(nil, lengths)
+	require.Equal(t, []byte{2, 'a', 'b', 'c', 0x12, 0x20}, buf)
+	got, err = readPackedLengths(&blockReader{r: bytes.NewReader(buf)})
+	require.Nil(t, err)
+	require.Equal(t, lengths, got)
+
+	// 字节没有按顺序排列，编码长度为0
+	_, err = readPackedLengths(&blockReader{r: bytes.NewReader([]byte{1, 'b', 'a', 0x11})})
+	require.ErrorIs(t, err, ErrCorruptBlock)
+	_, err = readPackedLengths(&blockReader{r: bytes.NewReader([]byte{1, 'a', 'b', 0x10})})
+	require.ErrorIs(t, err, ErrCorruptBlock)
+}
+
+func TestContextModel(t *testing.T) {
+	data, err := os.ReadFile(s1)
+	require.Nil(t, err)
+
+	m, bits := planContextModel(data)
+	require.NotNil(t, m.fallback)
+	ctxNum := 0
+	for _, lengths := range m.tables {
+		if lengths != nil {
+			ctxNum++
+			for _, l := range lengths {
+				require.LessOrEqual(t, l, uint8(contextMaxBitLen))
+			}
+		}
+	}
+	require.Greater(t, ctxNum, 0)
+
+	compressed, bitLen, err := compressContext(data, m)
+	require.Nil(t, err)
+	ser := appendContextModel(nil, m)
+	require.Equal(t, bits, bitLen+uint64(len(ser))*8)
+
+	got, err := readContextModel(&blockReader{r: bytes.NewReader(ser)})
+	require.Nil(t, err)
+	require.Equal(t, m, got)
+
+	recovered, err := decodeContextBlock(&rawBlock{
+		blockType: BlockTypeContext,
+		rawSize:   uint32(len(data)),
+		context:   got,
+		bitLen:    bitLen,
+		payload:   compressed,
+	})
+	require.Nil(t, err)
+	require.Equal(t, data, recovered)
+
+	// 只有一个字节时所有上下文都使用fallback
+	m, _ = planContextModel([]byte("x"))
+	require.Equal(t, [MaxSymbolNum][]uint8{}, m.tables)
+	require.NotNil(t, m.fallback)
+}
+
+// 文本数据使用上下文模型的压缩率比order-0更高
+func TestWriter_ContextModeling(t *testing.T) {
+	data, err := os.ReadFile(s1)
+	require.Nil(t, err)
+
+	order0 := compressStream(t, data)
+	stream := compressStream(t, data, WithContextModeling())
+	require.Less(t, len(stream), len(order0))
+	types, _ := blockTypes(t, stream)
+	require.Equal(t, []byte{BlockTypeContext}, types)
+
+	got, _ := parseStream(t, stream)
+	require.Equal(t, data, got)
+
+	for _, concurrency := range []int{1, 4} {
+		r, err := NewReader(bytes.NewReader(stream), WithReaderConcurrency(concurrency))
+		require.Nil(t, err)
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, r)
+		require.Nil(t, err)
+		require.Equal(t, data, buf.Bytes())
+	}
+
+	// 多个块并行压缩，结果和串行压缩一致，并且可以随机访问
+	mixed := mixedData(1 << 18)
+	stream = compressStream(t, mixed, WithBlockSize(1<<15), WithContextModeling(), WithSeekIndex(0))
+	require.Equal(t, stream, compressStream(t, mixed, WithBlockSize(1<<15), WithContextModeling(), WithSeekIndex(0), WithConcurrency(4)))
+	sr, err := OpenSeekable(bytes.NewReader(stream))
+	require.Nil(t, err)
+	buf := make([]byte, 50000)
+	n, err := sr.ReadAt(buf, 100000)
+	require.Nil(t, err)
+	require.Equal(t, mixed[100000:150000], buf[:n])
+
+	// 块损坏时可以跳过
+	corrupt := append([]byte(nil), stream...)
+	corrupt[len(appendStreamHeader(nil, 0))+100] ^= 0xFF
+	r, err := NewReader(bytes.NewReader(corrupt), WithSkipCorruptBlocks())
+	require.Nil(t, err)
+	got, err = io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, []int{0}, r.CorruptBlocks())
+	require.Equal(t, mixed[1<<15:], got[1<<15:])
+}
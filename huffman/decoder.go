@@ -0,0 +1,234 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+const (
+	// 每一级查找表最多使用的比特数
+	decoderTableBits = 10
+)
+
+var (
+	ErrCodeNotPrefixFree = fmt.Errorf("codes are not prefix free")
+)
+
+// decoderEntry 是查找表中的一项
+// next < 0 时表示叶子，bitLen为这一级查找表中该编码实际占用的比特数；
+// next >= 0 时表示需要继续查下一级查找表，next为下一级查找表的下标
+// symbol为符号序号，字节解码器中就是字节本身
+type decoderEntry struct {
+	valid  bool
+	symbol uint32
+	bitLen uint8
+	next   int32
+}
+
+// decoderTable 是一级查找表，以接下来的bits个比特为下标
+type decoderTable struct {
+	bits    uint8
+	entries []decoderEntry
+}
+
+// HuffmanDecoder 是编译好的查表解码器
+// 每次预读接下来的若干比特直接查表得到字节，超过一级查找表比特数的长编码继续查下一级查找表
+type HuffmanDecoder struct {
+	tables []decoderTable
+}
+
+// decoderCode 是构建查找表时使用的一个编码
+type decoderCode struct {
+	code   uint64
+	bitLen int
+	symbol uint32
+}
+
+// NewHuffmanDecoder 根据解码表构建查表解码器
+func NewHuffmanDecoder(table ByteDecTable) (*HuffmanDecoder, error) {
+	codes, err := decoderCodes(table, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return newHuffmanDecoder(codes)
+}
+
+// decoderCodes 把解码表中的编码转换成构建查找表使用的编码，extra为额外预留的容量
+func decoderCodes(table ByteDecTable, extra int) ([]decoderCode, error) {
+	codes := make([]decoderCode, 0, table.ItemNum()+extra)
+	prefixFree := true
+	table.Range(func(code HuffmanCodeInterface, b byte) {
+		if code.BitLen() == 0 {
+			prefixFree = false
+		}
+		codes = append(codes, decoderCode{code: code.Value(), bitLen: code.BitLen(), symbol: uint32(b)})
+	})
+	if !prefixFree {
+		return nil, ErrCodeNotPrefixFree
+	}
+
+	return codes, nil
+}
+
+// NewHuffmanDecoderFromLengths 根据每个字节的编码长度构建范式Huffman编码的查表解码器
+func NewHuffmanDecoderFromLengths(lengths []uint8) (*HuffmanDecoder, error) {
+	table, err := NewDecTableFromLengths(lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewHuffmanDecoder(table)
+}
+
+func newHuffmanDecoder(codes []decoderCode) (*HuffmanDecoder, error) {
+	// 排序保证相同的码表总是得到相同的查找表
+	sort.Slice(codes, func(i, j int) bool {
+		if codes[i].bitLen != codes[j].bitLen {
+			return codes[i].bitLen < codes[j].bitLen
+		}
+		return codes[i].code < codes[j].code
+	})
+
+	d := &HuffmanDecoder{}
+	if _, err := d.build(codes, 0); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// build 为已经消耗了depth个比特的编码构建一级查找表，返回查找表的下标
+func (d *HuffmanDecoder) build(codes []decoderCode, depth int) (int32, error) {
+	maxBitLen := depth
+	for _, c := range codes {
+		if c.bitLen > maxBitLen {
+			maxBitLen = c.bitLen
+		}
+	}
+	bits := maxBitLen - depth
+	if bits > decoderTableBits {
+		bits = decoderTableBits
+	}
+
+	idx := int32(len(d.tables))
+	d.tables = append(d.tables, decoderTable{
+		bits:    uint8(bits),
+		entries: make([]decoderEntry, 1<<bits),
+	})
+	entries := d.tables[idx].entries
+
+	// 按照这一级查找表的下标分组，需要下一级查找表的长编码放在一起处理
+	groups := make(map[int][]decoderCode)
+	var groupKeys []int
+	for _, c := range codes {
+		remain := c.bitLen - depth
+		rest := c.code & (1<<remain - 1)
+		if remain <= bits {
+			// 短编码占满下标中以它为前缀的所有项
+			base := int(rest << (bits - remain))
+			for i := base; i < base+1<<(bits-remain); i++ {
+				if entries[i].valid {
+					return 0, ErrCodeNotPrefixFree
+				}
+				entries[i] = decoderEntry{valid: true, symbol: c.symbol, bitLen: uint8(remain), next: -1}
+			}
+			continue
+		}
+
+		key := int(rest >> (remain - bits))
+		if _, ok := groups[key]; !ok {
+			groupKeys = append(groupKeys, key)
+		}
+		groups[key] = append(groups[key], c)
+	}
+
+	for _, key := range groupKeys {
+		if d.tables[idx].entries[key].valid {
+			return 0, ErrCodeNotPrefixFree
+		}
+		next, err := d.build(groups[key], depth+bits)
+		if err != nil {
+			return 0, err
+		}
+		d.tables[idx].entries[key] = decoderEntry{valid: true, bitLen: uint8(bits), next: next}
+	}
+
+	return idx, nil
+}
+
+// decodeSymbol 从buf的第pos个比特开始解码一个字节，end为有效比特数
+// 返回解码得到的字节和消耗的比特数，解码到转义码时读入后面8比特的原始字节
+func (d *HuffmanDecoder) decodeSymbol(buf []byte, pos, end uint64) (byte, uint64, error) {
+	symbol, consumed, err := d.decodeIndex(buf, pos, end)
+	if err != nil || symbol != escapeSymbol {
+		return byte(symbol), consumed, err
+	}
+	if end-pos-consumed < 8 {
+		return 0, 0, ErrBitsExhausted
+	}
+
+	return byte(peekBits(buf, pos+consumed, 8)), consumed + 8, nil
+}
+
+// decodeIndex 从buf的第pos个比特开始解码一个符号，返回符号序号和消耗的比特数
+func (d *HuffmanDecoder) decodeIndex(buf []byte, pos, end uint64) (uint32, uint64, error) {
+	var consumed uint64 = 0
+	table := &d.tables[0]
+	for {
+		e := &table.entries[peekBits(buf, pos+consumed, table.bits)]
+		if !e.valid {
+			// 与逐比特查表的解码方式保持一致：比特位不足最长编码时视为比特用完
+			if end-pos < MaxWideHuffmanCodeBitLen {
+				return 0, 0, ErrBitsExhausted
+			}
+			return 0, 0, ErrBitCodeNotFound
+		}
+		consumed += uint64(e.bitLen)
+		if consumed > end-pos {
+			return 0, 0, ErrBitsExhausted
+		}
+		if e.next < 0 {
+			return e.symbol, consumed, nil
+		}
+		table = &d.tables[e.next]
+	}
+}
+
+// Decode 解码data中的bitLen个比特
+func (d *HuffmanDecoder) Decode(data []byte, bitLen uint64) ([]byte, error) {
+	ret := make([]byte, 0, bitLen/8)
+	var pos uint64 = 0
+	for pos < bitLen {
+		b, n, err := d.decodeSymbol(data, pos, bitLen)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, b)
+		pos += n
+	}
+
+	return ret, nil
+}
+
+// peekBits 返回buf中从第pos个比特开始的n个比特（n <= 56），超出buf的部分补0
+func peekBits(buf []byte, pos uint64, n uint8) uint64 {
+	if n == 0 {
+		return 0
+	}
+	idx := pos / 8
+	var word uint64
+	if idx+Uint64ByteSize <= uint64(len(buf)) {
+		word = binary.BigEndian.Uint64(buf[idx:])
+	} else {
+		for i := uint64(0); i < Uint64ByteSize; i++ {
+			word <<= 8
+			if idx+i < uint64(len(buf)) {
+				word |= uint64(buf[idx+i])
+			}
+		}
+	}
+
+	return (word << (pos % 8)) >> (MaxUint64Len - uint64(n))
+}
@@ -0,0 +1,157 @@
+package huffman
+
+import (
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// decodeBothWays 分别使用查表解码器和逐比特查表解码，两者的结果必须一致
+func decodeBothWays(t *testing.T, dense []byte, bitLen uint64, decTable WideHuffmanDecTable) []byte {
+	decoder, err := NewHuffmanDecoder(decTable)
+	require.Nil(t, err)
+
+	fast, fastErr := NewBitsReaderWithDecoder(dense, bitLen, decTable, decoder).ReadAll()
+	slow, slowErr := NewBitsReaderWithDecoder(dense, bitLen, decTable, nil).ReadAll()
+	require.Equal(t, slowErr, fastErr)
+	require.Equal(t, slow, fast)
+
+	return fast
+}
+
+func TestHuffmanDecoder(t *testing.T) {
+	text, err := os.ReadFile("test/test_data.txt")
+	require.Nil(t, err)
+
+	skewed := make([]byte, 0, 1<<12)
+	for i := 0; i < 1<<12; i++ {
+		skewed = append(skewed, byte(i%48))
+	}
+
+	testCases := []struct {
+		Data  []byte
+		Table WideHuffmanEncTable
+	}{
+		{Data: text, Table: NewCanonicalHuffmanEncTable(NewHuffmanTree(CountFrequencies(text)))},
+		{Data: text, Table: NewWideHuffmanEncTable(NewHuffmanTree(CountFrequencies(text)))},
+		{Data: []byte("aaaaaaa"), Table: NewWideHuffmanEncTable(NewHuffmanTree(CountFrequencies([]byte("a"))))},
+		{Data: skewed, Table: NewWideHuffmanEncTable(NewHuffmanTree(fibonacciFrequencies(48), MaxWideHuffmanCodeBitLen))},
+	}
+
+	for _, tc := range testCases {
+		dense, bitLen, err := compressBytesWith(tc.Data, tc.Table)
+		require.Nil(t, err)
+		ser, err := tc.Table.Serialize()
+		require.Nil(t, err)
+		decTable, err := DeserializeWideHuffmanDecTable(ser)
+		require.Nil(t, err)
+
+		require.Equal(t, tc.Data, decodeBothWays(t, dense, bitLen, decTable))
+
+		decoder, err := NewHuffmanDecoder(decTable)
+		require.Nil(t, err)
+		got, err := decoder.Decode(dense, bitLen)
+		require.Nil(t, err)
+		require.Equal(t, tc.Data, got)
+
+		// 截断比特位时，两种方式返回相同的错误
+		decodeBothWays(t, dense, bitLen-1, decTable)
+	}
+}
+
+func TestHuffmanDecoder_Random(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		freq := make(Frequencies)
+		for j := 0; j < 1+rnd.Intn(256); j++ {
+			freq[byte(rnd.Intn(256))] = uint64(1 + rnd.Intn(1<<uint(rnd.Intn(20))))
+		}
+		tree := NewHuffmanTree(freq, 12+rnd.Intn(20))
+		table := NewCanonicalHuffmanEncTable(tree)
+
+		data := make([]byte, 2000)
+		keys := make([]byte, 0, len(table))
+		for k := range table {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		for j := range data {
+			data[j] = keys[rnd.Intn(len(keys))]
+		}
+		dense, bitLen, err := compressBytesWith(data, table)
+		require.Nil(t, err)
+
+		decTable, err := NewDecTableFromLengths(tree.CodeLengths())
+		require.Nil(t, err)
+		require.Equal(t, data, decodeBothWays(t, dense, bitLen, decTable))
+
+		decoder, err := NewHuffmanDecoderFromLengths(tree.CodeLengths())
+		require.Nil(t, err)
+		got, err := decoder.Decode(dense, bitLen)
+		require.Nil(t, err)
+		require.Equal(t, data, got)
+	}
+}
+
+func TestHuffmanDecoder_NotPrefixFree(t *testing.T) {
+	decTable := NewWideHuffmanDecTable(2)
+	decTable[wideKey(NewWideHuffmanCodeFromString("0"))] = 'a'
+	decTable[wideKey(NewWideHuffmanCodeFromString("01"))] = 'b'
+	_, err := NewHuffmanDecoder(decTable)
+	require.ErrorIs(t, err, ErrCodeNotPrefixFree)
+
+	decTable = NewWideHuffmanDecTable(2)
+	decTable[wideKey(NewWideHuffmanCodeFromString("1"))] = 'a'
+	decTable[wideKey(NewWideHuffmanCodeFromString("1000000000000000000000000000001"))] = 'b'
+	_, err = NewHuffmanDecoder(decTable)
+	require.ErrorIs(t, err, ErrCodeNotPrefixFree)
+
+	// 不是前缀码时BitsReader退回到逐比特查表
+	reader := NewBitsReader([]byte{0x40}, 2, decTable)
+	require.Nil(t, reader.decoder)
+}
+
+func TestPeekBits(t *testing.T) {
+	buf := []byte{0xA5, 0x0F, 0xFF}
+	require.EqualValues(t, 0x5, peekBits(buf, 0, 3))
+	require.EqualValues(t, 0x50, peekBits(buf, 4, 8))
+	require.EqualValues(t, 0x3FF, peekBits(buf, 14, 10))
+	// 超出部分补0
+	require.EqualValues(t, 0xFC, peekBits(buf, 18, 8))
+	require.EqualValues(t, 0, peekBits(buf, 100, 8))
+}
+
+func benchmarkBitsReader(b *testing.B, withDecoder bool) {
+	data, err := os.ReadFile("test/test_data2.txt")
+	require.Nil(b, err)
+	table := NewCanonicalHuffmanEncTable(NewHuffmanTree(CountFrequencies(data)))
+	dense, bitLen, err := compressBytesWith(data, table)
+	require.Nil(b, err)
+	decTable, err := NewDecTableFromLengths(table.CodeLengths())
+	require.Nil(b, err)
+	var decoder *HuffmanDecoder
+	if withDecoder {
+		decoder, err = NewHuffmanDecoder(decTable)
+		require.Nil(b, err)
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := NewBitsReaderWithDecoder(dense, bitLen, decTable, decoder).ReadAll()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBitsReader_ReadAll(b *testing.B) {
+	benchmarkBitsReader(b, true)
+}
+
+func BenchmarkBitsReader_ReadAllBitByBit(b *testing.B) {
+	benchmarkBitsReader(b, false)
+}
@@ -0,0 +1,424 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"math/bits"
+)
+
+// DEFLATE（RFC 1951）格式的压缩器：使用lz77.go中的匹配查找，每个DEFLATE块使用动态Huffman码表（BTYPE=10），
+// 压缩后更大的块使用不压缩的存储块（BTYPE=00）。码表通过NewTree构建，最长15比特，按照范式Huffman编码分配编码，
+// 比特流通过WithLSBFirst的BitsWriter写出，Huffman编码本身从最高位开始写，所以写入前需要把编码的比特位逆序。
+//
+// 输出可以被compress/flate、zlib、浏览器等标准实现解压；NewGzipWriter和NewZlibWriter在DEFLATE流外面
+// 分别加上gzip（RFC 1952）和zlib（RFC 1950）的头和尾，可以直接用gzip、zlib等工具解压
+
+const (
+	// deflateChunkSize 是每次查找匹配的数据量，匹配不会跨越两份数据
+	deflateChunkSize = 1 << 20
+	// deflateBlockTokens 是每个DEFLATE块最多包含的字面量和匹配数量，每个块使用各自的码表
+	deflateBlockTokens = 1 << 14
+	// deflateMaxStoredSize 是每个存储块最多包含的字节数
+	deflateMaxStoredSize = 1<<16 - 1
+	// deflateCodeLenMaxBitLen 是编码长度码表的最大编码长度
+	deflateCodeLenMaxBitLen = 7
+	deflateCodeLenSymbolNum = 19
+)
+
+// DEFLATE块类型
+const (
+	deflateBlockStored  = 0
+	deflateBlockDynamic = 2
+)
+
+// 编码长度码表中的符号在块头中的顺序
+var deflateCodeLenOrder = [deflateCodeLenSymbolNum]int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+// DeflateWriter 压缩器的输出格式
+const (
+	formatDeflate = iota
+	formatGzip
+	formatZlib
+)
+
+// DeflateWriter 是DEFLATE格式的流式压缩器，实现了io.WriteCloser接口
+type DeflateWriter struct {
+	w           io.Writer
+	format      int
+	bw          *BitsWriter
+	buf         []byte
+	checksum    hash.Hash32 // gzip为CRC-32，zlib为Adler-32
+	size        uint32      // 压缩前的字节数，gzip的ISIZE
+	wroteHeader bool
+	closed      bool
+	err         error
+}
+
+// NewDeflateWriter 创建一个输出原始DEFLATE流的压缩器，可以通过flate.NewReader解压
+// 调用方需要在写入完成后调用Close，Close不会关闭w
+func NewDeflateWriter(w io.Writer) *DeflateWriter {
+	return &DeflateWriter{w: w, format: formatDeflate, bw: NewBitsWriter(WithLSBFirst())}
+}
+
+// NewGzipWriter 创建一个输出gzip格式的压缩器，可以通过gzip.NewReader或者gzip命令解压
+func NewGzipWriter(w io.Writer) *DeflateWriter {
+	zw := NewDeflateWriter(w)
+	zw.format = formatGzip
+	zw.checksum = crc32.NewIEEE()
+	return zw
+}
+
+// NewZlibWriter 创建一个输出zlib格式的压缩器，可以通过zlib.NewReader解压
+func NewZlibWriter(w io.Writer) *DeflateWriter {
+	zw := NewDeflateWriter(w)
+	zw.format = formatZlib
+	zw.checksum = adler32.New()
+	return zw
+}
+
+// Write 实现io.Writer接口，数据满deflateChunkSize时压缩写出
+func (z *DeflateWriter) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, ErrWriterClosed
+	}
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.checksum != nil {
+		z.checksum.Write(p)
+	}
+	z.size += uint32(len(p))
+
+	n := 0
+	for len(p) > 0 {
+		m := deflateChunkSize - len(z.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		z.buf = append(z.buf, p[:m]...)
+		p = p[m:]
+		n += m
+		if len(z.buf) == deflateChunkSize {
+			if z.err = z.writeChunk(false); z.err != nil {
+				return n, z.err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close 压缩剩下的数据并写出最后一个块和格式的尾部
+func (z *DeflateWriter) Close() error {
+	if z.closed {
+		return z.err
+	}
+	z.closed = true
+	if z.err != nil {
+		return z.err
+	}
+	if z.err = z.writeChunk(true); z.err != nil {
+		return z.err
+	}
+
+	z.bw.AlignByte()
+	var tail []byte
+	switch z.format {
+	case formatGzip:
+		tail = binary.LittleEndian.AppendUint32(tail, z.checksum.Sum32())
+		tail = binary.LittleEndian.AppendUint32(tail, z.size)
+	case formatZlib:
+		tail = writeUint32ToBytes(z.checksum.Sum32(), tail)
+	}
+	if _, z.err = z.w.Write(append(z.bw.Buf(), tail...)); z.err != nil {
+		return z.err
+	}
+	return nil
+}
+
+// writeHeader 写出gzip或zlib的头
+func (z *DeflateWriter) writeHeader() error {
+	z.wroteHeader = true
+	var header []byte
+	switch z.format {
+	case formatGzip:
+		// ID1 ID2 CM=8（DEFLATE） FLG=0 MTIME=0 XFL=0 OS=255（未知）
+		header = []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255}
+	case formatZlib:
+		// CMF：CM=8，窗口32KiB；FLG：默认压缩级别，(CMF*256 + FLG)是31的倍数
+		header = []byte{0x78, 0x9c}
+	default:
+		return nil
+	}
+	_, err := z.w.Write(header)
+	return err
+}
+
+// writeChunk 压缩缓冲区中的数据，final为true时最后一个DEFLATE块带有BFINAL标志
+func (z *DeflateWriter) writeChunk(final bool) error {
+	if !z.wroteHeader {
+		if err := z.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	data := z.buf
+	z.buf = z.buf[:0]
+	if len(data) == 0 {
+		if final {
+			z.writeStoredBlock(nil, true)
+		}
+	} else {
+		tokens := lz77Tokens(data)
+		for start := 0; start < len(tokens); start += deflateBlockTokens {
+			end := start + deflateBlockTokens
+			if end > len(tokens) {
+				end = len(tokens)
+			}
+			blockTokens := tokens[start:end]
+			size := lz77RawSize(blockTokens)
+			if err := z.writeBlock(blockTokens, data[:size], final && end == len(tokens)); err != nil {
+				return err
+			}
+			data = data[size:]
+		}
+	}
+
+	_, err := z.w.Write(z.bw.takeFull())
+	return err
+}
+
+// lz77RawSize 返回tokens对应的原始字节数
+func lz77RawSize(tokens []lz77Token) int {
+	size := 0
+	for _, t := range tokens {
+		if t.length == 0 {
+			size++
+		} else {
+			size += int(t.length)
+		}
+	}
+	return size
+}
+
+// deflateCodeLenToken 是编码长度序列经过游程编码后的一个符号
+// 符号0~15为编码长度，16重复前一个编码长度3~6次，17和18分别重复0编码长度3~10次和11~138次
+type deflateCodeLenToken struct {
+	symbol uint8
+	extra  uint8
+}
+
+// 符号16、17、18的额外比特数
+var deflateCodeLenExtra = [...]uint8{16: 2, 17: 3, 18: 7}
+
+// deflateRunLength 对编码长度序列进行游程编码
+func deflateRunLength(lengths []uint8) []deflateCodeLenToken {
+	var tokens []deflateCodeLenToken
+	for i := 0; i < len(lengths); {
+		l := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == l {
+			run++
+		}
+		i += run
+
+		if l == 0 {
+			for run >= 11 {
+				n := run
+				if n > 138 {
+					n = 138
+				}
+				tokens = append(tokens, deflateCodeLenToken{symbol: 18, extra: uint8(n - 11)})
+				run -= n
+			}
+			if run >= 3 {
+				tokens = append(tokens, deflateCodeLenToken{symbol: 17, extra: uint8(run - 3)})
+				run = 0
+			}
+		} else {
+			tokens = append(tokens, deflateCodeLenToken{symbol: l})
+			run--
+			for run >= 3 {
+				n := run
+				if n > 6 {
+					n = 6
+				}
+				tokens = append(tokens, deflateCodeLenToken{symbol: 16, extra: uint8(n - 3)})
+				run -= n
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, deflateCodeLenToken{symbol: l})
+		}
+	}
+	return tokens
+}
+
+// deflateCodes 是按照DEFLATE的方式逆序后的码表，以符号为下标
+type deflateCodes struct {
+	values  []uint64
+	bitLens []uint
+}
+
+// newDeflateCodes 根据编码长度分配范式Huffman编码，并把每个编码的比特位逆序
+func newDeflateCodes(lengths []uint8) (*deflateCodes, error) {
+	codes, err := canonicalSymbolCodes(lengths)
+	if err != nil {
+		return nil, err
+	}
+	c := &deflateCodes{values: make([]uint64, len(codes)), bitLens: make([]uint, len(codes))}
+	for s, code := range codes {
+		if code != nil {
+			c.bitLens[s] = uint(code.BitLen())
+			c.values[s] = bits.Reverse64(code.Value()) >> (MaxUint64Len - c.bitLens[s])
+		}
+	}
+	return c, nil
+}
+
+func (c *deflateCodes) write(w *BitsWriter, symbol int) {
+	w.writeBits(c.values[symbol], c.bitLens[symbol])
+}
+
+// usedSymbols 返回最后一个编码长度不为0的符号加1，至少为min
+func usedSymbols(lengths []uint8, min int) int {
+	n := len(lengths)
+	for n > min && lengths[n-1] == 0 {
+		n--
+	}
+	return n
+}
+
+// writeBlock 写出一个DEFLATE块，raw为tokens对应的原始数据
+// 使用动态Huffman码表压缩后比原始数据更大时写出存储块
+func (z *DeflateWriter) writeBlock(tokens []lz77Token, raw []byte, final bool) error {
+	litLenFreq, distFreq, extraBits := countLZ77Symbols(tokens)
+	litLenFreq[lz77EndOfBlock]++
+	// 没有匹配时也需要至少一个距离码
+	if isZeroUint64s(distFreq) {
+		distFreq[0] = 1
+	}
+
+	litLenLengths := symbolCodeLengths(litLenFreq, lz77MaxBitLen)
+	distLengths := symbolCodeLengths(distFreq, lz77MaxBitLen)
+	numLitLen := usedSymbols(litLenLengths, lz77EndOfBlock+1)
+	numDist := usedSymbols(distLengths, 1)
+
+	// 两个码表的编码长度连在一起进行游程编码，再用编码长度码表压缩
+	all := append(append([]uint8(nil), litLenLengths[:numLitLen]...), distLengths[:numDist]...)
+	clTokens := deflateRunLength(all)
+	clFreq := make([]uint64, deflateCodeLenSymbolNum)
+	for _, t := range clTokens {
+		clFreq[t.symbol]++
+		extraBits += uint64(deflateCodeLenExtra[t.symbol])
+	}
+	clLengths := symbolCodeLengths(clFreq, deflateCodeLenMaxBitLen)
+	numCodeLen := deflateCodeLenSymbolNum
+	for numCodeLen > 4 && clLengths[deflateCodeLenOrder[numCodeLen-1]] == 0 {
+		numCodeLen--
+	}
+
+	// 比较动态Huffman块和存储块的大小
+	dynamicBits := uint64(3+5+5+4+3*numCodeLen) + extraBits +
+		symbolsCost(litLenFreq, litLenLengths) + symbolsCost(distFreq, distLengths) + symbolsCost(clFreq, clLengths)
+	storedBlocks := (len(raw) + deflateMaxStoredSize - 1) / deflateMaxStoredSize
+	if uint64(len(raw)+storedBlocks*(1+2*Uint16ByteSize))*8 <= dynamicBits {
+		for len(raw) > deflateMaxStoredSize {
+			z.writeStoredBlock(raw[:deflateMaxStoredSize], false)
+			raw = raw[deflateMaxStoredSize:]
+		}
+		z.writeStoredBlock(raw, final)
+		return nil
+	}
+
+	litLen, err := newDeflateCodes(litLenLengths)
+	if err != nil {
+		return err
+	}
+	dist, err := newDeflateCodes(distLengths)
+	if err != nil {
+		return err
+	}
+	codeLen, err := newDeflateCodes(clLengths)
+	if err != nil {
+		return err
+	}
+
+	// 块头
+	w := z.bw
+	w.writeBits(deflateFinalBit(final), 1)
+	w.writeBits(deflateBlockDynamic, 2)
+	w.writeBits(uint64(numLitLen-lz77EndOfBlock-1), 5)
+	w.writeBits(uint64(numDist-1), 5)
+	w.writeBits(uint64(numCodeLen-4), 4)
+	for _, s := range deflateCodeLenOrder[:numCodeLen] {
+		w.writeBits(uint64(clLengths[s]), 3)
+	}
+	for _, t := range clTokens {
+		codeLen.write(w, int(t.symbol))
+		w.writeBits(uint64(t.extra), uint(deflateCodeLenExtra[t.symbol]))
+	}
+
+	// 数据
+	for _, t := range tokens {
+		if t.length == 0 {
+			litLen.write(w, int(t.value))
+			continue
+		}
+		lc, dc := lz77Symbols(t)
+		litLen.write(w, lc)
+		lc -= lz77EndOfBlock + 1
+		w.writeBits(uint64(t.length-lz77LengthBase[lc]), uint(lz77LengthExtra[lc]))
+		dist.write(w, dc)
+		w.writeBits(uint64(t.value-lz77DistBase[dc]), uint(lz77DistExtra[dc]))
+	}
+	litLen.write(w, lz77EndOfBlock)
+
+	return nil
+}
+
+// writeStoredBlock 写出一个存储块，raw不超过deflateMaxStoredSize字节
+func (z *DeflateWriter) writeStoredBlock(raw []byte, final bool) {
+	w := z.bw
+	w.writeBits(deflateFinalBit(final), 1)
+	w.writeBits(deflateBlockStored, 2)
+	w.AlignByte()
+	w.writeBits(uint64(len(raw)), MaxUint16Len)
+	w.writeBits(uint64(^uint16(len(raw))), MaxUint16Len)
+	for _, b := range raw {
+		w.writeBits(uint64(b), 8)
+	}
+}
+
+func deflateFinalBit(final bool) uint64 {
+	if final {
+		return 1
+	}
+	return 0
+}
+
+// isZeroUint64s 判断切片中是否全为0
+func isZeroUint64s(counts []uint64) bool {
+	for _, cnt := range counts {
+		if cnt != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Deflate 把data压缩成原始的DEFLATE流
+func Deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := NewDeflateWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,111 @@
+package huffman
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeflateRunLength(t *testing.T) {
+	lengths := []uint8{3, 3, 3, 3, 3, 3, 3, 3, 0, 0, 5, 0, 0, 0, 0}
+	lengths = append(lengths, make([]uint8, 150)...) // 一共154个0
+	lengths = append(lengths, 7, 7)
+	require.Equal(t, []deflateCodeLenToken{
+		{symbol: 3}, {symbol: 16, extra: 3}, {symbol: 3},
+		{symbol: 0}, {symbol: 0},
+		{symbol: 5},
+		{symbol: 18, extra: 127}, {symbol: 18, extra: 5},
+		{symbol: 7}, {symbol: 7},
+	}, deflateRunLength(lengths))
+}
+
+// deflateTestData 返回不同特点的测试数据
+func deflateTestData(t *testing.T) map[string][]byte {
+	text, err := os.ReadFile(s1)
+	require.Nil(t, err)
+	random := make([]byte, 200000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	return map[string][]byte{
+		"empty":  {},
+		"one":    {'x'},
+		"text":   text,
+		"random": random,
+		"repeat": bytes.Repeat([]byte("abc"), 100000),
+		"mixed":  mixedData(deflateChunkSize + 12345),
+	}
+}
+
+func TestDeflateWriter(t *testing.T) {
+	for name, data := range deflateTestData(t) {
+		compressed, err := Deflate(data)
+		require.Nil(t, err, name)
+		got, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+		require.Nil(t, err, name)
+		require.True(t, bytes.Equal(data, got), name)
+	}
+
+	// 文本压缩后的大小和compress/flate接近
+	text, err := os.ReadFile(s1)
+	require.Nil(t, err)
+	compressed, err := Deflate(text)
+	require.Nil(t, err)
+	var std bytes.Buffer
+	fw, err := flate.NewWriter(&std, flate.DefaultCompression)
+	require.Nil(t, err)
+	fw.Write(text)
+	fw.Close()
+	require.Less(t, len(compressed), std.Len()*11/10)
+
+	// 每次写入任意长度的数据
+	data := mixedData(3 * deflateChunkSize)
+	var buf bytes.Buffer
+	zw := NewDeflateWriter(&buf)
+	for i := 0; i < len(data); i += 77777 {
+		end := i + 77777
+		if end > len(data) {
+			end = len(data)
+		}
+		_, err := zw.Write(data[i:end])
+		require.Nil(t, err)
+	}
+	require.Nil(t, zw.Close())
+	_, err = zw.Write([]byte{1})
+	require.ErrorIs(t, err, ErrWriterClosed)
+	got, err := io.ReadAll(flate.NewReader(&buf))
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+}
+
+func TestGzipZlibWriter(t *testing.T) {
+	for name, data := range deflateTestData(t) {
+		var buf bytes.Buffer
+		zw := NewGzipWriter(&buf)
+		_, err := zw.Write(data)
+		require.Nil(t, err)
+		require.Nil(t, zw.Close())
+		gr, err := gzip.NewReader(&buf)
+		require.Nil(t, err, name)
+		got, err := io.ReadAll(gr)
+		require.Nil(t, err, name)
+		require.True(t, bytes.Equal(data, got), name)
+
+		buf.Reset()
+		zw = NewZlibWriter(&buf)
+		_, err = zw.Write(data)
+		require.Nil(t, err)
+		require.Nil(t, zw.Close())
+		zr, err := zlib.NewReader(&buf)
+		require.Nil(t, err, name)
+		got, err = io.ReadAll(zr)
+		require.Nil(t, err, name)
+		require.True(t, bytes.Equal(data, got), name)
+	}
+}
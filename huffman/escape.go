@@ -0,0 +1,264 @@
+package huffman
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+// 转义码：静态码表或者训练得到的码表在实际数据中可能遇到码表中没有的字节，这时compressBytesWith会返回错误。
+// WithEscape为码表加上一个转义码，编码时码表中没有的字节输出转义码和8比特的原始字节（EscapeEncTable也可以作为预置码表），
+// BitsReader和HuffmanDecoder解码到转义码时再读入后面的8比特作为原始字节，这样码表可以编码任何数据。
+//
+// 转义码通过把码表中最长的一个编码（长度相同时取字节最大的一个）拆分成两个得到：
+// 原来的编码后面加0仍然分配给原来的字节，后面加1作为转义码，码表中的其它编码不变。
+// 空的码表中转义码为"0"，所有字节都编码为转义码加上原始字节；已经包含所有256个字节的码表不需要转义码。
+//
+// 带有转义码的码表序列化格式如下：（大端序）
+// START_FLAG						4 bytes ("HFEX")
+// NUMBER OF TABLE ITEMS			4 bytes (uint32)
+// TABLE_ITEM(BYTE+BITLEN+CODE)	1+1+8=10 bytes，和宽编码格式的表项相同
+// ESCAPE(BITLEN+CODE)			1+8=9 bytes，BITLEN为0表示没有转义码
+// CRC32							4 bytes
+// END_FLAG						4 bytes
+
+const (
+	HuffmanEncTableSerEscapeStartFlag uint32 = 0x48464558 // "HFEX"
+
+	EscapeItemSize = 9 // bytes
+
+	// escapeSymbol 是转义码在查表解码器中的符号序号，不会和字节冲突
+	escapeSymbol uint32 = MaxSymbolNum
+
+	// maxEscapedBitLen 是带有转义码的码表中一个字节最多使用的比特数：最长的转义码加上8比特的原始字节
+	maxEscapedBitLen = MaxWideHuffmanCodeBitLen + 8
+)
+
+var (
+	ErrEscapeTooLong = fmt.Errorf("escape code exceeds %d bits", MaxWideHuffmanCodeBitLen)
+)
+
+// EscapeEncTable 是带有转义码的编码表
+type EscapeEncTable struct {
+	Table  WideHuffmanEncTable // 码表中的字节，最长的编码已经被拆分
+	Escape *WideHuffmanCode    // 转义码，为nil时没有转义码
+}
+
+// EscapeDecTable 是带有转义码的解码表
+type EscapeDecTable struct {
+	Table  WideHuffmanDecTable
+	Escape *WideHuffmanCode // 转义码，为nil时没有转义码
+}
+
+// WithEscape 返回带有转义码的编码表，原来的编码表不会被修改
+func (h HuffmanEncTable) WithEscape() (*EscapeEncTable, error) {
+	return h.Wide().WithEscape()
+}
+
+// WithEscape 返回带有转义码的解码表，原来的解码表不会被修改
+func (h HuffmanDecTable) WithEscape() (*EscapeDecTable, error) {
+	return h.Wide().WithEscape()
+}
+
+// WithEscape 返回带有转义码的编码表，原来的编码表不会被修改
+// 编码表已经包含所有256个字节时不需要转义码，返回的Escape为nil
+func (h WideHuffmanEncTable) WithEscape() (*EscapeEncTable, error) {
+	codes, escape, err := escapeCodes(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EscapeEncTable{Table: WideHuffmanEncTable(codes), Escape: escape}, nil
+}
+
+// WithEscape 返回带有转义码的解码表，原来的解码表不会被修改
+// 和对应的编码表调用WithEscape得到的编码表一致
+func (h WideHuffmanDecTable) WithEscape() (*EscapeDecTable, error) {
+	codes := make(map[byte]*WideHuffmanCode, len(h))
+	for k, v := range h {
+		codes[v] = newCode(k.bits, int(k.bitLen))
+	}
+	codes, escape, err := escapeCodes(codes)
+	if err != nil {
+		return nil, err
+	}
+
+	return (&EscapeEncTable{Table: WideHuffmanEncTable(codes), Escape: escape}).DecTable(), nil
+}
+
+// escapeCodes 拆分最长的编码得到转义码，返回拆分后的编码和转义码
+func escapeCodes(codes map[byte]*WideHuffmanCode) (map[byte]*WideHuffmanCode, *WideHuffmanCode, error) {
+	ret := make(map[byte]*WideHuffmanCode, len(codes))
+	var longest *WideHuffmanCode
+	var longestKey byte
+	for k, code := range codes {
+		ret[k] = code
+		if longest == nil || code.BitLen() > longest.BitLen() || (code.BitLen() == longest.BitLen() && k > longestKey) {
+			longest = code
+			longestKey = k
+		}
+	}
+	if len(codes) == MaxSymbolNum {
+		return ret, nil, nil
+	}
+
+	// 空的码表没有可以拆分的编码，只有转义码
+	if longest == nil {
+		return ret, newCode(0, 1), nil
+	}
+	escapeLen := longest.BitLen() + 1
+	if escapeLen > MaxWideHuffmanCodeBitLen {
+		return nil, nil, ErrEscapeTooLong
+	}
+	ret[longestKey] = newCode(longest.Value()<<1, escapeLen)
+
+	return ret, newCode(longest.Value()<<1|1, escapeLen), nil
+}
+
+// ItemNum 返回码表中字节的数量，不包括转义码
+func (t *EscapeEncTable) ItemNum() int {
+	return len(t.Table)
+}
+
+// Code 返回字节的编码，码表中没有该字节时返回false，这时compressBytesWith使用转义码
+func (t *EscapeEncTable) Code(b byte) (HuffmanCodeInterface, bool) {
+	return t.Table.Code(b)
+}
+
+// Encode 编码data，码表中没有的字节编码为转义码加上8比特的原始字节
+// 返回编码后的字节切片，编码后的有效比特数
+func (t *EscapeEncTable) Encode(data []byte) ([]byte, uint64, error) {
+	return compressBytesWith(data, t)
+}
+
+// escapeOf 返回编码表的转义码，只有带有转义码的EscapeEncTable返回非nil
+func escapeOf(table ByteEncTable) *WideHuffmanCode {
+	if t, ok := table.(*EscapeEncTable); ok {
+		return t.Escape
+	}
+	return nil
+}
+
+// DecTable 返回与编码表对应的解码表
+func (t *EscapeEncTable) DecTable() *EscapeDecTable {
+	return &EscapeDecTable{
+		Table:  WideHuffmanDecTable(EncTable[byte](t.Table).DecTable()),
+		Escape: t.Escape,
+	}
+}
+
+// Serialize 将带有转义码的编码表序列化到字节切片中
+func (t *EscapeEncTable) Serialize() ([]byte, error) {
+	escape := t.Escape
+	if escape == nil {
+		escape = &WideHuffmanCode{}
+	}
+	ser := make([]byte, 0, MinHuffmanTableSerSize+WideTableItemSize*len(t.Table)+EscapeItemSize)
+
+	ser = writeUint32ToBytes(HuffmanEncTableSerEscapeStartFlag, ser)
+	ser = writeUint32ToBytes(uint32(len(t.Table)), ser)
+	ser = appendTableItems(ser, t.Table, true)
+	ser = append(ser, byte(escape.BitLen()))
+	ser = writeUint64ToBytes(escape.Value(), ser)
+	ser = writeUint32ToBytes(crc32.Checksum(ser, crc32q), ser)
+
+	return writeUint32ToBytes(HuffmanEncTableSerEndFlag, ser), nil
+}
+
+// DeserializeEscapeEncTable 将字节切片反序列回EscapeEncTable
+func DeserializeEscapeEncTable(data []byte) (*EscapeEncTable, error) {
+	table, escape, err := deserializeEscape(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EscapeEncTable{Table: table, Escape: escape}, nil
+}
+
+// DeserializeEscapeDecTable 将字节切片反序列回EscapeDecTable
+func DeserializeEscapeDecTable(data []byte) (*EscapeDecTable, error) {
+	enc, err := DeserializeEscapeEncTable(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return enc.DecTable(), nil
+}
+
+// deserializeEscape 反序列化带有转义码的码表，返回码表和转义码
+func deserializeEscape(data []byte) (WideHuffmanEncTable, *WideHuffmanCode, error) {
+	if len(data) < MinHuffmanTableSerSize+EscapeItemSize {
+		return nil, nil, ErrInvalidSize
+	}
+
+	cursor, err := parseFlag(data, 0, HuffmanEncTableSerEscapeStartFlag)
+	if err != nil {
+		return nil, nil, ErrInvalidStartFlag
+	}
+	itemNum, cursor, err := parseItemNum(data, cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	table, cursor, err := parseEncTable(data, cursor, itemNum, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 读转义码
+	if cursor+EscapeItemSize > len(data) {
+		return nil, nil, ErrCursorOverflow
+	}
+	bitLen := int(data[cursor])
+	if bitLen > MaxWideHuffmanCodeBitLen {
+		return nil, nil, ErrDeserialize
+	}
+	value, err := readNextUint64(data, cursor+1)
+	if err != nil {
+		return nil, nil, err
+	}
+	cursor += EscapeItemSize
+	var escape *WideHuffmanCode
+	if bitLen != 0 {
+		escape = newCode(value, bitLen)
+	}
+
+	cursor, err = validateChecksum(data, cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = parseEndFlag(data, cursor); err != nil {
+		return nil, nil, err
+	}
+
+	return table, escape, nil
+}
+
+// Decode 解码data中的bitLen个比特
+func (t *EscapeDecTable) Decode(data []byte, bitLen uint64) ([]byte, error) {
+	return NewEscapeBitsReader(data, bitLen, t).ReadAll()
+}
+
+// NewHuffmanDecoder 构建能够识别转义码的查表解码器
+func (t *EscapeDecTable) NewHuffmanDecoder() (*HuffmanDecoder, error) {
+	codes, err := decoderCodes(t.Table, 1)
+	if err != nil {
+		return nil, err
+	}
+	if t.Escape != nil {
+		if t.Escape.BitLen() == 0 {
+			return nil, ErrCodeNotPrefixFree
+		}
+		codes = append(codes, decoderCode{code: t.Escape.Value(), bitLen: t.Escape.BitLen(), symbol: escapeSymbol})
+	}
+
+	return newHuffmanDecoder(codes)
+}
+
+// NewEscapeBitsReader 使用带有转义码的解码表创建BitsReader
+func NewEscapeBitsReader(buf []byte, bitLen uint64, table *EscapeDecTable) *BitsReader {
+	// 编译失败（例如码表不是前缀码）时退回到逐比特查表
+	decoder, _ := table.NewHuffmanDecoder()
+	r := NewBitsReaderWithDecoder(buf, bitLen, table.Table, decoder)
+	r.escape = table.Escape
+
+	return r
+}
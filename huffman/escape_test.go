@@ -0,0 +1,140 @@
+package huffman
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHuffmanEncTable_WithEscape(t *testing.T) {
+	table := NewWideHuffmanEncTable(NewHuffmanTree(CountFrequencies([]byte("aaaabbbccd"))))
+	_, _, err := compressBytesWith([]byte("xyz"), table)
+	require.NotNil(t, err)
+
+	escaped, err := table.WithEscape()
+	require.Nil(t, err)
+	// 码表中只多了一个转义码，没有展开成256个字节
+	require.Len(t, escaped.Table, 4)
+	require.Len(t, table, 4)
+	// 最长的编码拆分成两个，其余的编码不变
+	longest := byte('d')
+	require.Equal(t, table.Get(longest).BitLen()+1, escaped.Table.Get(longest).BitLen())
+	require.Equal(t, table.Get(longest).String()+"0", escaped.Table.Get(longest).String())
+	require.Equal(t, table.Get(longest).String()+"1", escaped.Escape.String())
+	for _, b := range []byte("abc") {
+		require.Equal(t, table.Get(b).String(), escaped.Table.Get(b).String())
+	}
+
+	// 码表中没有的字节编码为转义码加上8比特的原始字节
+	compressed, bitLen, err := escaped.Encode([]byte("x"))
+	require.Nil(t, err)
+	require.EqualValues(t, escaped.Escape.BitLen()+8, bitLen)
+	require.Equal(t, escaped.Escape.String()+"01111000", BytesToString(compressed, int(bitLen)))
+
+	data := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(data)
+	data = append(data, "aaaabbbccd"...)
+	compressed, bitLen, err = escaped.Encode(data)
+	require.Nil(t, err)
+
+	// 序列化后的码表中记录了转义码
+	ser, err := escaped.Serialize()
+	require.Nil(t, err)
+	require.Equal(t, MinHuffmanTableSerSize+WideTableItemSize*len(escaped.Table)+EscapeItemSize, len(ser))
+	decTable, err := DeserializeEscapeDecTable(ser)
+	require.Nil(t, err)
+	require.Equal(t, escaped.DecTable(), decTable)
+	recovered, err := decTable.Decode(compressed, bitLen)
+	require.Nil(t, err)
+	require.Equal(t, data, recovered)
+	encTable, err := DeserializeEscapeEncTable(ser)
+	require.Nil(t, err)
+	require.True(t, escaped.Table.Equals(encTable.Table))
+	require.Equal(t, escaped.Escape, encTable.Escape)
+
+	// 逐比特查找解码表
+	reader := NewEscapeBitsReader(compressed, bitLen, decTable)
+	require.NotNil(t, reader.decoder)
+	reader.decoder = nil
+	recovered, err = reader.ReadAll()
+	require.Nil(t, err)
+	require.Equal(t, data, recovered)
+
+	// 不认识转义码的解码表无法解码
+	_, err = decompressBytesWith(compressed, bitLen, decTable.Table)
+	require.NotNil(t, err)
+
+	// 解码表调用WithEscape得到同样的结果
+	ser, err = table.Serialize()
+	require.Nil(t, err)
+	plainDec, err := DeserializeWideHuffmanDecTable(ser)
+	require.Nil(t, err)
+	escapedDec, err := plainDec.WithEscape()
+	require.Nil(t, err)
+	require.Equal(t, decTable, escapedDec)
+	require.Len(t, plainDec, 4)
+
+	// 普通码表的反序列化不接受带有转义码的格式
+	ser, err = escaped.Serialize()
+	require.Nil(t, err)
+	_, err = DeserializeWideHuffmanDecTable(ser)
+	require.ErrorIs(t, err, ErrInvalidStartFlag)
+	ser[len(ser)-MetaSize-MetaSize-1] ^= 0xFF
+	_, err = DeserializeEscapeDecTable(ser)
+	require.ErrorIs(t, err, ErrChecksumNotMatched)
+}
+
+func TestHuffmanEncTable_WithEscapeEdge(t *testing.T) {
+	// 已经包含所有字节时不需要转义码
+	freq := make(Frequencies)
+	for i := 0; i < MaxSymbolNum; i++ {
+		freq[byte(i)] = uint64(i + 1)
+	}
+	table := NewWideHuffmanEncTable(NewHuffmanTree(freq))
+	escaped, err := table.WithEscape()
+	require.Nil(t, err)
+	require.True(t, table.Equals(escaped.Table))
+	require.Nil(t, escaped.Escape)
+	ser, err := escaped.Serialize()
+	require.Nil(t, err)
+	decTable, err := DeserializeEscapeDecTable(ser)
+	require.Nil(t, err)
+	require.Nil(t, decTable.Escape)
+
+	// 空的码表中所有字节都编码为转义码加上原始字节
+	escaped, err = WideHuffmanEncTable{}.WithEscape()
+	require.Nil(t, err)
+	require.Len(t, escaped.Table, 0)
+	require.Equal(t, "0", escaped.Escape.String())
+	compressed, bitLen, err := escaped.Encode([]byte("ab"))
+	require.Nil(t, err)
+	require.Equal(t, "0011000010"+"01100010", BytesToString(compressed, int(bitLen)))
+	recovered, err := escaped.DecTable().Decode(compressed, bitLen)
+	require.Nil(t, err)
+	require.Equal(t, []byte("ab"), recovered)
+
+	// 只有一个字节
+	narrowTable, err := NewHuffmanEncTable(NewHuffmanTree(Frequencies{'a': 10}))
+	require.Nil(t, err)
+	narrow, err := narrowTable.WithEscape()
+	require.Nil(t, err)
+	require.Equal(t, "00", narrow.Table.Get('a').String())
+	require.Equal(t, "01", narrow.Escape.String())
+	compressed, bitLen, err = narrow.Encode([]byte("aba"))
+	require.Nil(t, err)
+	require.Equal(t, "00"+"0101100010"+"00", BytesToString(compressed, int(bitLen)))
+
+	// 转义码后面的原始字节被截断
+	_, err = narrow.DecTable().Decode(compressed, 8)
+	require.ErrorIs(t, err, ErrBitsExhausted)
+	reader := NewEscapeBitsReader(compressed, 8, narrow.DecTable())
+	reader.decoder = nil
+	_, err = reader.ReadAll()
+	require.ErrorIs(t, err, ErrBitsExhausted)
+
+	// 转义码超过64位
+	table = NewWideHuffmanEncTable(NewHuffmanTree(fibonacciFrequencies(66), MaxWideHuffmanCodeBitLen))
+	_, err = table.WithEscape()
+	require.ErrorIs(t, err, ErrEscapeTooLong)
+}
@@ -0,0 +1,329 @@
+package huffman
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 泛型版本的Huffman树、编码表和解码表，符号可以是任意可比较的类型，例如uint16的token编号或者枚举值
+// 以字节为符号的版本都建立在它们之上：Frequencies就是SymbolFrequencies[byte]，HuffmanTree由NewTree[byte]构建后
+// 把节点转换成HuffmanNode；WideHuffmanEncTable和EncTable[byte]、WideHuffmanDecTable和DecTable[byte]的底层类型相同，
+// 可以直接相互转换
+
+var (
+	ErrSymbolNotFound = fmt.Errorf("symbol not found")
+)
+
+// Ordered 是可以直接比较大小的符号类型
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~string
+}
+
+// Less 按照符号本身的大小排列，可以作为NewTree的less参数
+func Less[S Ordered](a, b S) bool {
+	return a < b
+}
+
+// SymbolFrequencies 记录每个符号的出现频数
+type SymbolFrequencies[S comparable] map[S]uint64
+
+// Increment 把符号的频数加1
+func (f SymbolFrequencies[S]) Increment(key S) {
+	f[key]++
+}
+
+// CountSymbolFrequencies 统计输入符号切片中每个符号的出现频数
+func CountSymbolFrequencies[S comparable](data []S) SymbolFrequencies[S] {
+	frequency := make(SymbolFrequencies[S])
+	for _, d := range data {
+		frequency[d]++
+	}
+
+	return frequency
+}
+
+// Node 是Tree[S]的节点
+type Node[S comparable] struct {
+	Weight uint64
+	Parent *Node[S]
+	Left   *Node[S]
+	Right  *Node[S]
+	// Symbol 为叶子节点的符号
+	Symbol S
+	// Code 为叶子节点的Huffman编码，最长MaxWideHuffmanCodeBitLen比特
+	Code *WideHuffmanCode
+	// 叶子节点在Tree.Leaves中的下标，权重相同时按照下标合并
+	index int
+}
+
+// IsLeaf 判断当前节点是否为叶子节点
+func (nd *Node[S]) IsLeaf() bool {
+	return nd.Left == nil && nd.Right == nil
+}
+
+// IsLeft 判断当前节点是否为左子树
+func (nd *Node[S]) IsLeft() bool {
+	if nd.Parent != nil {
+		return nd.Parent.Left == nd
+	}
+	return false
+}
+
+// IsRight 判断当前节点是否为右子树
+func (nd *Node[S]) IsRight() bool {
+	if nd.Parent != nil {
+		return nd.Parent.Right == nd
+	}
+	return false
+}
+
+// setCode 设置这个节点的Huffman编码
+// 设置思路：从叶子节点不断往上，追加比特位，最后将所有比特位逆序
+func (nd *Node[S]) setCode() {
+	cur := nd
+	huffmanBits := &WideHuffmanCode{}
+	for cur != nil {
+		if cur.IsLeft() {
+			huffmanBits.AppendZero()
+		} else if cur.IsRight() {
+			huffmanBits.AppendOne()
+		}
+		cur = cur.Parent
+	}
+	nd.Code = huffmanBits.ReverseNew()
+}
+
+// depth 返回节点到根节点的距离
+func (nd *Node[S]) depth() int {
+	d := 0
+	for cur := nd; cur.Parent != nil; cur = cur.Parent {
+		d++
+	}
+	return d
+}
+
+// Tree 表示了一棵符号类型为S的Huffman树，叶子节点按照符号顺序排列
+type Tree[S comparable] struct {
+	Freq   SymbolFrequencies[S]
+	Root   *Node[S]
+	Leaves []*Node[S]
+}
+
+// NewTree 根据指定频率构建一棵新的Huffman树
+// less决定符号的顺序，权重相同的节点按照符号顺序合并，保证相同的频率总是得到相同的Huffman树
+// maxBitLen为可选参数，指定编码的最大比特长度，默认为MaxHuffmanCodeBitLen，最大为MaxWideHuffmanCodeBitLen
+func NewTree[S comparable](freq SymbolFrequencies[S], less func(a, b S) bool, maxBitLen ...int) *Tree[S] {
+	limit := resolveMaxBitLen(len(freq), maxBitLen)
+
+	symbols := make([]S, 0, len(freq))
+	for s := range freq {
+		symbols = append(symbols, s)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return less(symbols[i], symbols[j]) })
+
+	leaves := make([]*Node[S], 0, len(symbols))
+	for i, s := range symbols {
+		leaves = append(leaves, &Node[S]{Weight: freq[s], Symbol: s, index: i})
+	}
+
+	tree := &Tree[S]{
+		Freq:   freq,
+		Leaves: leaves,
+	}
+	if len(leaves) > 0 {
+		tree.Root = buildTree(leaves, limit)
+	}
+
+	return tree
+}
+
+// Symbols 返回按顺序排列的所有符号，与Leaves一一对应
+func (t *Tree[S]) Symbols() []S {
+	symbols := make([]S, len(t.Leaves))
+	for i, leaf := range t.Leaves {
+		symbols[i] = leaf.Symbol
+	}
+
+	return symbols
+}
+
+// CodeLengths 返回每个符号的编码长度，与Symbols一一对应
+func (t *Tree[S]) CodeLengths() []uint8 {
+	lengths := make([]uint8, len(t.Leaves))
+	for i, leaf := range t.Leaves {
+		lengths[i] = uint8(leaf.Code.BitLen())
+	}
+
+	return lengths
+}
+
+// EncTable 是符号类型为S的Huffman编码表
+type EncTable[S comparable] map[S]*WideHuffmanCode
+
+// DecTable 是符号类型为S的Huffman解码表，统一使用WideHuffmanCode作为键
+type DecTable[S comparable] map[WideHuffmanCode]S
+
+// NewEncTable 根据Huffman树创建编码表
+func NewEncTable[S comparable](tree *Tree[S]) EncTable[S] {
+	table := make(EncTable[S], len(tree.Leaves))
+	for _, leaf := range tree.Leaves {
+		table[leaf.Symbol] = leaf.Code
+	}
+
+	return table
+}
+
+// NewCanonicalEncTable 根据Huffman树中每个符号的编码长度创建范式Huffman编码表
+// 只需要传输Symbols和CodeLengths，对方就可以通过NewDecTableFromSymbolLengths得到相同的码表
+func NewCanonicalEncTable[S comparable](tree *Tree[S]) EncTable[S] {
+	table, err := NewEncTableFromSymbolLengths(tree.Symbols(), tree.CodeLengths())
+	if err != nil {
+		// Huffman树得到的编码长度一定是合法的
+		panic(err)
+	}
+
+	return table
+}
+
+// NewEncTableFromSymbolLengths 根据每个符号的编码长度创建范式Huffman编码表
+// symbols和lengths一一对应，编码长度相同的符号按照在symbols中的顺序分配编码，编码长度为0表示该符号不在编码表中
+func NewEncTableFromSymbolLengths[S comparable](symbols []S, lengths []uint8) (EncTable[S], error) {
+	if len(symbols) != len(lengths) {
+		return nil, fmt.Errorf("%w: %d symbols but %d lengths", ErrInvalidCodeLengths, len(symbols), len(lengths))
+	}
+	codes, err := canonicalSymbolCodes(lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	table := make(EncTable[S], len(codes))
+	for i, code := range codes {
+		if code != nil {
+			table[symbols[i]] = code
+		}
+	}
+
+	return table, nil
+}
+
+// NewDecTableFromSymbolLengths 根据每个符号的编码长度创建范式Huffman解码表
+// 参数的含义和NewEncTableFromSymbolLengths相同
+func NewDecTableFromSymbolLengths[S comparable](symbols []S, lengths []uint8) (DecTable[S], error) {
+	table, err := NewEncTableFromSymbolLengths(symbols, lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	return table.DecTable(), nil
+}
+
+// Get 获取EncTable中的编码
+func (t EncTable[S]) Get(key S) *WideHuffmanCode {
+	if code, ok := t[key]; ok {
+		return code
+	}
+	return nil
+}
+
+// DecTable 返回与编码表对应的解码表
+func (t EncTable[S]) DecTable() DecTable[S] {
+	table := make(DecTable[S], len(t))
+	for k, code := range t {
+		table[wideKey(code)] = k
+	}
+
+	return table
+}
+
+// Encode 编码一个符号切片
+// 返回编码后的字节切片，编码后的有效比特数
+func (t EncTable[S]) Encode(symbols []S) ([]byte, uint64, error) {
+	var totalBits uint64 = 0
+	for i, s := range symbols {
+		code, ok := t[s]
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: %v at %d", ErrSymbolNotFound, s, i)
+		}
+		totalBits += uint64(code.BitLen())
+	}
+
+	w := NewBitsWriter()
+	w.Grow(totalBits)
+	for _, s := range symbols {
+		code := t[s]
+		w.writeBits(code.Value(), uint(code.BitLen()))
+	}
+
+	return w.Buf(), totalBits, nil
+}
+
+// Get 获取某个编码所对应的符号
+func (t DecTable[S]) Get(key *WideHuffmanCode) (S, bool) {
+	v, ok := t[wideKey(key)]
+	return v, ok
+}
+
+// Decode 解码data中的bitLen个比特，需要多次解码时可以使用NewDecoder复用查找表
+func (t DecTable[S]) Decode(data []byte, bitLen uint64) ([]S, error) {
+	decoder, err := NewDecoder(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return decoder.Decode(data, bitLen)
+}
+
+// Decoder 是符号类型为S的查表解码器，查找表中记录符号序号，解码时再转换成符号
+type Decoder[S comparable] struct {
+	decoder *HuffmanDecoder
+	symbols []S
+}
+
+// NewDecoder 根据DecTable构建查表解码器
+func NewDecoder[S comparable](table DecTable[S]) (*Decoder[S], error) {
+	codes := make([]decoderCode, 0, len(table))
+	symbols := make([]S, 0, len(table))
+	for k, v := range table {
+		if k.bitLen == 0 {
+			return nil, ErrCodeNotPrefixFree
+		}
+		codes = append(codes, decoderCode{code: k.bits, bitLen: int(k.bitLen), symbol: uint32(len(symbols))})
+		symbols = append(symbols, v)
+	}
+
+	decoder, err := newHuffmanDecoder(codes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Decoder[S]{decoder: decoder, symbols: symbols}, nil
+}
+
+// Decode 解码data中的bitLen个比特
+func (d *Decoder[S]) Decode(data []byte, bitLen uint64) ([]S, error) {
+	var ret []S
+	var pos uint64 = 0
+	for pos < bitLen {
+		i, n, err := d.decoder.decodeIndex(data, pos, bitLen)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, d.symbols[i])
+		pos += n
+	}
+
+	return ret, nil
+}
+
+// DecodeSymbol 从data的第pos个比特开始解码一个符号，bitLen为有效比特数
+// 返回解码得到的符号和消耗的比特数，剩下的比特不足一个编码时返回ErrBitsExhausted
+func (d *Decoder[S]) DecodeSymbol(data []byte, pos, bitLen uint64) (S, uint64, error) {
+	i, n, err := d.decoder.decodeIndex(data, pos, bitLen)
+	if err != nil {
+		var zero S
+		return zero, 0, err
+	}
+	return d.symbols[i], n, nil
+}
@@ -0,0 +1,150 @@
+package huffman
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+// uint16的token编号，符号数量超过256
+func TestTree_Uint16(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]uint16, 0, 1<<16)
+	for i := 0; i < 1<<16; i++ {
+		data = append(data, uint16(rnd.ExpFloat64()*500))
+	}
+
+	freq := CountSymbolFrequencies(data)
+	require.Greater(t, len(freq), MaxSymbolNum)
+	tree := NewTree(freq, Less[uint16])
+	require.Len(t, tree.Symbols(), len(freq))
+	for i := 1; i < len(tree.Symbols()); i++ {
+		require.Less(t, tree.Symbols()[i-1], tree.Symbols()[i])
+	}
+
+	for _, table := range []EncTable[uint16]{NewEncTable(tree), NewCanonicalEncTable(tree)} {
+		encoded, bitLen, err := table.Encode(data)
+		require.Nil(t, err)
+
+		var expectedBits uint64 = 0
+		for s, cnt := range freq {
+			expectedBits += cnt * uint64(table.Get(s).BitLen())
+		}
+		require.Equal(t, expectedBits, bitLen)
+
+		decoded, err := table.DecTable().Decode(encoded, bitLen)
+		require.Nil(t, err)
+		require.Equal(t, data, decoded)
+	}
+
+	// 只传输符号和编码长度就可以还原范式编码的解码表
+	decTable, err := NewDecTableFromSymbolLengths(tree.Symbols(), tree.CodeLengths())
+	require.Nil(t, err)
+	require.Equal(t, NewCanonicalEncTable(tree).DecTable(), decTable)
+}
+
+func TestTree_Enum(t *testing.T) {
+	data := []tokenKind{tokenIdent, tokenOperator, tokenNumber, tokenIdent, tokenIdent, tokenString, tokenIdent}
+	tree := NewTree(CountSymbolFrequencies(data), Less[tokenKind])
+	table := NewEncTable(tree)
+	require.Equal(t, 1, table.Get(tokenIdent).BitLen())
+	require.Nil(t, table.Get(tokenKind(42)))
+
+	encoded, bitLen, err := table.Encode(data)
+	require.Nil(t, err)
+	decoder, err := NewDecoder(table.DecTable())
+	require.Nil(t, err)
+	decoded, err := decoder.Decode(encoded, bitLen)
+	require.Nil(t, err)
+	require.Equal(t, data, decoded)
+
+	// 逐个解码符号
+	symbol, n, err := decoder.DecodeSymbol(encoded, 0, bitLen)
+	require.Nil(t, err)
+	require.Equal(t, tokenIdent, symbol)
+	require.EqualValues(t, 1, n)
+	_, _, err = decoder.DecodeSymbol(encoded, bitLen, bitLen)
+	require.ErrorIs(t, err, ErrBitsExhausted)
+
+	_, _, err = table.Encode([]tokenKind{tokenKind(42)})
+	require.ErrorIs(t, err, ErrSymbolNotFound)
+
+	// 只有一个符号
+	single := NewEncTable(NewTree(SymbolFrequencies[string]{"go": 3}, Less[string]))
+	encoded, bitLen, err = single.Encode([]string{"go", "go", "go"})
+	require.Nil(t, err)
+	require.EqualValues(t, 3, bitLen)
+	decoded2, err := single.DecTable().Decode(encoded, bitLen)
+	require.Nil(t, err)
+	require.Equal(t, []string{"go", "go", "go"}, decoded2)
+
+	// 空的频数
+	empty := NewTree(SymbolFrequencies[string]{}, Less[string])
+	require.Nil(t, empty.Root)
+	require.Empty(t, NewEncTable(empty))
+}
+
+// 以结构体为符号，通过less指定顺序
+func TestTree_Comparable(t *testing.T) {
+	type point struct{ x, y int }
+	freq := SymbolFrequencies[point]{{0, 0}: 10, {1, 0}: 5, {0, 1}: 5, {1, 1}: 1}
+	less := func(a, b point) bool {
+		if a.x != b.x {
+			return a.x < b.x
+		}
+		return a.y < b.y
+	}
+
+	tree := NewTree(freq, less)
+	require.Equal(t, []point{{0, 0}, {0, 1}, {1, 0}, {1, 1}}, tree.Symbols())
+	// 相同的频数总是得到相同的编码
+	for i := 0; i < 10; i++ {
+		require.Equal(t, NewEncTable(tree), NewEncTable(NewTree(freq, less)))
+	}
+
+	_, err := NewEncTableFromSymbolLengths(tree.Symbols(), []uint8{1, 1, 1})
+	require.ErrorIs(t, err, ErrInvalidCodeLengths)
+	_, err = NewEncTableFromSymbolLengths(tree.Symbols(), []uint8{1, 1, 1, 1})
+	require.ErrorIs(t, err, ErrInvalidCodeLengths)
+}
+
+// byte版本和泛型版本得到相同的编码
+func TestTree_ByteWrapper(t *testing.T) {
+	data := mixedData(1 << 14)
+	freq := CountFrequencies(data)
+	expected := NewWideHuffmanEncTable(NewHuffmanTree(freq))
+
+	got := NewEncTable(NewTree(CountSymbolFrequencies(data), Less[byte]))
+	require.True(t, expected.Equals(WideHuffmanEncTable(got)))
+
+	canonical := NewCanonicalEncTable(NewTree(SymbolFrequencies[byte](freq), Less[byte]))
+	require.True(t, NewCanonicalHuffmanEncTable(NewHuffmanTree(freq)).Equals(WideHuffmanEncTable(canonical)))
+
+	compressed, bitLen, err := compressBytesWith(data, expected)
+	require.Nil(t, err)
+	decoded, err := EncTable[byte](expected).DecTable().Decode(compressed, bitLen)
+	require.Nil(t, err)
+	require.Equal(t, data, decoded)
+
+	// HuffmanTree的节点和Tree[byte]的节点结构相同
+	tree := NewTree(freq, Less[byte])
+	byteTree := NewHuffmanTree(freq)
+	require.Len(t, byteTree.Leaves, len(tree.Leaves))
+	for i, leaf := range tree.Leaves {
+		require.Equal(t, leaf.Symbol, byteTree.Leaves[i].Byte)
+		require.Equal(t, leaf.Code, byteTree.Leaves[i].WideCode)
+		require.Equal(t, leaf.depth(), byteTree.Leaves[i].depth())
+	}
+	require.Equal(t, tree.Root.Weight, byteTree.Root.Weight)
+	require.Equal(t, byteTree.CodeLengths(), byteCodeLengths(freq))
+}
@@ -0,0 +1,150 @@
+// Package hpack 实现了HTTP/2头部压缩（RFC 7541）中使用的静态Huffman编码
+//
+// RFC 7541附录B定义了一个固定的范式Huffman码表：字节0~255和EOS一共257个符号，编码最长30比特。
+// 这里只记录每个符号的编码长度，码表和解码器由huffman包中的泛型范式Huffman码表构建，
+// 超过24比特的编码使用WideHuffmanCode存储，比特流通过huffman.BitsWriter写出
+package hpack
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ryanreadbooks/go-huffman/huffman"
+)
+
+const (
+	// EOS 是结束符号，不能出现在编码后的字符串中，它的编码的最高若干位用作填充
+	EOS = 256
+	// SymbolNum 是码表中符号的数量
+	SymbolNum = 257
+	// MaxCodeBitLen 是码表中编码的最大比特长度
+	MaxCodeBitLen = 30
+	// maxPaddingBitLen 是字符串末尾最多的填充比特数
+	maxPaddingBitLen = 7
+)
+
+var (
+	ErrInvalidPadding = fmt.Errorf("invalid huffman padding")
+	ErrEOSDecoded     = fmt.Errorf("huffman EOS symbol decoded")
+)
+
+// codeLengths 是RFC 7541附录B中每个符号的编码长度，下标为符号，最后一个为EOS
+var codeLengths = [SymbolNum]uint8{
+	13, 23, 28, 28, 28, 28, 28, 28, 28, 24, 30, 28, 28, 30, 28, 28,
+	28, 28, 28, 28, 28, 28, 30, 28, 28, 28, 28, 28, 28, 28, 28, 28,
+	6, 10, 10, 12, 13, 6, 8, 11, 10, 10, 8, 11, 8, 6, 6, 6,
+	5, 5, 5, 6, 6, 6, 6, 6, 6, 6, 7, 8, 15, 6, 12, 10,
+	13, 6, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
+	7, 7, 7, 7, 7, 7, 7, 7, 8, 7, 8, 13, 19, 13, 14, 6,
+	15, 5, 6, 5, 6, 5, 6, 6, 6, 5, 7, 7, 6, 6, 6, 5,
+	6, 7, 6, 5, 5, 6, 7, 7, 7, 7, 7, 15, 11, 14, 13, 28,
+	20, 22, 20, 20, 22, 22, 22, 23, 22, 23, 23, 23, 23, 23, 24, 23,
+	24, 24, 22, 23, 24, 23, 23, 23, 23, 21, 22, 23, 22, 23, 23, 24,
+	22, 21, 20, 22, 22, 23, 23, 21, 23, 22, 22, 24, 21, 22, 23, 23,
+	21, 21, 22, 21, 23, 22, 23, 23, 20, 22, 22, 22, 23, 22, 22, 23,
+	26, 26, 20, 19, 22, 23, 22, 25, 26, 26, 26, 27, 27, 26, 24, 25,
+	19, 21, 26, 27, 27, 26, 27, 24, 21, 21, 26, 26, 28, 27, 27, 27,
+	20, 24, 20, 21, 22, 21, 21, 23, 22, 22, 25, 25, 24, 24, 26, 23,
+	26, 27, 26, 26, 27, 27, 27, 27, 27, 28, 27, 27, 27, 27, 27, 26,
+	30,
+}
+
+var (
+	// table 是静态Huffman编码表
+	table huffman.EncTable[uint16]
+	// values和bitLens是展开成以符号为下标的数组的编码表，避免在循环中查map
+	values  [SymbolNum]uint64
+	bitLens [SymbolNum]uint
+	decoder *huffman.Decoder[uint16]
+)
+
+func init() {
+	symbols := make([]uint16, SymbolNum)
+	for i := range symbols {
+		symbols[i] = uint16(i)
+	}
+	var err error
+	// 码表是固定的，构建失败说明编码长度有误
+	if table, err = huffman.NewEncTableFromSymbolLengths(symbols, codeLengths[:]); err != nil {
+		panic(err)
+	}
+	if decoder, err = huffman.NewDecoder(table.DecTable()); err != nil {
+		panic(err)
+	}
+	for s, code := range table {
+		values[s] = code.Value()
+		bitLens[s] = uint(code.BitLen())
+	}
+}
+
+// Table 返回静态Huffman编码表，调用方不能修改返回的码表
+func Table() huffman.EncTable[uint16] {
+	return table
+}
+
+// HuffmanEncodeLength 返回s编码后的字节数
+func HuffmanEncodeLength(s string) uint64 {
+	var n uint64 = 0
+	for i := 0; i < len(s); i++ {
+		n += uint64(bitLens[s[i]])
+	}
+	return (n + 7) / 8
+}
+
+// AppendHuffmanString 把s编码后追加到dst中并返回
+// 最后不足一个字节的部分用EOS编码的最高位（全为1）填充
+func AppendHuffmanString(dst []byte, s string) []byte {
+	w := huffman.NewBitsWriter()
+	for i := 0; i < len(s); i++ {
+		w.WriteBits(values[s[i]], bitLens[s[i]])
+	}
+	if pad := (8 - w.BitLen()%8) % 8; pad > 0 {
+		w.WriteBits(1<<pad-1, uint(pad))
+	}
+
+	return append(dst, w.Buf()...)
+}
+
+// HuffmanDecode 解码Huffman编码后的字符串
+// 填充超过7个比特、填充不全为1或者解码得到EOS时返回错误
+func HuffmanDecode(data []byte) ([]byte, error) {
+	ret := make([]byte, 0, len(data)*8/5)
+	bitLen := uint64(len(data)) * 8
+	var pos uint64 = 0
+	for pos < bitLen {
+		symbol, n, err := decoder.DecodeSymbol(data, pos, bitLen)
+		if errors.Is(err, huffman.ErrBitsExhausted) {
+			// 剩下的比特不足一个编码，只能是填充
+			if bitLen-pos > maxPaddingBitLen || !isPadding(data, pos) {
+				return nil, ErrInvalidPadding
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if symbol == EOS {
+			return nil, ErrEOSDecoded
+		}
+		ret = append(ret, byte(symbol))
+		pos += n
+	}
+
+	return ret, nil
+}
+
+// HuffmanDecodeToString 解码Huffman编码后的字符串
+func HuffmanDecodeToString(data []byte) (string, error) {
+	ret, err := HuffmanDecode(data)
+	if err != nil {
+		return "", err
+	}
+	return string(ret), nil
+}
+
+// isPadding 判断从第pos个比特开始到最后一个字节结束的比特是否全为1
+func isPadding(data []byte, pos uint64) bool {
+	last := data[len(data)-1]
+	mask := byte(1)<<(8-pos%8) - 1
+	return last&mask == mask
+}
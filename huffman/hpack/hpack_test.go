@@ -0,0 +1,98 @@
+package hpack
+
+import (
+	"encoding/hex"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 7541附录C.4和C.6中使用Huffman编码的字符串
+var rfcVectors = []struct {
+	s       string
+	encoded string
+}{
+	{"www.example.com", "f1e3c2e5f23a6ba0ab90f4ff"},
+	{"no-cache", "a8eb10649cbf"},
+	{"custom-key", "25a849e95ba97d7f"},
+	{"custom-value", "25a849e95bb8e8b4bf"},
+	{"302", "6402"},
+	{"private", "aec3771a4b"},
+	{"Mon, 21 Oct 2013 20:13:21 GMT", "d07abe941054d444a8200595040b8166e082a62d1bff"},
+	{"https://www.example.com", "9d29ad171863c78f0b97c8e9ae82ae43d3"},
+	{"307", "640eff"},
+	{"Mon, 21 Oct 2013 20:13:22 GMT", "d07abe941054d444a8200595040b8166e084a62d1bff"},
+	{"gzip", "9bd9ab"},
+	{"foo=ASDJKHQKBZXOQWEOPIUAXQWEOIU; max-age=3600; version=1", "94e7821dd7f2e6c7b335dfdfcd5b3960d5af27087f3672c1ab270fb5291f9587316065c003ed4ee5b1063d5007"},
+}
+
+func TestTable(t *testing.T) {
+	require.Len(t, Table(), SymbolNum)
+	// RFC 7541附录B中的部分编码
+	require.Equal(t, "00000", Table().Get('0').String())
+	require.Equal(t, "1111111111000", Table().Get(0).String())
+	require.Equal(t, "111111111111111111111111111111", Table().Get(EOS).String())
+	require.Equal(t, MaxCodeBitLen, Table().Get(EOS).BitLen())
+	require.EqualValues(t, 0x3ffffee, Table().Get(255).Value())
+	require.Equal(t, 26, Table().Get(255).BitLen())
+}
+
+func TestHuffmanEncode_RFC(t *testing.T) {
+	for _, v := range rfcVectors {
+		encoded := AppendHuffmanString(nil, v.s)
+		require.Equal(t, v.encoded, hex.EncodeToString(encoded), v.s)
+		require.EqualValues(t, len(encoded), HuffmanEncodeLength(v.s))
+
+		got, err := HuffmanDecodeToString(encoded)
+		require.Nil(t, err)
+		require.Equal(t, v.s, got)
+	}
+
+	// 追加到已有的数据后面
+	require.Equal(t, []byte{0x01, 0x64, 0x02}, AppendHuffmanString([]byte{0x01}, "302"))
+}
+
+func TestHuffmanDecode_AllBytes(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		b := make([]byte, rnd.Intn(200))
+		rnd.Read(b)
+		got, err := HuffmanDecode(AppendHuffmanString(nil, string(b)))
+		require.Nil(t, err)
+		require.Equal(t, string(b), string(got))
+	}
+
+	got, err := HuffmanDecode(nil)
+	require.Nil(t, err)
+	require.Empty(t, got)
+}
+
+func TestHuffmanDecode_Invalid(t *testing.T) {
+	// 填充超过7个比特
+	_, err := HuffmanDecode([]byte{0xff})
+	require.ErrorIs(t, err, ErrInvalidPadding)
+	encoded := AppendHuffmanString(nil, "302")
+	_, err = HuffmanDecode(append(encoded, 0xff))
+	require.ErrorIs(t, err, ErrInvalidPadding)
+
+	// 填充不全为1：'a'的编码为00011，后面填充000
+	_, err = HuffmanDecode([]byte{0x18})
+	require.ErrorIs(t, err, ErrInvalidPadding)
+	got, err := HuffmanDecodeToString([]byte{0x1f})
+	require.Nil(t, err)
+	require.Equal(t, "a", got)
+
+	// EOS
+	_, err = HuffmanDecode([]byte{0xff, 0xff, 0xff, 0xfc})
+	require.ErrorIs(t, err, ErrEOSDecoded)
+	_, err = HuffmanDecode([]byte{0xff, 0xff, 0xff, 0xff})
+	require.ErrorIs(t, err, ErrEOSDecoded)
+
+	// 30比特的编码
+	long := strings.Repeat("\n", 3)
+	got, err = HuffmanDecodeToString(AppendHuffmanString(nil, long))
+	require.Nil(t, err)
+	require.Equal(t, long, got)
+}
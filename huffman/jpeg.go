@@ -0,0 +1,329 @@
+package huffman
+
+import (
+	"fmt"
+	"sort"
+)
+
+// JPEG的Huffman表：JPEG在DHT段中用BITS和HUFFVAL两个数组描述一张范式Huffman表，
+// BITS[i]为长度为i+1的编码数量（最长16比特），HUFFVAL按照编码从小到大的顺序列出每个编码对应的符号。
+// 和NewEncTableFromLengths不同，长度相同的符号按照在HUFFVAL中的顺序分配编码，不要求按字节从小到大排列。
+// JPEG还要求编码不能全为1（全1的比特串保留给填充），因此合法的表总会空出最后一个编码。
+//
+// DHT段的格式如下：（大端序）
+//   - MARKER						2 bytes (0xFFC4)
+//   - LENGTH						2 bytes (uint16) 包括LENGTH本身在内的段长度
+//   - 每张表：
+//   - CLASS | ID					1 byte 高4位为表的类别（0为DC表，1为AC表），低4位为表的编号
+//   - BITS						16 bytes
+//   - HUFFVAL					sum(BITS) bytes
+
+const (
+	// MaxJPEGCodeBitLen 是JPEG Huffman编码的最大比特长度
+	MaxJPEGCodeBitLen = 16
+	// JPEGDHTMarker 是DHT段的标记
+	JPEGDHTMarker uint16 = 0xFFC4
+)
+
+// JPEG Huffman表的类别
+const (
+	JPEGClassDC byte = 0
+	JPEGClassAC byte = 1
+)
+
+const (
+	// maxJPEGTableID 是Huffman表编号的最大值
+	maxJPEGTableID = 3
+	// jpegReservedSymbol 是生成码表时用来占用全1编码的虚拟符号
+	jpegReservedSymbol uint16 = MaxSymbolNum
+)
+
+var (
+	ErrInvalidJPEGTable   = fmt.Errorf("invalid jpeg huffman table")
+	ErrJPEGCodeTooLong    = fmt.Errorf("jpeg huffman code exceeds %d bits", MaxJPEGCodeBitLen)
+	ErrJPEGNotCanonical   = fmt.Errorf("codes are not assigned in jpeg canonical order")
+	ErrInvalidDHTSegment  = fmt.Errorf("invalid dht segment")
+	ErrTooManyJPEGSymbols = fmt.Errorf("jpeg huffman table has more than %d symbols", MaxSymbolNum)
+)
+
+// JPEGTable 是JPEG DHT段中的一张Huffman表
+type JPEGTable struct {
+	Class   byte                    // 表的类别，JPEGClassDC或者JPEGClassAC
+	ID      byte                    // 表的编号，0~3
+	Bits    [MaxJPEGCodeBitLen]byte // Bits[i]为长度为i+1的编码数量
+	HuffVal []byte                  // 按照编码从小到大排列的符号
+}
+
+// EncTable 根据BITS和HUFFVAL创建编码表
+func (t *JPEGTable) EncTable() (WideHuffmanEncTable, error) {
+	codes, err := t.codes()
+	if err != nil {
+		return nil, err
+	}
+
+	return WideHuffmanEncTable(codes), nil
+}
+
+// DecTable 根据BITS和HUFFVAL创建解码表
+func (t *JPEGTable) DecTable() (WideHuffmanDecTable, error) {
+	codes, err := t.codes()
+	if err != nil {
+		return nil, err
+	}
+
+	return WideHuffmanDecTable(codes.DecTable()), nil
+}
+
+// HuffmanEncTable 根据BITS和HUFFVAL创建编码表，JPEG的编码不超过MaxJPEGCodeBitLen比特，总是可以使用24位的HuffmanCode
+func (t *JPEGTable) HuffmanEncTable() (HuffmanEncTable, error) {
+	codes, err := t.codes()
+	if err != nil {
+		return nil, err
+	}
+
+	table := make(HuffmanEncTable, len(codes))
+	for v, code := range codes {
+		table[v] = newHuffmanCode(uint32(code.Value()), code.BitLen())
+	}
+	return table, nil
+}
+
+// HuffmanDecTable 根据BITS和HUFFVAL创建解码表，和HuffmanEncTable得到的编码表对应
+func (t *JPEGTable) HuffmanDecTable() (HuffmanDecTable, error) {
+	codes, err := t.codes()
+	if err != nil {
+		return nil, err
+	}
+
+	table := make(HuffmanDecTable, len(codes))
+	for v, code := range codes {
+		table[*newHuffmanCode(uint32(code.Value()), code.BitLen())] = v
+	}
+	return table, nil
+}
+
+// codes 检查BITS和HUFFVAL是否合法，并按照JPEG的规则分配编码
+func (t *JPEGTable) codes() (EncTable[byte], error) {
+	var count int
+	lengths := make([]uint8, 0, len(t.HuffVal))
+	for i, n := range t.Bits {
+		count += int(n)
+		for j := 0; j < int(n); j++ {
+			lengths = append(lengths, uint8(i+1))
+		}
+	}
+	if count > MaxSymbolNum {
+		return nil, ErrTooManyJPEGSymbols
+	}
+	if count != len(t.HuffVal) {
+		return nil, fmt.Errorf("%w: BITS has %d codes but HUFFVAL has %d symbols", ErrInvalidJPEGTable, count, len(t.HuffVal))
+	}
+
+	var seen [MaxSymbolNum]bool
+	for _, v := range t.HuffVal {
+		if seen[v] {
+			return nil, fmt.Errorf("%w: duplicate symbol %d", ErrInvalidJPEGTable, v)
+		}
+		seen[v] = true
+	}
+
+	codes, err := NewEncTableFromSymbolLengths(t.HuffVal, lengths)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJPEGTable, err)
+	}
+	for v, code := range codes {
+		if code.Value() == 1<<code.BitLen()-1 {
+			return nil, fmt.Errorf("%w: all-ones code for symbol %d", ErrInvalidJPEGTable, v)
+		}
+	}
+
+	return codes, nil
+}
+
+// NewJPEGEncTable 根据每个字节的频数生成可以写入DHT段的编码表
+// 编码长度不超过MaxJPEGCodeBitLen，并且按照JPEG标准附录K.2的做法给一个虚拟符号分配频数1，占用全1的编码
+func NewJPEGEncTable(freq Frequencies) WideHuffmanEncTable {
+	if len(freq) == 0 {
+		return make(WideHuffmanEncTable)
+	}
+
+	symbolFreq := make(SymbolFrequencies[uint16], len(freq)+1)
+	for b, f := range freq {
+		symbolFreq[uint16(b)] = f
+	}
+	symbolFreq[jpegReservedSymbol] = 1
+
+	tree := NewTree(symbolFreq, Less[uint16], MaxJPEGCodeBitLen)
+	lengths := tree.CodeLengths()
+	// 虚拟符号排在最后，只要它的编码长度最长就会分配到全1的编码
+	// 频数最小的符号在最优编码中的长度一定是最长的，长度不是最长时只可能和频数同样小的符号并列，交换长度不会增加编码长度
+	reserved := len(lengths) - 1
+	longest := reserved
+	for i, l := range lengths {
+		if l > lengths[longest] {
+			longest = i
+		}
+	}
+	lengths[reserved], lengths[longest] = lengths[longest], lengths[reserved]
+
+	symbols := make([]byte, 0, reserved)
+	for _, s := range tree.Symbols()[:reserved] {
+		symbols = append(symbols, byte(s))
+	}
+	table, err := NewEncTableFromSymbolLengths(symbols, lengths[:reserved])
+	if err != nil {
+		// Huffman树得到的编码长度一定是合法的
+		panic(err)
+	}
+
+	return WideHuffmanEncTable(table)
+}
+
+// JPEGTable 把编码表转换成BITS和HUFFVAL，返回的表Class和ID均为0
+// 编码长度超过MaxJPEGCodeBitLen时返回ErrJPEGCodeTooLong，编码不是按照JPEG的规则分配时返回ErrJPEGNotCanonical
+func (h HuffmanEncTable) JPEGTable() (*JPEGTable, error) {
+	return encJPEGTable(h)
+}
+
+// JPEGTable 把解码表转换成BITS和HUFFVAL，和对应的编码表调用JPEGTable得到的结果一致
+func (h HuffmanDecTable) JPEGTable() (*JPEGTable, error) {
+	return decJPEGTable(h)
+}
+
+// JPEGTable 把编码表转换成BITS和HUFFVAL，返回的表Class和ID均为0
+// 编码长度超过MaxJPEGCodeBitLen时返回ErrJPEGCodeTooLong，编码不是按照JPEG的规则分配时返回ErrJPEGNotCanonical
+func (h WideHuffmanEncTable) JPEGTable() (*JPEGTable, error) {
+	return encJPEGTable(h)
+}
+
+// JPEGTable 把解码表转换成BITS和HUFFVAL，和对应的编码表调用JPEGTable得到的结果一致
+func (h WideHuffmanDecTable) JPEGTable() (*JPEGTable, error) {
+	return decJPEGTable(h)
+}
+
+// encJPEGTable 把编码表中的编码按字节收集起来转换成JPEGTable
+func encJPEGTable(table ByteEncTable) (*JPEGTable, error) {
+	codes := make(map[byte]HuffmanCodeInterface, table.ItemNum())
+	for i := 0; i < MaxSymbolNum; i++ {
+		if code, ok := table.Code(byte(i)); ok {
+			codes[byte(i)] = code
+		}
+	}
+
+	return newJPEGTable(codes)
+}
+
+// decJPEGTable 把解码表中的编码按字节收集起来转换成JPEGTable
+func decJPEGTable(table ByteDecTable) (*JPEGTable, error) {
+	codes := make(map[byte]HuffmanCodeInterface, table.ItemNum())
+	table.Range(func(code HuffmanCodeInterface, b byte) {
+		codes[b] = code
+	})
+
+	return newJPEGTable(codes)
+}
+
+// newJPEGTable 按照(编码长度, 编码)的顺序排列符号得到HUFFVAL，再检查编码是否和JPEG分配的编码相同
+func newJPEGTable(codes map[byte]HuffmanCodeInterface) (*JPEGTable, error) {
+	t := &JPEGTable{HuffVal: make([]byte, 0, len(codes))}
+	for v, code := range codes {
+		if code.BitLen() == 0 {
+			return nil, fmt.Errorf("%w: empty code for symbol %d", ErrInvalidJPEGTable, v)
+		}
+		if code.BitLen() > MaxJPEGCodeBitLen {
+			return nil, fmt.Errorf("%w: symbol %d has %d bits", ErrJPEGCodeTooLong, v, code.BitLen())
+		}
+		t.Bits[code.BitLen()-1]++
+		t.HuffVal = append(t.HuffVal, v)
+	}
+	sort.Slice(t.HuffVal, func(i, j int) bool {
+		a, b := codes[t.HuffVal[i]], codes[t.HuffVal[j]]
+		if a.BitLen() != b.BitLen() {
+			return a.BitLen() < b.BitLen()
+		}
+		return a.Value() < b.Value()
+	})
+
+	expected, err := t.codes()
+	if err != nil {
+		return nil, err
+	}
+	for v, code := range codes {
+		if expected[v].Value() != code.Value() {
+			return nil, fmt.Errorf("%w: symbol %d", ErrJPEGNotCanonical, v)
+		}
+	}
+
+	return t, nil
+}
+
+// AppendDHT 把tables编码为一个完整的DHT段追加到buf后面
+func AppendDHT(buf []byte, tables ...*JPEGTable) ([]byte, error) {
+	length := Uint16ByteSize
+	for _, t := range tables {
+		if t.Class > JPEGClassAC || t.ID > maxJPEGTableID {
+			return nil, fmt.Errorf("%w: class %d id %d", ErrInvalidJPEGTable, t.Class, t.ID)
+		}
+		if _, err := t.codes(); err != nil {
+			return nil, err
+		}
+		length += 1 + MaxJPEGCodeBitLen + len(t.HuffVal)
+	}
+	if length > 0xFFFF {
+		return nil, fmt.Errorf("%w: segment of %d bytes", ErrInvalidDHTSegment, length)
+	}
+
+	buf = writeUint16ToBytes(JPEGDHTMarker, buf)
+	buf = writeUint16ToBytes(uint16(length), buf)
+	for _, t := range tables {
+		buf = append(buf, t.Class<<4|t.ID)
+		buf = append(buf, t.Bits[:]...)
+		buf = append(buf, t.HuffVal...)
+	}
+
+	return buf, nil
+}
+
+// ParseDHT 解析一个以0xFFC4开头的DHT段，返回其中的所有Huffman表
+// data可以比DHT段更长，多余的字节会被忽略
+func ParseDHT(data []byte) ([]*JPEGTable, error) {
+	marker, err := readNextUint16(data, 0)
+	if err != nil || marker != JPEGDHTMarker {
+		return nil, fmt.Errorf("%w: missing marker", ErrInvalidDHTSegment)
+	}
+	length, err := readNextUint16(data, Uint16ByteSize)
+	if err != nil || int(length) < Uint16ByteSize || Uint16ByteSize+int(length) > len(data) {
+		return nil, fmt.Errorf("%w: bad length", ErrInvalidDHTSegment)
+	}
+
+	segment := data[2*Uint16ByteSize : Uint16ByteSize+int(length)]
+	var tables []*JPEGTable
+	for len(segment) > 0 {
+		if len(segment) < 1+MaxJPEGCodeBitLen {
+			return nil, fmt.Errorf("%w: truncated table", ErrInvalidDHTSegment)
+		}
+		t := &JPEGTable{Class: segment[0] >> 4, ID: segment[0] & 0x0F}
+		if t.Class > JPEGClassAC || t.ID > maxJPEGTableID {
+			return nil, fmt.Errorf("%w: class %d id %d", ErrInvalidJPEGTable, t.Class, t.ID)
+		}
+		copy(t.Bits[:], segment[1:1+MaxJPEGCodeBitLen])
+		segment = segment[1+MaxJPEGCodeBitLen:]
+
+		count := 0
+		for _, n := range t.Bits {
+			count += int(n)
+		}
+		if count > len(segment) {
+			return nil, fmt.Errorf("%w: truncated table", ErrInvalidDHTSegment)
+		}
+		t.HuffVal = append([]byte(nil), segment[:count]...)
+		segment = segment[count:]
+
+		if _, err := t.codes(); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+
+	return tables, nil
+}
@@ -0,0 +1,218 @@
+package huffman
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// JPEG标准附录K中亮度分量的DC表
+var jpegLuminanceDC = &JPEGTable{
+	Bits:    [MaxJPEGCodeBitLen]byte{0, 1, 5, 1, 1, 1, 1, 1, 1},
+	HuffVal: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+}
+
+func TestJPEGTable_EncTable(t *testing.T) {
+	table, err := jpegLuminanceDC.EncTable()
+	require.Nil(t, err)
+	require.Len(t, table, 12)
+	expected := []string{"00", "010", "011", "100", "101", "110", "1110", "11110",
+		"111110", "1111110", "11111110", "111111110"}
+	for i, s := range expected {
+		require.Equal(t, s, table.Get(byte(i)).String())
+	}
+
+	decTable, err := jpegLuminanceDC.DecTable()
+	require.Nil(t, err)
+	require.Equal(t, WideHuffmanDecTable(EncTable[byte](table).DecTable()), decTable)
+
+	data := []byte{0, 11, 5, 5, 3, 7, 0, 1, 2}
+	compressed, bitLen, err := compressBytesWith(data, table)
+	require.Nil(t, err)
+	recovered, err := decompressBytesWith(compressed, bitLen, decTable)
+	require.Nil(t, err)
+	require.Equal(t, data, recovered)
+
+	got, err := table.JPEGTable()
+	require.Nil(t, err)
+	require.Equal(t, jpegLuminanceDC, got)
+	got, err = decTable.JPEGTable()
+	require.Nil(t, err)
+	require.Equal(t, jpegLuminanceDC, got)
+
+	// 24位编码的码表和宽编码的码表一致
+	narrow, err := jpegLuminanceDC.HuffmanEncTable()
+	require.Nil(t, err)
+	require.Equal(t, table, narrow.Wide())
+	narrowDec, err := jpegLuminanceDC.HuffmanDecTable()
+	require.Nil(t, err)
+	require.Equal(t, decTable, narrowDec.Wide())
+	compressed, bitLen, err = compressBytesWith(data, narrow)
+	require.Nil(t, err)
+	recovered, err = decompressBytesWith(compressed, bitLen, narrowDec)
+	require.Nil(t, err)
+	require.Equal(t, data, recovered)
+
+	got, err = narrow.JPEGTable()
+	require.Nil(t, err)
+	require.Equal(t, jpegLuminanceDC, got)
+	got, err = narrowDec.JPEGTable()
+	require.Nil(t, err)
+	require.Equal(t, jpegLuminanceDC, got)
+}
+
+func TestJPEGTable_HuffValOrder(t *testing.T) {
+	// 长度相同的符号按照HUFFVAL中的顺序分配编码，而不是按照字节大小
+	jt := &JPEGTable{
+		Bits:    [MaxJPEGCodeBitLen]byte{0, 3},
+		HuffVal: []byte{9, 3, 6},
+	}
+	table, err := jt.EncTable()
+	require.Nil(t, err)
+	require.Equal(t, "00", table.Get(9).String())
+	require.Equal(t, "01", table.Get(3).String())
+	require.Equal(t, "10", table.Get(6).String())
+
+	got, err := table.JPEGTable()
+	require.Nil(t, err)
+	require.Equal(t, jt, got)
+}
+
+func TestJPEGTable_Invalid(t *testing.T) {
+	cases := []struct {
+		table *JPEGTable
+		err   error
+	}{
+		// BITS和HUFFVAL的数量不一致
+		{&JPEGTable{Bits: [MaxJPEGCodeBitLen]byte{0, 2}, HuffVal: []byte{1}}, ErrInvalidJPEGTable},
+		// 重复的符号
+		{&JPEGTable{Bits: [MaxJPEGCodeBitLen]byte{0, 2}, HuffVal: []byte{1, 1}}, ErrInvalidJPEGTable},
+		// 编码空间不够
+		{&JPEGTable{Bits: [MaxJPEGCodeBitLen]byte{3}, HuffVal: []byte{1, 2, 3}}, ErrInvalidJPEGTable},
+		// 全1的编码
+		{&JPEGTable{Bits: [MaxJPEGCodeBitLen]byte{1, 2}, HuffVal: []byte{1, 2, 3}}, ErrInvalidJPEGTable},
+		// 符号太多
+		{&JPEGTable{Bits: [MaxJPEGCodeBitLen]byte{15: 255, 14: 2}, HuffVal: make([]byte, 257)}, ErrTooManyJPEGSymbols},
+	}
+	for _, c := range cases {
+		_, err := c.table.EncTable()
+		require.ErrorIs(t, err, c.err)
+		_, err = c.table.DecTable()
+		require.ErrorIs(t, err, c.err)
+		_, err = c.table.HuffmanEncTable()
+		require.ErrorIs(t, err, c.err)
+		_, err = c.table.HuffmanDecTable()
+		require.ErrorIs(t, err, c.err)
+		_, err = AppendDHT(nil, c.table)
+		require.ErrorIs(t, err, c.err)
+	}
+}
+
+func TestHuffmanEncTable_JPEGTable(t *testing.T) {
+	// 斐波那契频数使得编码长度超过16比特
+	freq := make(Frequencies)
+	var a, b uint64 = 1, 1
+	for i := 0; i < 20; i++ {
+		freq[byte(i)] = a
+		a, b = b, a+b
+	}
+	table := NewCanonicalHuffmanEncTable(NewHuffmanTree(freq))
+	_, err := table.JPEGTable()
+	require.ErrorIs(t, err, ErrJPEGCodeTooLong)
+	narrow, err := NewHuffmanEncTable(NewHuffmanTree(freq))
+	require.Nil(t, err)
+	_, err = narrow.JPEGTable()
+	require.ErrorIs(t, err, ErrJPEGCodeTooLong)
+	narrowDec := make(HuffmanDecTable, len(narrow))
+	for b, code := range narrow {
+		narrowDec[*code] = b
+	}
+	_, err = narrowDec.JPEGTable()
+	require.ErrorIs(t, err, ErrJPEGCodeTooLong)
+
+	// 长度短的编码反而更大，不是JPEG的分配方式
+	table = WideHuffmanEncTable{'a': newCode(0b1, 1), 'b': newCode(0b00, 2)}
+	_, err = table.JPEGTable()
+	require.ErrorIs(t, err, ErrJPEGNotCanonical)
+	_, err = HuffmanEncTable{'a': newHuffmanCode(0b1, 1), 'b': newHuffmanCode(0b00, 2)}.JPEGTable()
+	require.ErrorIs(t, err, ErrJPEGNotCanonical)
+
+	// 完整的Huffman编码包含全1的编码
+	table = WideHuffmanEncTable{'a': newCode(0b0, 1), 'b': newCode(0b1, 1)}
+	_, err = table.JPEGTable()
+	require.ErrorIs(t, err, ErrInvalidJPEGTable)
+}
+
+func TestNewJPEGEncTable(t *testing.T) {
+	freq := make(Frequencies)
+	var a, b uint64 = 1, 1
+	for i := 0; i < 40; i++ {
+		freq[byte(i)] = a
+		a, b = b, a+b
+	}
+	for i := 40; i < MaxSymbolNum; i++ {
+		freq[byte(i)] = uint64(i)
+	}
+
+	table := NewJPEGEncTable(freq)
+	require.Len(t, table, MaxSymbolNum)
+	for _, code := range table {
+		require.LessOrEqual(t, code.BitLen(), MaxJPEGCodeBitLen)
+		require.NotEqual(t, uint64(1)<<code.BitLen()-1, code.Value())
+	}
+
+	jt, err := table.JPEGTable()
+	require.Nil(t, err)
+	recovered, err := jt.EncTable()
+	require.Nil(t, err)
+	require.Equal(t, table, recovered)
+
+	// 只有一个符号时也要空出全1的编码
+	table = NewJPEGEncTable(Frequencies{'x': 10})
+	require.Equal(t, "0", table.Get('x').String())
+	require.Len(t, NewJPEGEncTable(Frequencies{}), 0)
+}
+
+func TestParseDHT(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7)
+	}
+	var out bytes.Buffer
+	require.Nil(t, jpeg.Encode(&out, img, nil))
+
+	// image/jpeg把标准的四张表写在同一个DHT段中
+	data := out.Bytes()
+	start := bytes.Index(data, []byte{0xFF, 0xC4})
+	require.Greater(t, start, 0)
+	tables, err := ParseDHT(data[start:])
+	require.Nil(t, err)
+	require.Len(t, tables, 4)
+	require.Equal(t, jpegLuminanceDC.Bits, tables[0].Bits)
+	require.Equal(t, jpegLuminanceDC.HuffVal, tables[0].HuffVal)
+	require.Equal(t, JPEGClassDC, tables[0].Class)
+	require.Equal(t, JPEGClassAC, tables[1].Class)
+	require.Equal(t, byte(1), tables[2].ID)
+
+	for _, jt := range tables {
+		table, err := jt.EncTable()
+		require.Nil(t, err)
+		got, err := table.JPEGTable()
+		require.Nil(t, err)
+		require.Equal(t, jt.Bits, got.Bits)
+		require.Equal(t, jt.HuffVal, got.HuffVal)
+	}
+
+	// 重新编码得到相同的DHT段
+	segment, err := AppendDHT(nil, tables...)
+	require.Nil(t, err)
+	require.Equal(t, data[start:start+len(segment)], segment)
+
+	_, err = ParseDHT(segment[:len(segment)-1])
+	require.ErrorIs(t, err, ErrInvalidDHTSegment)
+	_, err = ParseDHT([]byte{0xFF, 0xD8, 0, 2})
+	require.ErrorIs(t, err, ErrInvalidDHTSegment)
+}
@@ -0,0 +1,112 @@
+package huffman
+
+import "sort"
+
+// packageItem 是package-merge算法中的一个元素
+// 叶子元素的leaf为叶子节点的下标，打包元素的leaf为-1并通过left和right指向被打包的两个元素
+type packageItem struct {
+	weight uint64
+	leaf   int
+	left   *packageItem
+	right  *packageItem
+}
+
+// limitedCodeLengths 计算所有叶子节点长度受限的最优编码长度
+// weights为按符号顺序排列的叶子节点的权重，返回的切片与weights一一对应
+func limitedCodeLengths(weights []uint64, maxBitLen int) []int {
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	// 按权重升序排列，权重相同时按符号顺序排序保证结果确定
+	sort.Slice(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if weights[a] != weights[b] {
+			return weights[a] < weights[b]
+		}
+		return a < b
+	})
+
+	sortedWeights := make([]uint64, len(order))
+	for i, idx := range order {
+		sortedWeights[i] = weights[idx]
+	}
+
+	sortedLengths := packageMerge(sortedWeights, maxBitLen)
+	lengths := make([]int, len(weights))
+	for i, idx := range order {
+		lengths[idx] = sortedLengths[i]
+	}
+
+	return lengths
+}
+
+// packageMerge 使用package-merge算法计算长度不超过maxBitLen的最优编码长度
+// weights必须按升序排列，并且len(weights) <= 1<<maxBitLen
+//
+// 算法思路：每个符号在每一层都有一枚面值为其权重的硬币，
+// 从最深一层开始，把当前层的元素两两打包后与上一层的叶子元素合并排序，重复maxBitLen-1次，
+// 最后选出权重最小的2n-2个元素，每个符号被选中的次数就是它的编码长度
+func packageMerge(weights []uint64, maxBitLen int) []int {
+	n := len(weights)
+	lengths := make([]int, n)
+	if n == 1 {
+		lengths[0] = 1
+		return lengths
+	}
+
+	leafItems := make([]*packageItem, n)
+	for i, w := range weights {
+		leafItems[i] = &packageItem{weight: w, leaf: i}
+	}
+
+	cur := leafItems
+	for level := 1; level < maxBitLen; level++ {
+		// 两两打包，多出来的一个元素直接丢弃
+		packages := make([]*packageItem, 0, len(cur)/2)
+		for i := 0; i+1 < len(cur); i += 2 {
+			packages = append(packages, &packageItem{
+				weight: cur[i].weight + cur[i+1].weight,
+				leaf:   -1,
+				left:   cur[i],
+				right:  cur[i+1],
+			})
+		}
+		cur = mergePackageItems(leafItems, packages)
+	}
+
+	for _, item := range cur[:2*n-2] {
+		countPackageItem(item, lengths)
+	}
+
+	return lengths
+}
+
+// mergePackageItems 合并两个已经按权重升序排列的元素序列，权重相同时叶子元素优先
+func mergePackageItems(leafItems, packages []*packageItem) []*packageItem {
+	merged := make([]*packageItem, 0, len(leafItems)+len(packages))
+	i, j := 0, 0
+	for i < len(leafItems) && j < len(packages) {
+		if leafItems[i].weight <= packages[j].weight {
+			merged = append(merged, leafItems[i])
+			i++
+		} else {
+			merged = append(merged, packages[j])
+			j++
+		}
+	}
+	merged = append(merged, leafItems[i:]...)
+	merged = append(merged, packages[j:]...)
+
+	return merged
+}
+
+// countPackageItem 统计元素中包含的每个叶子元素的次数
+func countPackageItem(item *packageItem, lengths []int) {
+	if item.leaf >= 0 {
+		lengths[item.leaf]++
+		return
+	}
+	countPackageItem(item.left, lengths)
+	countPackageItem(item.right, lengths)
+}
@@ -0,0 +1,57 @@
+package huffman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// kraftSum 计算sum(2^(maxBitLen-l))，完整的前缀码应该刚好等于2^maxBitLen
+func kraftSum(lengths []int, maxBitLen int) uint64 {
+	var sum uint64 = 0
+	for _, l := range lengths {
+		sum += 1 << (maxBitLen - l)
+	}
+	return sum
+}
+
+func TestPackageMerge(t *testing.T) {
+	testCases := []struct {
+		Weights   []uint64
+		MaxBitLen int
+		Expect    []int
+	}{
+		{Weights: []uint64{1, 1}, MaxBitLen: 1, Expect: []int{1, 1}},
+		{Weights: []uint64{1, 2, 4, 8}, MaxBitLen: 3, Expect: []int{3, 3, 2, 1}},
+		{Weights: []uint64{1, 2, 4, 8}, MaxBitLen: 2, Expect: []int{2, 2, 2, 2}},
+		{Weights: []uint64{1, 1, 2, 3, 5, 8, 13, 21}, MaxBitLen: 4, Expect: []int{4, 4, 4, 4, 3, 3, 2, 2}},
+	}
+
+	for _, tc := range testCases {
+		lengths := packageMerge(tc.Weights, tc.MaxBitLen)
+		require.EqualValues(t, tc.Expect, lengths)
+		require.EqualValues(t, uint64(1)<<tc.MaxBitLen, kraftSum(lengths, tc.MaxBitLen))
+	}
+}
+
+// 限制足够宽松时，package-merge的带权路径长度应该和普通Huffman树一致
+func TestPackageMerge_SameAsHuffman(t *testing.T) {
+	freq := Frequencies{' ': 20, 'a': 40, 'm': 10, 'l': 7, 'f': 8, 't': 15, 'x': 1, 'y': 2}
+	_, leaves := ConstructHuffmanTree(freq)
+
+	huffmanCost := 0
+	for _, leaf := range leaves {
+		huffmanCost += leaf.WeightLength()
+	}
+
+	weights := make([]uint64, len(leaves))
+	for i, leaf := range leaves {
+		weights[i] = leaf.Weight
+	}
+	lengths := limitedCodeLengths(weights, MaxHuffmanCodeBitLen)
+	limitedCost := 0
+	for i, leaf := range leaves {
+		limitedCost += int(leaf.Weight) * lengths[i]
+	}
+	require.Equal(t, huffmanCost, limitedCost)
+}
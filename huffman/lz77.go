@@ -0,0 +1,413 @@
+package huffman
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+// LZ77：在32KiB的滑动窗口中查找重复出现的字符串，用（长度，距离）代替重复的部分，
+// 得到的字面量、匹配长度和匹配距离使用DEFLATE的符号划分，分别用单独的Huffman码表编码：
+//   - 字面量/长度码表				符号0~255为字面量，256保留（DEFLATE中为块结束），257~285为长度码，长度码后面跟着额外比特
+//   - 距离码表					符号0~29为距离码，距离码后面跟着额外比特
+//
+// 匹配查找使用哈希链：每个位置以接下来3个字节的哈希值插入哈希链，查找时沿着哈希链比较窗口内的候选位置，
+// 并且延迟一个字节选择匹配（下一个位置的匹配更长时当前位置输出字面量）。每个块单独查找匹配，不会引用之前的块
+//
+// BlockTypeLZ77的码表（LZ77 TABLES）格式如下：
+//   - LITLEN CODE LEN				每个4比特，高4位在前，一共lz77LitLenSymbolNum / 2 = 143 bytes
+//   - DIST CODE LEN				每个4比特，高4位在前，一共lz77DistSymbolNum / 2 = 15 bytes
+//
+// DATA中每个字面量为字面量/长度码表中的编码；每个匹配为长度码、长度的额外比特、距离码、距离的额外比特，额外比特高位在前
+const (
+	lz77WindowSize = 1 << 15
+	lz77MinMatch   = 3
+	lz77MaxMatch   = 258
+	lz77HashBits   = 15
+	// lz77MaxChain 是每次查找最多比较的候选位置数量
+	lz77MaxChain = 128
+	// lz77NiceMatch 是足够长的匹配，找到后不再继续查找，也不再尝试延迟匹配
+	lz77NiceMatch = 128
+	// lz77MaxBitLen 是字面量/长度码表和距离码表的最大编码长度，和DEFLATE相同
+	lz77MaxBitLen = 15
+	// lz77MaxLengthExtra和lz77MaxDistExtra 是长度和距离的最大额外比特数
+	lz77MaxLengthExtra = 5
+	lz77MaxDistExtra   = 13
+	// lz77MaxBitsPerByte 是每个原始字节最多使用的比特数：字面量最多lz77MaxBitLen比特，
+	// 匹配最多为长度码、距离码和两部分额外比特，分摊到至少lz77MinMatch个字节上后向上取整，结果不小于字面量的比特数
+	lz77MaxBitsPerByte = (2*lz77MaxBitLen + lz77MaxLengthExtra + lz77MaxDistExtra + lz77MinMatch - 1) / lz77MinMatch
+
+	lz77EndOfBlock      = 256
+	lz77LitLenSymbolNum = 286
+	lz77DistSymbolNum   = 30
+)
+
+var (
+	// 长度码257~285对应的最小长度和额外比特数
+	lz77LengthBase  = [...]uint16{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lz77LengthExtra = [...]uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	// 距离码0~29对应的最小距离和额外比特数
+	lz77DistBase  = [...]uint16{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	lz77DistExtra = [...]uint8{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+
+	// 以长度和距离为下标的长度码（不含257）和距离码
+	lz77LengthCodes = codeIndex(lz77LengthBase[:], lz77MaxMatch)
+	lz77DistCodes   = codeIndex(lz77DistBase[:], lz77WindowSize)
+)
+
+// codeIndex 返回从值到码的查找表，base为每个码对应的最小值
+func codeIndex(base []uint16, max int) []uint8 {
+	index := make([]uint8, max+1)
+	code := 0
+	for v := int(base[0]); v <= max; v++ {
+		if code+1 < len(base) && v >= int(base[code+1]) {
+			code++
+		}
+		index[v] = uint8(code)
+	}
+	return index
+}
+
+// lz77Token 是LZ77的一个输出，length为0时是字面量
+type lz77Token struct {
+	length uint16 // 匹配长度
+	value  uint16 // 字面量或者匹配距离
+}
+
+// lz77Matcher 使用哈希链查找匹配
+type lz77Matcher struct {
+	data []byte
+	head []int32 // 每个哈希值最近插入的位置，没有时为-1
+	prev []int32 // 窗口内每个位置在哈希链中的前一个位置
+}
+
+func newLZ77Matcher(data []byte) *lz77Matcher {
+	m := &lz77Matcher{
+		data: data,
+		head: make([]int32, 1<<lz77HashBits),
+		prev: make([]int32, lz77WindowSize),
+	}
+	for i := range m.head {
+		m.head[i] = -1
+	}
+	return m
+}
+
+func (m *lz77Matcher) hash(i int) uint32 {
+	v := uint32(m.data[i])<<16 | uint32(m.data[i+1])<<8 | uint32(m.data[i+2])
+	return (v * 2654435761) >> (32 - lz77HashBits)
+}
+
+// insert 把位置i插入哈希链
+func (m *lz77Matcher) insert(i int) {
+	if i+lz77MinMatch > len(m.data) {
+		return
+	}
+	h := m.hash(i)
+	m.prev[i&(lz77WindowSize-1)] = m.head[h]
+	m.head[h] = int32(i)
+}
+
+// longest 返回位置i在窗口内最长的匹配的长度和距离，没有找到时长度为0
+func (m *lz77Matcher) longest(i int) (int, int) {
+	if i+lz77MinMatch > len(m.data) {
+		return 0, 0
+	}
+	maxLen := len(m.data) - i
+	if maxLen > lz77MaxMatch {
+		maxLen = lz77MaxMatch
+	}
+
+	bestLen, bestDist := lz77MinMatch-1, 0
+	cand := int(m.head[m.hash(i)])
+	for chain := lz77MaxChain; cand >= 0 && i-cand <= lz77WindowSize && chain > 0; chain-- {
+		// 先比较当前最长匹配的下一个字节，不可能更长的候选位置直接跳过
+		if m.data[cand+bestLen] == m.data[i+bestLen] {
+			n := 0
+			for n < maxLen && m.data[cand+n] == m.data[i+n] {
+				n++
+			}
+			if n > bestLen {
+				bestLen, bestDist = n, i-cand
+				if n >= lz77NiceMatch || n == maxLen {
+					break
+				}
+			}
+		}
+		next := int(m.prev[cand&(lz77WindowSize-1)])
+		if next >= cand {
+			break
+		}
+		cand = next
+	}
+
+	if bestDist == 0 {
+		return 0, 0
+	}
+	return bestLen, bestDist
+}
+
+// lz77Tokens 查找data中的匹配，返回字面量和匹配组成的序列
+func lz77Tokens(data []byte) []lz77Token {
+	m := newLZ77Matcher(data)
+	tokens := make([]lz77Token, 0, len(data)/2)
+	for i := 0; i < len(data); {
+		length, dist := m.longest(i)
+		m.insert(i)
+		if length >= lz77MinMatch && length < lz77NiceMatch {
+			// 延迟匹配：下一个位置的匹配更长时当前位置输出字面量
+			if next, _ := m.longest(i + 1); next > length {
+				tokens = append(tokens, lz77Token{value: uint16(data[i])})
+				i++
+				continue
+			}
+		}
+		if length < lz77MinMatch {
+			tokens = append(tokens, lz77Token{value: uint16(data[i])})
+			i++
+			continue
+		}
+
+		tokens = append(tokens, lz77Token{length: uint16(length), value: uint16(dist)})
+		for j := i + 1; j < i+length; j++ {
+			m.insert(j)
+		}
+		i += length
+	}
+
+	return tokens
+}
+
+// lz77Model 是一个块的字面量/长度码表和距离码表的编码长度
+type lz77Model struct {
+	litLen []uint8
+	dist   []uint8
+}
+
+// lz77Symbols 返回匹配的长度码和距离码
+func lz77Symbols(t lz77Token) (int, int) {
+	return lz77EndOfBlock + 1 + int(lz77LengthCodes[t.length]), int(lz77DistCodes[t.value])
+}
+
+// countLZ77Symbols 统计字面量/长度码和距离码的频数，同时返回所有额外比特的数量
+func countLZ77Symbols(tokens []lz77Token) ([]uint64, []uint64, uint64) {
+	litLenFreq := make([]uint64, lz77LitLenSymbolNum)
+	distFreq := make([]uint64, lz77DistSymbolNum)
+	var extraBits uint64 = 0
+	for _, t := range tokens {
+		if t.length == 0 {
+			litLenFreq[t.value]++
+			continue
+		}
+		lc, dc := lz77Symbols(t)
+		litLenFreq[lc]++
+		distFreq[dc]++
+		extraBits += uint64(lz77LengthExtra[lc-lz77EndOfBlock-1]) + uint64(lz77DistExtra[dc])
+	}
+	return litLenFreq, distFreq, extraBits
+}
+
+// planLZ77Model 统计符号的频数，使用NewTree构建两个码表，返回模型和压缩后的比特数（不包括码表）
+func planLZ77Model(tokens []lz77Token) (*lz77Model, uint64) {
+	litLenFreq, distFreq, bits := countLZ77Symbols(tokens)
+	m := &lz77Model{
+		litLen: symbolCodeLengths(litLenFreq, lz77MaxBitLen),
+		dist:   symbolCodeLengths(distFreq, lz77MaxBitLen),
+	}
+	return m, bits + symbolsCost(litLenFreq, m.litLen) + symbolsCost(distFreq, m.dist)
+}
+
+// symbolCodeLengths 根据以符号为下标的频数构建不超过maxBitLen的编码长度，返回以符号为下标的编码长度
+func symbolCodeLengths(counts []uint64, maxBitLen int) []uint8 {
+	freq := make(SymbolFrequencies[uint16])
+	for s, cnt := range counts {
+		if cnt != 0 {
+			freq[uint16(s)] = cnt
+		}
+	}
+	lengths := make([]uint8, len(counts))
+	tree := NewTree(freq, Less[uint16], maxBitLen)
+	for _, leaf := range tree.Leaves {
+		lengths[leaf.Symbol] = uint8(leaf.Code.BitLen())
+	}
+	return lengths
+}
+
+// symbolsCost 计算使用给定编码长度压缩后的比特数
+func symbolsCost(counts []uint64, lengths []uint8) uint64 {
+	var bits uint64 = 0
+	for s, cnt := range counts {
+		bits += cnt * uint64(lengths[s])
+	}
+	return bits
+}
+
+// compressLZ77 使用模型中的码表编码tokens，返回压缩后的字节切片和有效比特数
+func compressLZ77(tokens []lz77Token, m *lz77Model) ([]byte, uint64, error) {
+	litLen, err := canonicalSymbolCodes(m.litLen)
+	if err != nil {
+		return nil, 0, err
+	}
+	dist, err := canonicalSymbolCodes(m.dist)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	w := NewBitsWriter()
+	for _, t := range tokens {
+		if t.length == 0 {
+			code := litLen[t.value]
+			w.writeBits(code.Value(), uint(code.BitLen()))
+			continue
+		}
+		lc, dc := lz77Symbols(t)
+		code := litLen[lc]
+		w.writeBits(code.Value(), uint(code.BitLen()))
+		lc -= lz77EndOfBlock + 1
+		w.writeBits(uint64(t.length-lz77LengthBase[lc]), uint(lz77LengthExtra[lc]))
+		code = dist[dc]
+		w.writeBits(code.Value(), uint(code.BitLen()))
+		w.writeBits(uint64(t.value-lz77DistBase[dc]), uint(lz77DistExtra[dc]))
+	}
+
+	return w.Buf(), w.BitLen(), nil
+}
+
+// packedLZ77ModelSize 是LZ77 TABLES的字节数
+const packedLZ77ModelSize = (lz77LitLenSymbolNum + lz77DistSymbolNum) / 2
+
+// appendLZ77Model 将两个码表的编码长度追加到buf中
+func appendLZ77Model(buf []byte, m *lz77Model) []byte {
+	for _, lengths := range [][]uint8{m.litLen, m.dist} {
+		for i := 0; i < len(lengths); i += 2 {
+			buf = append(buf, lengths[i]<<4|lengths[i+1])
+		}
+	}
+	return buf
+}
+
+// readLZ77Model 读入两个码表的编码长度
+func readLZ77Model(br *blockReader) (*lz77Model, error) {
+	packed, err := br.read(packedLZ77ModelSize)
+	if err != nil {
+		return nil, err
+	}
+	lengths := make([]uint8, 0, lz77LitLenSymbolNum+lz77DistSymbolNum)
+	for _, b := range packed {
+		lengths = append(lengths, b>>4, b&0x0F)
+	}
+
+	return &lz77Model{litLen: lengths[:lz77LitLenSymbolNum], dist: lengths[lz77LitLenSymbolNum:]}, nil
+}
+
+// newLZ77Decoder 根据以符号为下标的编码长度构建查表解码器，没有任何编码时返回nil
+func newLZ77Decoder(lengths []uint8) (*HuffmanDecoder, error) {
+	codes, err := canonicalSymbolCodes(lengths)
+	if err != nil {
+		return nil, err
+	}
+	decoderCodes := make([]decoderCode, 0, len(codes))
+	for s, code := range codes {
+		if code != nil {
+			decoderCodes = append(decoderCodes, decoderCode{code: code.Value(), bitLen: code.BitLen(), symbol: uint32(s)})
+		}
+	}
+	if len(decoderCodes) == 0 {
+		return nil, nil
+	}
+
+	return newHuffmanDecoder(decoderCodes)
+}
+
+// buildLZ77Block 使用LZ77和两个Huffman码表压缩一个块，压缩后比原始数据大时直接存储
+func buildLZ77Block(data []byte) ([]byte, error) {
+	tokens := lz77Tokens(data)
+	m, bits := planLZ77Model(tokens)
+	if bits+(packedLZ77ModelSize+Uint64ByteSize)*8 >= uint64(len(data))*8 {
+		return buildBlock(data, BlockTypeStored, nil)
+	}
+	compressedBytes, bitLen, err := compressLZ77(tokens, m)
+	if err != nil {
+		return nil, err
+	}
+
+	block := make([]byte, 0, 1+Uint32ByteSize+packedLZ77ModelSize+Uint64ByteSize+len(compressedBytes)+Uint32ByteSize)
+	block = append(block, BlockTypeLZ77)
+	block = writeUint32ToBytes(uint32(len(data)), block)
+	block = appendLZ77Model(block, m)
+	block = writeUint64ToBytes(bitLen, block)
+	block = append(block, compressedBytes...)
+
+	return writeUint32ToBytes(crc32.Checksum(block, crc32q), block), nil
+}
+
+// decodeLZ77Block 解码一个BlockTypeLZ77类型的块
+// 块中的比特位应该刚好解码出RAW SIZE个字节
+func decodeLZ77Block(blk *rawBlock) ([]byte, error) {
+	litLen, err := newLZ77Decoder(blk.lz77.litLen)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+	}
+	dist, err := newLZ77Decoder(blk.lz77.dist)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+	}
+	if litLen == nil {
+		return nil, ErrCorruptBlock
+	}
+
+	data := make([]byte, 0, blk.rawSize)
+	var pos uint64 = 0
+	readExtra := func(n uint8) (int, error) {
+		if uint64(n) > blk.bitLen-pos {
+			return 0, ErrBitsExhausted
+		}
+		v := peekBits(blk.payload, pos, n)
+		pos += uint64(n)
+		return int(v), nil
+	}
+	for len(data) < int(blk.rawSize) {
+		symbol, n, err := litLen.decodeIndex(blk.payload, pos, blk.bitLen)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+		}
+		pos += n
+		if symbol < lz77EndOfBlock {
+			data = append(data, byte(symbol))
+			continue
+		}
+		if symbol == lz77EndOfBlock || dist == nil {
+			return nil, ErrCorruptBlock
+		}
+
+		lc := symbol - lz77EndOfBlock - 1
+		extra, err := readExtra(lz77LengthExtra[lc])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+		}
+		length := int(lz77LengthBase[lc]) + extra
+
+		dc, n, err := dist.decodeIndex(blk.payload, pos, blk.bitLen)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+		}
+		pos += n
+		if extra, err = readExtra(lz77DistExtra[dc]); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+		}
+		d := int(lz77DistBase[dc]) + extra
+
+		if d > len(data) || len(data)+length > int(blk.rawSize) {
+			return nil, ErrCorruptBlock
+		}
+		// 距离可能比长度小，需要逐个字节复制
+		start := len(data) - d
+		for i := 0; i < length; i++ {
+			data = append(data, data[start+i])
+		}
+	}
+	if pos != blk.bitLen {
+		return nil, ErrCorruptBlock
+	}
+
+	return data, nil
+}
@@ -0,0 +1,161 @@
+package huffman
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLZ77CodeIndex(t *testing.T) {
+	require.EqualValues(t, 0, lz77LengthCodes[3])
+	require.EqualValues(t, 8, lz77LengthCodes[11])
+	require.EqualValues(t, 8, lz77LengthCodes[12])
+	require.EqualValues(t, 27, lz77LengthCodes[257])
+	require.EqualValues(t, 28, lz77LengthCodes[258])
+	require.EqualValues(t, 0, lz77DistCodes[1])
+	require.EqualValues(t, 4, lz77DistCodes[6])
+	require.EqualValues(t, 29, lz77DistCodes[lz77WindowSize])
+
+	// 最大额外比特数和额外比特表一致，每个字节的比特数上限能容纳最坏的字面量和匹配
+	var maxLengthExtra, maxDistExtra uint8
+	for _, e := range lz77LengthExtra {
+		if e > maxLengthExtra {
+			maxLengthExtra = e
+		}
+	}
+	for _, e := range lz77DistExtra {
+		if e > maxDistExtra {
+			maxDistExtra = e
+		}
+	}
+	require.EqualValues(t, lz77MaxLengthExtra, maxLengthExtra)
+	require.EqualValues(t, lz77MaxDistExtra, maxDistExtra)
+	require.EqualValues(t, 16, lz77MaxBitsPerByte)
+	require.GreaterOrEqual(t, lz77MaxBitsPerByte, lz77MaxBitLen)
+	require.GreaterOrEqual(t, lz77MaxBitsPerByte*lz77MinMatch, 2*lz77MaxBitLen+lz77MaxLengthExtra+lz77MaxDistExtra)
+}
+
+// lz77Expand 根据tokens还原数据
+func lz77Expand(tokens []lz77Token) []byte {
+	var data []byte
+	for _, tk := range tokens {
+		if tk.length == 0 {
+			data = append(data, byte(tk.value))
+			continue
+		}
+		start := len(data) - int(tk.value)
+		for i := 0; i < int(tk.length); i++ {
+			data = append(data, data[start+i])
+		}
+	}
+	return data
+}
+
+func TestLZ77Tokens(t *testing.T) {
+	tokens := lz77Tokens([]byte("abcabcabcabcx"))
+	require.Equal(t, []lz77Token{
+		{value: 'a'}, {value: 'b'}, {value: 'c'},
+		{length: 9, value: 3},
+		{value: 'x'},
+	}, tokens)
+
+	// 长串重复的字节
+	data := bytes.Repeat([]byte{'z'}, 1000)
+	tokens = lz77Tokens(data)
+	require.Equal(t, data, lz77Expand(tokens))
+	require.Less(t, len(tokens), 10)
+
+	for _, data := range [][]byte{nil, []byte("ab"), mixedData(1 << 18)} {
+		tokens := lz77Tokens(data)
+		require.Equal(t, len(data), len(lz77Expand(tokens)))
+		require.True(t, bytes.Equal(data, lz77Expand(tokens)))
+		for _, tk := range tokens {
+			if tk.length != 0 {
+				require.GreaterOrEqual(t, int(tk.length), lz77MinMatch)
+				require.LessOrEqual(t, int(tk.length), lz77MaxMatch)
+				require.LessOrEqual(t, int(tk.value), lz77WindowSize)
+			}
+		}
+	}
+}
+
+func TestLZ77Block(t *testing.T) {
+	data, err := os.ReadFile(s1)
+	require.Nil(t, err)
+
+	tokens := lz77Tokens(data)
+	m, bits := planLZ77Model(tokens)
+	for _, l := range append(append([]uint8(nil), m.litLen...), m.dist...) {
+		require.LessOrEqual(t, l, uint8(lz77MaxBitLen))
+	}
+	compressed, bitLen, err := compressLZ77(tokens, m)
+	require.Nil(t, err)
+	require.Equal(t, bits, bitLen)
+
+	ser := appendLZ77Model(nil, m)
+	require.Len(t, ser, packedLZ77ModelSize)
+	got, err := readLZ77Model(&blockReader{r: bytes.NewReader(ser)})
+	require.Nil(t, err)
+	require.Equal(t, m, got)
+
+	blk := &rawBlock{
+		blockType: BlockTypeLZ77,
+		rawSize:   uint32(len(data)),
+		lz77:      got,
+		bitLen:    bitLen,
+		payload:   compressed,
+	}
+	recovered, err := decodeLZ77Block(blk)
+	require.Nil(t, err)
+	require.Equal(t, data, recovered)
+
+	// 原始大小和数据不一致
+	blk.rawSize--
+	_, err = decodeLZ77Block(blk)
+	require.ErrorIs(t, err, ErrCorruptBlock)
+	blk.rawSize += 2
+	_, err = decodeLZ77Block(blk)
+	require.ErrorIs(t, err, ErrCorruptBlock)
+}
+
+// 有大量重复字符串的日志使用LZ77的压缩率远高于order-0
+func TestWriter_LZ77(t *testing.T) {
+	var logs bytes.Buffer
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&logs, "2023-06-01T12:%02d:%02d INFO request handled path=/api/v1/items/%d status=200 latency=%dms\n", i/60%60, i%60, i%97, i%13)
+	}
+	data := logs.Bytes()
+
+	order0 := compressStream(t, data)
+	stream := compressStream(t, data, WithLZ77())
+	require.Less(t, len(stream)*4, len(order0))
+	types, _ := blockTypes(t, stream)
+	require.Equal(t, []byte{BlockTypeLZ77}, types)
+
+	got, _ := parseStream(t, stream)
+	require.Equal(t, data, got)
+
+	for _, concurrency := range []int{1, 4} {
+		r, err := NewReader(bytes.NewReader(stream), WithReaderConcurrency(concurrency))
+		require.Nil(t, err)
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, r)
+		require.Nil(t, err)
+		require.Equal(t, data, buf.Bytes())
+	}
+
+	// 多个块并行压缩，结果和串行压缩一致，并且可以随机访问
+	mixed := mixedData(1 << 18)
+	stream = compressStream(t, mixed, WithBlockSize(1<<15), WithLZ77(), WithSeekIndex(0))
+	require.Equal(t, stream, compressStream(t, mixed, WithBlockSize(1<<15), WithLZ77(), WithSeekIndex(0), WithConcurrency(4)))
+	sr, err := OpenSeekable(bytes.NewReader(stream))
+	require.Nil(t, err)
+	buf := make([]byte, 50000)
+	n, err := sr.ReadAt(buf, 100000)
+	require.Nil(t, err)
+	require.Equal(t, mixed[100000:150000], buf[:n])
+}
@@ -0,0 +1,150 @@
+package huffman
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// 文件元数据：压缩时通过WithFileMetadata把源文件的权限位、修改时间和所有者（只在Linux上记录）写入文件头，
+// 解压时通过WithRestoreMetadata把它们恢复到解压出的文件上。记录了元数据的文件使用FileVersion4格式，
+// 文件头在文件名之后依次为变换链（TRANSFORM NUM可以为0）和下面的元数据：（大端序）
+//   - METADATA FLAGS				1 byte  第0位表示是否记录了UID和GID，其余位为0
+//   - MODE						4 bytes (uint32) Unix格式的权限位，包括setuid、setgid和sticky位
+//   - MTIME						8 bytes (int64) 修改时间，Unix秒时间戳
+//   - MTIME NSEC					4 bytes (uint32) 修改时间秒以下的纳秒数，小于1e9
+//   - UID						4 bytes (uint32) 只有METADATA FLAGS第0位为1时有该字段
+//   - GID						4 bytes (uint32) 只有METADATA FLAGS第0位为1时有该字段
+
+const (
+	metadataFlagOwner byte = 1 << 0
+
+	unixModeSetuid uint32 = 04000
+	unixModeSetgid uint32 = 02000
+	unixModeSticky uint32 = 01000
+)
+
+// FileMetadata 是压缩文件中记录的源文件元数据
+type FileMetadata struct {
+	Mode     os.FileMode // 权限位以及setuid、setgid和sticky位
+	ModTime  time.Time
+	UID      uint32
+	GID      uint32
+	HasOwner bool // 是否记录了UID和GID
+}
+
+// newFileMetadata 从源文件的信息中得到需要记录的元数据
+func newFileMetadata(info os.FileInfo) *FileMetadata {
+	meta := &FileMetadata{
+		Mode:    info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky),
+		ModTime: info.ModTime(),
+	}
+	meta.UID, meta.GID, meta.HasOwner = fileOwner(info)
+
+	return meta
+}
+
+// appendFileMetadata 将元数据追加到buf中
+func appendFileMetadata(buf []byte, meta *FileMetadata) []byte {
+	var flags byte = 0
+	if meta.HasOwner {
+		flags |= metadataFlagOwner
+	}
+	buf = append(buf, flags)
+	buf = writeUint32ToBytes(unixMode(meta.Mode), buf)
+	// 秒和纳秒分开记录，UnixNano只能表示1678年到2262年之间的时间
+	buf = writeUint64ToBytes(uint64(meta.ModTime.Unix()), buf)
+	buf = writeUint32ToBytes(uint32(meta.ModTime.Nanosecond()), buf)
+	if meta.HasOwner {
+		buf = writeUint32ToBytes(meta.UID, buf)
+		buf = writeUint32ToBytes(meta.GID, buf)
+	}
+	return buf
+}
+
+// readFileMetadata 从文件头中读入元数据
+func readFileMetadata(br *blockReader) (*FileMetadata, error) {
+	flags, err := br.read(1)
+	if err != nil {
+		return nil, err
+	}
+	if flags[0]&^metadataFlagOwner != 0 {
+		return nil, fmt.Errorf("%w: metadata flags %08b", ErrCanNotParseFileHeader, flags[0])
+	}
+	meta := &FileMetadata{HasOwner: flags[0]&metadataFlagOwner != 0}
+
+	mode, err := br.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	if mode&^(uint32(os.ModePerm)|unixModeSetuid|unixModeSetgid|unixModeSticky) != 0 {
+		return nil, fmt.Errorf("%w: file mode %o", ErrCanNotParseFileHeader, mode)
+	}
+	meta.Mode = fileMode(mode)
+	sec, err := br.readUint64()
+	if err != nil {
+		return nil, err
+	}
+	nsec, err := br.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	if nsec >= uint32(time.Second) {
+		return nil, fmt.Errorf("%w: mtime nanoseconds %d", ErrCanNotParseFileHeader, nsec)
+	}
+	meta.ModTime = time.Unix(int64(sec), int64(nsec))
+	if meta.HasOwner {
+		if meta.UID, err = br.readUint32(); err != nil {
+			return nil, err
+		}
+		if meta.GID, err = br.readUint32(); err != nil {
+			return nil, err
+		}
+	}
+
+	return meta, nil
+}
+
+// restore 把元数据恢复到f上，调用方不能再写入f，否则修改时间会被覆盖
+// 先恢复所有者，因为修改所有者会清除setuid和setgid位
+func (m *FileMetadata) restore(f *os.File) error {
+	if m.HasOwner {
+		if err := restoreOwner(f, m.UID, m.GID); err != nil {
+			return err
+		}
+	}
+	if err := f.Chmod(m.Mode); err != nil {
+		return err
+	}
+	return os.Chtimes(f.Name(), m.ModTime, m.ModTime)
+}
+
+// unixMode 把os.FileMode转换成Unix格式的权限位
+func unixMode(m os.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		mode |= unixModeSetuid
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= unixModeSetgid
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= unixModeSticky
+	}
+	return mode
+}
+
+// fileMode 把Unix格式的权限位转换成os.FileMode
+func fileMode(mode uint32) os.FileMode {
+	m := os.FileMode(mode) & os.ModePerm
+	if mode&unixModeSetuid != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&unixModeSetgid != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&unixModeSticky != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
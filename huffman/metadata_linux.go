@@ -0,0 +1,26 @@
+//go:build linux
+
+package huffman
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner 返回文件的UID和GID
+func fileOwner(info os.FileInfo) (uint32, uint32, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return st.Uid, st.Gid, true
+}
+
+// restoreOwner 恢复文件的所有者
+// 只有root用户可以把文件交给其他用户，和tar一样，非root用户解压时不恢复所有者
+func restoreOwner(f *os.File, uid, gid uint32) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	return f.Chown(int(uid), int(gid))
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package huffman
+
+import "os"
+
+// fileOwner 只在Linux上记录文件的所有者
+func fileOwner(info os.FileInfo) (uint32, uint32, bool) {
+	return 0, 0, false
+}
+
+// restoreOwner 只在Linux上恢复文件的所有者
+func restoreOwner(f *os.File, uid, gid uint32) error {
+	return nil
+}
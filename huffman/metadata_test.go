@@ -0,0 +1,117 @@
+package huffman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressFile_Metadata(t *testing.T) {
+	data, err := os.ReadFile(s1)
+	require.Nil(t, err)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	require.Nil(t, os.WriteFile(src, data, 0600))
+	require.Nil(t, os.Chmod(src, 0640))
+	mtime := time.Date(2020, 2, 29, 12, 34, 56, 789, time.UTC)
+	require.Nil(t, os.Chtimes(src, mtime, mtime))
+
+	compressedname := filepath.Join(dir, "metadata.huf")
+	recovername := filepath.Join(dir, "recover.txt")
+	require.Nil(t, CompressFile(src, compressedname, WithFileMetadata(), WithTransforms(DeltaTransform{})))
+	compressed, err := os.ReadFile(compressedname)
+	require.Nil(t, err)
+	require.Equal(t, FileVersion4, compressed[Uint16ByteSize])
+
+	header, err := parseFileHeaderV2(&blockReader{r: bytes.NewReader(compressed)})
+	require.Nil(t, err)
+	require.Equal(t, []byte{TransformIDDelta}, header.transforms)
+	require.Equal(t, os.FileMode(0640), header.metadata.Mode)
+	require.True(t, mtime.Equal(header.metadata.ModTime))
+	if runtime.GOOS == "linux" {
+		require.True(t, header.metadata.HasOwner)
+		require.Equal(t, uint32(os.Getuid()), header.metadata.UID)
+		require.Equal(t, uint32(os.Getgid()), header.metadata.GID)
+	}
+
+	// 默认不恢复元数据
+	require.Nil(t, DecompressFile(compressedname, recovername))
+	info, err := os.Stat(recovername)
+	require.Nil(t, err)
+	require.False(t, mtime.Equal(info.ModTime()))
+
+	require.Nil(t, DecompressFile(compressedname, recovername, WithRestoreMetadata(), WithReaderConcurrency(2)))
+	got, err := os.ReadFile(recovername)
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+	info, err = os.Stat(recovername)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	require.True(t, mtime.Equal(info.ModTime()))
+
+	// 没有记录元数据的文件不受WithRestoreMetadata影响
+	require.Nil(t, CompressFile(src, compressedname))
+	require.Nil(t, DecompressFile(compressedname, recovername, WithRestoreMetadata()))
+	info, err = os.Stat(recovername)
+	require.Nil(t, err)
+	require.False(t, mtime.Equal(info.ModTime()))
+}
+
+func TestFileMetadata_Header(t *testing.T) {
+	meta := &FileMetadata{
+		Mode:     os.ModeSetuid | os.ModeSticky | 0755,
+		ModTime:  time.Unix(-1, 5),
+		UID:      1000,
+		GID:      100,
+		HasOwner: true,
+	}
+	header := appendFileHeader(nil, "name", 10, 20, nil, meta)
+	require.Equal(t, FileVersion4, header[Uint16ByteSize])
+
+	got, err := parseFileHeaderV2(&blockReader{r: bytes.NewReader(header)})
+	require.Nil(t, err)
+	require.Nil(t, got.transforms)
+	require.Equal(t, uint64(10), got.originalSize)
+	require.Equal(t, uint64(20), got.compressedSize)
+	require.Equal(t, meta.Mode, got.metadata.Mode)
+	require.True(t, meta.ModTime.Equal(got.metadata.ModTime))
+	require.Equal(t, meta.UID, got.metadata.UID)
+	require.Equal(t, meta.GID, got.metadata.GID)
+	require.Equal(t, uint32(04755|01000), unixMode(meta.Mode))
+
+	// 没有所有者时不写出UID和GID
+	meta.HasOwner = false
+	require.Len(t, appendFileHeader(nil, "name", 10, 20, nil, meta), len(header)-2*Uint32ByteSize)
+
+	// 纳秒数超出范围
+	nsecOffset := len(header) - 2*Uint32ByteSize - Uint32ByteSize
+	bad := append([]byte(nil), header...)
+	bad[nsecOffset] = 0xFF
+	_, err = parseFileHeaderV2(&blockReader{r: bytes.NewReader(bad)})
+	require.ErrorIs(t, err, ErrCanNotParseFileHeader)
+
+	// 未知的标志位
+	header[len(header)-1-Uint64ByteSize-Uint32ByteSize-2*Uint32ByteSize-Uint32ByteSize] |= 0x80
+	_, err = parseFileHeaderV2(&blockReader{r: bytes.NewReader(header)})
+	require.ErrorIs(t, err, ErrCanNotParseFileHeader)
+}
+
+// UnixNano无法表示的修改时间
+func TestFileMetadata_ModTimeRange(t *testing.T) {
+	for _, mtime := range []time.Time{
+		time.Date(1000, 1, 2, 3, 4, 5, 6, time.UTC),
+		time.Date(1677, 9, 21, 0, 0, 0, 999999999, time.UTC),
+		time.Date(2262, 4, 12, 0, 0, 0, 1, time.UTC),
+		time.Date(3000, 12, 31, 23, 59, 59, 999999999, time.UTC),
+	} {
+		header := appendFileHeader(nil, "name", 10, 20, nil, &FileMetadata{ModTime: mtime})
+		got, err := parseFileHeaderV2(&blockReader{r: bytes.NewReader(header)})
+		require.Nil(t, err)
+		require.True(t, mtime.Equal(got.metadata.ModTime), mtime)
+	}
+}
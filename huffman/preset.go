@@ -0,0 +1,165 @@
+package huffman
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// 预置码表：压缩大量很小的数据（例如几百字节的JSON消息）时，每份数据都存储码表的开销比压缩节省的空间还大。
+// 这时可以事先用有代表性的数据构建一个码表，压缩时通过WithPresetTable使用该码表，流中只存储码表的ID；
+// 解压时通过WithTableRegistry提供注册了该码表的TableRegistry，根据ID找到码表。
+//
+// 码表的ID为序列化后的码表（WideHuffmanEncTable.Serialize或EscapeEncTable.Serialize的结果）的SHA-256的前8个字节，
+// 同一个码表在压缩端和解压端总是得到相同的ID。
+// 预置码表可以带有转义码（见escape.go），这时数据中出现码表中没有的字节也可以使用预置码表压缩
+
+var (
+	ErrUnknownTable = fmt.Errorf("preset table not found")
+)
+
+// TableID 返回序列化后的码表的ID
+func TableID(ser []byte) uint64 {
+	sum := sha256.Sum256(ser)
+	return binary.BigEndian.Uint64(sum[:])
+}
+
+// presetTable 是TableRegistry中注册的一个码表
+type presetTable struct {
+	table   WideHuffmanDecTable
+	escape  *WideHuffmanCode // 转义码，为nil时没有转义码
+	decoder *HuffmanDecoder
+}
+
+// TableRegistry 记录所有预置码表，解压时根据流中的ID查找码表，可以并发使用
+type TableRegistry struct {
+	mu     sync.RWMutex
+	tables map[uint64]*presetTable
+}
+
+// NewTableRegistry 创建一个空的TableRegistry
+func NewTableRegistry() *TableRegistry {
+	return &TableRegistry{tables: make(map[uint64]*presetTable)}
+}
+
+// Register 注册一个序列化后的码表，返回码表的ID
+// ser可以是WideHuffmanEncTable的序列化结果，也可以是带有转义码的EscapeEncTable的序列化结果
+func (r *TableRegistry) Register(ser []byte) (uint64, error) {
+	preset, err := deserializePresetTable(ser)
+	if err != nil {
+		return 0, err
+	}
+
+	id := TableID(ser)
+	r.mu.Lock()
+	r.tables[id] = preset
+	r.mu.Unlock()
+
+	return id, nil
+}
+
+// deserializePresetTable 根据开始标志反序列化普通的码表或者带有转义码的码表，并构建解码器
+func deserializePresetTable(ser []byte) (*presetTable, error) {
+	if len(ser) >= Uint32ByteSize && binary.BigEndian.Uint32(ser) == HuffmanEncTableSerEscapeStartFlag {
+		table, err := DeserializeEscapeDecTable(ser)
+		if err != nil {
+			return nil, err
+		}
+		decoder, err := table.NewHuffmanDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return &presetTable{table: table.Table, escape: table.Escape, decoder: decoder}, nil
+	}
+
+	table, err := DeserializeWideHuffmanDecTable(ser)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := NewHuffmanDecoder(table)
+	if err != nil {
+		return nil, err
+	}
+	return &presetTable{table: table, decoder: decoder}, nil
+}
+
+// RegisterTable 序列化并注册一个码表，返回码表的ID
+// table可以是HuffmanEncTable、WideHuffmanEncTable或者带有转义码的EscapeEncTable
+func (r *TableRegistry) RegisterTable(table ByteEncTable) (uint64, error) {
+	ser, err := serializePresetTable(table)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.Register(ser)
+}
+
+// serializePresetTable 序列化预置码表，带有转义码的码表使用EscapeEncTable的序列化格式
+func serializePresetTable(table ByteEncTable) ([]byte, error) {
+	if t, ok := table.(*EscapeEncTable); ok {
+		return t.Serialize()
+	}
+	return serializeEncTable(table), nil
+}
+
+// Lookup 根据ID查找码表，带有转义码的码表返回其中字节的编码，转义码通过LookupEscape获取
+func (r *TableRegistry) Lookup(id uint64) (WideHuffmanDecTable, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	preset, ok := r.tables[id]
+	if !ok {
+		return nil, false
+	}
+	return preset.table, true
+}
+
+// LookupEscape 根据ID查找带有转义码的码表，码表没有转义码时返回的Escape为nil
+func (r *TableRegistry) LookupEscape(id uint64) (*EscapeDecTable, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	preset, ok := r.tables[id]
+	if !ok {
+		return nil, false
+	}
+	return &EscapeDecTable{Table: preset.table, Escape: preset.escape}, true
+}
+
+// decoder 返回ID对应的码表的解码器，r为nil时视为没有注册任何码表
+func (r *TableRegistry) decoder(id uint64) (*HuffmanDecoder, error) {
+	if r == nil {
+		return nil, fmt.Errorf("%w: %016x", ErrUnknownTable, id)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	preset, ok := r.tables[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %016x", ErrUnknownTable, id)
+	}
+	return preset.decoder, nil
+}
+
+// newPresetBlockTable 根据预置码表创建压缩时使用的blockTable
+func newPresetBlockTable(table ByteEncTable) (*blockTable, error) {
+	ser, err := serializePresetTable(table)
+	if err != nil {
+		return nil, err
+	}
+
+	lengths := make([]uint8, MaxSymbolNum)
+	for i := range lengths {
+		if code, ok := table.Code(byte(i)); ok {
+			lengths[i] = uint8(code.BitLen())
+		}
+	}
+	preset := &blockTable{lengths: lengths, presetID: TableID(ser), preset: table}
+	if escape := escapeOf(table); escape != nil {
+		preset.escapeLen = escape.BitLen()
+	}
+
+	return preset, nil
+}
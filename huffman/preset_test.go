@@ -0,0 +1,197 @@
+package huffman
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// jsonMessage 生成一条大约200字节的JSON消息
+func jsonMessage(i int) []byte {
+	return []byte(fmt.Sprintf(`{"id":%d,"user":"user-%d","action":"login","success":true,"timestamp":%d,`+
+		`"device":{"os":"linux","version":"%d.%d"},"tags":["web","mobile","beta"],"score":%d}`,
+		i, i%97, 1700000000+i*37, i%5, i%10, i*31%1000))
+}
+
+func TestTableRegistry(t *testing.T) {
+	var samples []byte
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, jsonMessage(i)...)
+	}
+	// 预置码表需要包含所有字节，保证任何数据都可以使用
+	freq := CountFrequencies(samples)
+	for i := 0; i < MaxSymbolNum; i++ {
+		freq[byte(i)]++
+	}
+	table := NewCanonicalHuffmanEncTable(NewHuffmanTree(freq))
+	ser, err := table.Serialize()
+	require.Nil(t, err)
+
+	registry := NewTableRegistry()
+	id, err := registry.Register(ser)
+	require.Nil(t, err)
+	require.Equal(t, TableID(ser), id)
+	id2, err := registry.RegisterTable(table)
+	require.Nil(t, err)
+	require.Equal(t, id, id2)
+	decTable, ok := registry.Lookup(id)
+	require.True(t, ok)
+	require.Len(t, decTable, MaxSymbolNum)
+	_, ok = registry.Lookup(id + 1)
+	require.False(t, ok)
+
+	_, err = registry.Register(ser[:len(ser)-1])
+	require.NotNil(t, err)
+
+	for i := 1000; i < 1010; i++ {
+		msg := jsonMessage(i)
+		stream := compressStream(t, msg, WithPresetTable(table))
+		types, _ := blockTypes(t, stream)
+		require.Equal(t, []byte{BlockTypePreset}, types)
+		// 不存储码表时压缩后比原始数据小
+		require.Less(t, len(stream), len(msg))
+		require.Greater(t, len(compressStream(t, msg)), len(stream))
+
+		r, err := NewReader(bytes.NewReader(stream), WithTableRegistry(registry))
+		require.Nil(t, err)
+		got, err := io.ReadAll(r)
+		require.Nil(t, err)
+		require.Equal(t, msg, got)
+	}
+
+	// 没有注册码表时无法解压
+	stream := compressStream(t, jsonMessage(0), WithPresetTable(table))
+	r, err := NewReader(bytes.NewReader(stream))
+	require.Nil(t, err)
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, ErrUnknownTable)
+	r, err = NewReader(bytes.NewReader(stream), WithTableRegistry(NewTableRegistry()))
+	require.Nil(t, err)
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, ErrUnknownTable)
+}
+
+func TestWriter_PresetTable(t *testing.T) {
+	data := mixedData(1 << 18)
+	// 预置码表只包含部分字节，无法编码的块使用自己的码表
+	table := NewWideHuffmanEncTable(NewHuffmanTree(CountFrequencies(data[:1<<12])))
+	registry := NewTableRegistry()
+	_, err := registry.RegisterTable(table)
+	require.Nil(t, err)
+
+	stream := compressStream(t, data, WithBlockSize(4096), WithPresetTable(table), WithSeekIndex(1000))
+	require.Equal(t, stream, compressStream(t, data, WithBlockSize(4096), WithPresetTable(table), WithSeekIndex(1000), WithConcurrency(4)))
+	types, _ := blockTypes(t, stream)
+	require.Contains(t, types, BlockTypePreset)
+	require.Contains(t, types, BlockTypeHuffman)
+
+	for _, concurrency := range []int{1, 4} {
+		r, err := NewReader(bytes.NewReader(stream), WithTableRegistry(registry), WithReaderConcurrency(concurrency))
+		require.Nil(t, err)
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, r)
+		require.Nil(t, err)
+		require.Equal(t, data, buf.Bytes())
+	}
+
+	sr, err := OpenSeekable(bytes.NewReader(stream), WithTableRegistry(registry))
+	require.Nil(t, err)
+	buf := make([]byte, 3000)
+	n, err := sr.ReadAt(buf, 1500)
+	require.Nil(t, err)
+	require.Equal(t, data[1500:4500], buf[:n])
+
+	// 注册码表可以和解压并发进行
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := registry.RegisterTable(table)
+			require.Nil(t, err)
+		}()
+	}
+	r, err := NewReader(bytes.NewReader(stream), WithTableRegistry(registry))
+	require.Nil(t, err)
+	got, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+	wg.Wait()
+}
+
+func TestWriter_PresetEscapeTable(t *testing.T) {
+	var samples []byte
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, jsonMessage(i)...)
+	}
+	// 只用样本中出现过的字节构建码表，再加上转义码
+	table := NewWideHuffmanEncTable(NewHuffmanTree(CountFrequencies(samples)))
+	escTable, err := table.WithEscape()
+	require.Nil(t, err)
+	require.NotNil(t, escTable.Escape)
+	ser, err := escTable.Serialize()
+	require.Nil(t, err)
+
+	registry := NewTableRegistry()
+	id, err := registry.Register(ser)
+	require.Nil(t, err)
+	id2, err := registry.RegisterTable(escTable)
+	require.Nil(t, err)
+	require.Equal(t, id, id2)
+	decTable, ok := registry.LookupEscape(id)
+	require.True(t, ok)
+	require.Equal(t, *escTable.Escape, *decTable.Escape)
+	require.Len(t, decTable.Table, len(table))
+
+	// 消息中有码表中没有的字节
+	msg := append(jsonMessage(1000), []byte("\x00\xff 中文 ~!@#$%^&*")...)
+	for _, b := range []byte{0x00, 0xff, '~'} {
+		_, ok := table[b]
+		require.False(t, ok)
+	}
+	_, _, err = compressBytesWith(msg, table)
+	require.NotNil(t, err)
+
+	// 没有转义码的预置码表无法编码该消息
+	types, _ := blockTypes(t, compressStream(t, msg, WithPresetTable(table)))
+	require.NotContains(t, types, BlockTypePreset)
+
+	stream := compressStream(t, msg, WithPresetTable(escTable))
+	types, _ = blockTypes(t, stream)
+	require.Equal(t, []byte{BlockTypePreset}, types)
+	require.Less(t, len(stream), len(msg))
+
+	r, err := NewReader(bytes.NewReader(stream), WithTableRegistry(registry))
+	require.Nil(t, err)
+	got, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, msg, got)
+
+	// 多个块并行压缩和随机访问
+	var data []byte
+	for i := 0; i < 200; i++ {
+		data = append(data, jsonMessage(2000+i)...)
+		data = append(data, byte(i))
+	}
+	stream = compressStream(t, data, WithBlockSize(1024), WithPresetTable(escTable), WithSeekIndex(1000))
+	require.Equal(t, stream, compressStream(t, data, WithBlockSize(1024), WithPresetTable(escTable), WithSeekIndex(1000), WithConcurrency(4)))
+	types, _ = blockTypes(t, stream)
+	require.Contains(t, types, BlockTypePreset)
+
+	r, err = NewReader(bytes.NewReader(stream), WithTableRegistry(registry), WithReaderConcurrency(4))
+	require.Nil(t, err)
+	got, err = io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+
+	sr, err := OpenSeekable(bytes.NewReader(stream), WithTableRegistry(registry))
+	require.Nil(t, err)
+	buf := make([]byte, 3000)
+	n, err := sr.ReadAt(buf, 1500)
+	require.Nil(t, err)
+	require.Equal(t, data[1500:4500], buf[:n])
+}
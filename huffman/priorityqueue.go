@@ -81,3 +81,32 @@ func (pq *HuffmanPQ) Size() int {
 func (pq *HuffmanPQ) Peek() *HuffmanNode {
 	return pq.data[0]
 }
+
+// nodeHeap 是构建Tree[S]时使用的优先级队列，和huffmanPQ一样按权重排列
+type nodeHeap[S comparable] []*Node[S]
+
+func (pq nodeHeap[S]) Len() int {
+	return len(pq)
+}
+
+func (pq nodeHeap[S]) Less(i, j int) bool {
+	// 最小堆
+	return pq[i].Weight < pq[j].Weight
+}
+
+func (pq nodeHeap[S]) Swap(i, j int) {
+	pq[i], pq[j] = pq[j], pq[i]
+}
+
+func (pq *nodeHeap[S]) Push(x interface{}) {
+	*pq = append(*pq, x.(*Node[S]))
+}
+
+func (pq *nodeHeap[S]) Pop() interface{} {
+	old := *pq
+	n := len(old)
+	node := old[n-1]
+	old[n-1] = nil // avoid memory leak
+	*pq = old[0 : n-1]
+	return node
+}
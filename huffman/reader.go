@@ -3,12 +3,15 @@ package huffman
 import "fmt"
 
 // BitsReader 定义比特的读取方式
+// 码表能够编译成查表解码器时使用查表解码，否则逐比特查找解码表
 type BitsReader struct {
-	buf    []byte
-	table  HuffmanDecTable
-	index  int
-	cursor uint64
-	remain uint64
+	buf     []byte
+	table   ByteDecTable
+	decoder *HuffmanDecoder
+	escape  *WideHuffmanCode // 转义码，为nil时没有转义码
+	index   int
+	cursor  uint64
+	remain  uint64
 }
 
 var (
@@ -16,13 +19,24 @@ var (
 	ErrBitsExhausted   = fmt.Errorf("bit exhausted")
 )
 
-func NewBitsReader(buf []byte, bitLen uint64, decodeTable HuffmanDecTable) *BitsReader {
+// NewBitsReader 使用解码表创建BitsReader，HuffmanDecTable和WideHuffmanDecTable都可以使用
+func NewBitsReader(buf []byte, bitLen uint64, decodeTable ByteDecTable) *BitsReader {
+	// 编译失败（例如码表不是前缀码）时退回到逐比特查表
+	decoder, _ := NewHuffmanDecoder(decodeTable)
+
+	return NewBitsReaderWithDecoder(buf, bitLen, decodeTable, decoder)
+}
+
+// NewBitsReaderWithDecoder 使用已经编译好的查表解码器创建BitsReader
+// decoder为nil时逐比特查找decodeTable
+func NewBitsReaderWithDecoder(buf []byte, bitLen uint64, decodeTable ByteDecTable, decoder *HuffmanDecoder) *BitsReader {
 	return &BitsReader{
-		buf:    buf,
-		table:  decodeTable,
-		index:  0,
-		cursor: 0,
-		remain: bitLen,
+		buf:     buf,
+		table:   decodeTable,
+		decoder: decoder,
+		index:   0,
+		cursor:  0,
+		remain:  bitLen,
 	}
 }
 
@@ -31,16 +45,19 @@ func (r *BitsReader) ReadByte() (byte, error) {
 	if r.remain == 0 {
 		return 0, ErrBitsExhausted
 	}
+	if r.decoder != nil {
+		return r.readByteWithDecoder()
+	}
 
 	// 从第index个字节的第cursor个比特开始读
-	parsedCode := HuffmanCode{}
+	parsedCode := WideHuffmanCode{}
 	var ret byte = 0
 
 	i := 0
 	foundOne := false
 
-	// 每次最多读 MaxHuffmanCodeBitLen bit
-	for ; i < MaxHuffmanCodeBitLen && r.remain > 0; i++ {
+	// 每次最多读 MaxWideHuffmanCodeBitLen bit
+	for ; i < MaxWideHuffmanCodeBitLen && r.remain > 0; i++ {
 		if r.nextBit() {
 			parsedCode.AppendOne()
 		} else {
@@ -54,15 +71,24 @@ func (r *BitsReader) ReadByte() (byte, error) {
 		}
 
 		// 在decode table中找是否存在这个编码
-		key, ok := r.table.Get(parsedCode)
+		key, ok := r.table.Lookup(&parsedCode)
 		if ok {
 			ret = key
 			foundOne = true
 			break
 		}
+		// 转义码后面是8比特的原始字节
+		if r.escape != nil && parsedCode == *r.escape {
+			if r.remain < 8 {
+				return 0, ErrBitsExhausted
+			}
+			ret = r.readLiteral()
+			foundOne = true
+			break
+		}
 	}
 
-	if i == MaxHuffmanCodeBitLen {
+	if i == MaxWideHuffmanCodeBitLen {
 		// 发现了不存在的比特编码
 		return 0, ErrBitCodeNotFound
 	}
@@ -74,11 +100,44 @@ func (r *BitsReader) ReadByte() (byte, error) {
 	return ret, nil
 }
 
+// readByteWithDecoder 使用查表解码器解析出一个字节
+func (r *BitsReader) readByteWithDecoder() (byte, error) {
+	pos := uint64(r.index)*8 + r.cursor
+	b, n, err := r.decoder.decodeSymbol(r.buf, pos, pos+r.remain)
+	if err != nil {
+		return 0, err
+	}
+	pos += n
+	r.index = int(pos / 8)
+	r.cursor = pos % 8
+	r.remain -= n
+
+	return b, nil
+}
+
 // ReadAll 解析所有比特位
 func (r *BitsReader) ReadAll() ([]byte, error) {
 	approxLen := r.remain / 8
 	ret := make([]byte, 0, approxLen)
 
+	if r.decoder != nil {
+		pos := uint64(r.index)*8 + r.cursor
+		end := pos + r.remain
+		for pos < end {
+			b, n, err := r.decoder.decodeSymbol(r.buf, pos, end)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, b)
+			pos += n
+		}
+		r.index = int(pos / 8)
+		r.cursor = pos % 8
+		r.remain = 0
+
+		return ret, nil
+	}
+
 	for r.remain > 0 {
 		b, err := r.ReadByte()
 		if err != nil {
@@ -90,6 +149,18 @@ func (r *BitsReader) ReadAll() ([]byte, error) {
 	return ret, nil
 }
 
+// readLiteral 读入8比特的原始字节
+func (r *BitsReader) readLiteral() byte {
+	pos := uint64(r.index)*8 + r.cursor
+	b := byte(peekBits(r.buf, pos, 8))
+	pos += 8
+	r.index = int(pos / 8)
+	r.cursor = pos % 8
+	r.remain -= 8
+
+	return b
+}
+
 // 判断下一个比特位（第index字节的第cursor个比特
 // 返回true表示比特1，返回false表示比特0
 func (r *BitsReader) nextBit() bool {
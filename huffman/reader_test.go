@@ -15,7 +15,8 @@ func constructPrerequisite(t *testing.T, data []byte) ([]byte, uint64, HuffmanDe
 	// 构建Huffman树
 	tree := NewHuffmanTree(freq)
 	// 获取Huffman编码表
-	table := NewHuffmanEncTable(tree)
+	table, err := NewHuffmanEncTable(tree)
+	require.Nil(t, err)
 
 	denseBytes, totalBits, err := compressBytesWith(data, table)
 	require.Nil(t, err)
@@ -0,0 +1,348 @@
+package huffman
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	// 带有索引的流尾的字节数
+	seekableTailSize = 1 + Uint32ByteSize + Uint64ByteSize + Uint32ByteSize
+	// 最多缓存的解码器数量
+	maxCachedDecoders = 64
+)
+
+var (
+	ErrNoSeekIndex    = fmt.Errorf("stream has no seek index")
+	ErrUnknownSize    = fmt.Errorf("can not get size of reader")
+	ErrInvalidWhence  = fmt.Errorf("invalid whence")
+	ErrNegativeOffset = fmt.Errorf("negative offset")
+)
+
+// SeekableReader 是带有索引的压缩流的随机访问解压缩器，实现了io.ReaderAt和io.ReadSeeker接口
+// 读取时只读入并解码需要的块，并且从目标位置之前最近的检查点开始解码
+type SeekableReader struct {
+	r       io.ReaderAt
+	entries []indexEntry
+	// 每个码表所在的块的下标
+	tableEntries []int
+	// 每个块使用的码表编号，不使用流中的码表的块为-1
+	entryTables []int
+	indexOffset uint64
+	size        int64 // 解压后的字节数
+	offset      int64 // Read和Seek使用的当前位置
+
+	mu       sync.Mutex
+	cached   int // 最近读入的块的下标
+	block    *rawBlock
+	decoders map[int]*HuffmanDecoder
+	registry *TableRegistry
+	// 最近一次解码结束的位置，顺序读取时从这里继续解码
+	resume checkpoint
+}
+
+// OpenSeekable 打开一个通过WithSeekIndex压缩的流
+// r需要能获得流的大小，例如*os.File、*bytes.Reader和*io.SectionReader
+// opts中只有WithTableRegistry有效，流中有使用预置码表的块时需要设置
+func OpenSeekable(r io.ReaderAt, opts ...ReaderOption) (*SeekableReader, error) {
+	cfg := &Reader{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+
+	size, err := readerAtSize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	flags, err := readStreamHeader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	if flags&StreamFlagSeekIndex == 0 {
+		return nil, ErrNoSeekIndex
+	}
+
+	// 流尾中记录了索引的位置
+	headerSize := int64(Uint32ByteSize + 2)
+	if size < headerSize+seekableTailSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+	tail := make([]byte, seekableTailSize)
+	if _, err := r.ReadAt(tail, size-seekableTailSize); err != nil {
+		return nil, err
+	}
+	if tail[0] != BlockTypeEnd {
+		return nil, ErrCorruptIndex
+	}
+	indexOffset, _ := readNextUint64(tail, 1+Uint32ByteSize)
+	endFlag, _ := readNextUint32(tail, 1+Uint32ByteSize+Uint64ByteSize)
+	if endFlag != StreamEndFlag {
+		return nil, ErrInvalidEndFlag
+	}
+	if indexOffset < uint64(headerSize) || indexOffset >= uint64(size-seekableTailSize) {
+		return nil, ErrCorruptIndex
+	}
+
+	blk, err := readBlock(io.NewSectionReader(r, int64(indexOffset), size-seekableTailSize-int64(indexOffset)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptIndex, err)
+	}
+	if blk.blockType != BlockTypeIndex {
+		return nil, ErrCorruptIndex
+	}
+	entries, err := parseSeekIndex(blk.payload, indexOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	z := &SeekableReader{
+		r:           r,
+		entries:     entries,
+		entryTables: make([]int, len(entries)),
+		indexOffset: indexOffset,
+		registry:    cfg.registry,
+		cached:      -1,
+		decoders:    make(map[int]*HuffmanDecoder),
+	}
+	for i, e := range entries {
+		z.entryTables[i] = -1
+		switch e.blockType {
+		case BlockTypeHuffman:
+			z.entryTables[i] = len(z.tableEntries)
+			z.tableEntries = append(z.tableEntries, i)
+		case BlockTypeHuffmanRef:
+			// 引用的码表编号要等读入块之后才知道
+			z.entryTables[i] = len(z.tableEntries) - 1
+		}
+		z.size += int64(e.rawSize)
+	}
+
+	return z, nil
+}
+
+// readerAtSize 返回r的大小
+func readerAtSize(r io.ReaderAt) (int64, error) {
+	switch v := r.(type) {
+	case interface{ Size() int64 }:
+		return v.Size(), nil
+	case interface{ Stat() (os.FileInfo, error) }:
+		info, err := v.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	return 0, ErrUnknownSize
+}
+
+// Size 返回解压后的字节数
+func (z *SeekableReader) Size() int64 {
+	return z.size
+}
+
+// ReadAt 实现io.ReaderAt接口，可以并发调用
+func (z *SeekableReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+
+	n := 0
+	for n < len(p) && off+int64(n) < z.size {
+		pos := uint64(off) + uint64(n)
+		i := sort.Search(len(z.entries), func(i int) bool {
+			return z.entries[i].rawOffset+uint64(z.entries[i].rawSize) > pos
+		})
+		e := &z.entries[i]
+		start := pos - e.rawOffset
+		size := uint64(len(p) - n)
+		if size > uint64(e.rawSize)-start {
+			size = uint64(e.rawSize) - start
+		}
+
+		if err := z.readFromBlock(i, uint32(start), p[n:n+int(size)]); err != nil {
+			return n, err
+		}
+		n += int(size)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read 实现io.Reader接口
+func (z *SeekableReader) Read(p []byte) (int, error) {
+	n, err := z.ReadAt(p, z.offset)
+	z.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek 实现io.Seeker接口
+func (z *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += z.offset
+	case io.SeekEnd:
+		offset += z.size
+	default:
+		return 0, ErrInvalidWhence
+	}
+	if offset < 0 {
+		return 0, ErrNegativeOffset
+	}
+	z.offset = offset
+
+	return offset, nil
+}
+
+// readFromBlock 将第i个块中从start开始的数据解码到dst中
+func (z *SeekableReader) readFromBlock(i int, start uint32, dst []byte) error {
+	blk, decoder, err := z.loadBlock(i)
+	if err != nil {
+		return err
+	}
+	if decoder == nil {
+		copy(dst, blk.payload[start:])
+		return nil
+	}
+
+	// 从start之前最近的检查点开始解码
+	checkpoints := z.entries[i].checkpoints
+	j := sort.Search(len(checkpoints), func(j int) bool {
+		return checkpoints[j].rawOffset > start
+	})
+	var from checkpoint
+	if j > 0 {
+		from = checkpoints[j-1]
+	}
+	z.mu.Lock()
+	if z.cached == i && z.resume.rawOffset <= start && z.resume.rawOffset > from.rawOffset {
+		from = z.resume
+	}
+	z.mu.Unlock()
+
+	pos := from.bitOffset
+	raw := from.rawOffset
+	for n := 0; n < len(dst); raw++ {
+		b, consumed, err := decoder.decodeSymbol(blk.payload, pos, blk.bitLen)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+		}
+		pos += consumed
+		if raw >= start {
+			dst[n] = b
+			n++
+		}
+	}
+
+	z.mu.Lock()
+	if z.cached == i {
+		z.resume = checkpoint{bitOffset: pos, rawOffset: raw}
+	}
+	z.mu.Unlock()
+
+	return nil
+}
+
+// loadBlock 读入并校验第i个块，返回块和解码该块使用的解码器
+// 最近读入的块会被缓存，连续读取同一个块时不需要重复读入
+func (z *SeekableReader) loadBlock(i int) (*rawBlock, *HuffmanDecoder, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if z.cached != i {
+		blk, err := z.readEntry(i)
+		if err != nil {
+			return nil, nil, err
+		}
+		if isModelBlock(blk.blockType) {
+			// 这样的块只能从头解码，读入时直接解码整个块
+			data, err := decodeModelBlock(blk)
+			if err != nil {
+				return nil, nil, fmt.Errorf("block %d: %w", i, err)
+			}
+			blk = &rawBlock{blockType: BlockTypeStored, rawSize: blk.rawSize, payload: data}
+		}
+		z.cached = i
+		z.block = blk
+		z.resume = checkpoint{}
+	}
+	blk := z.block
+
+	if blk.blockType == BlockTypeStored {
+		return blk, nil, nil
+	}
+	if blk.blockType == BlockTypePreset {
+		decoder, err := z.registry.decoder(blk.presetID)
+		return blk, decoder, err
+	}
+	table := z.entryTables[i]
+	if blk.blockType == BlockTypeHuffmanRef {
+		if int(blk.tableIndex) > table {
+			return nil, nil, fmt.Errorf("%w: table %d not found", ErrCorruptBlock, blk.tableIndex)
+		}
+		table = int(blk.tableIndex)
+	}
+	decoder, err := z.decoder(table, blk)
+
+	return blk, decoder, err
+}
+
+// decoder 返回第table个码表的解码器，blk为当前读入的块
+// 调用方需要持有锁
+func (z *SeekableReader) decoder(table int, blk *rawBlock) (*HuffmanDecoder, error) {
+	if decoder, ok := z.decoders[table]; ok {
+		return decoder, nil
+	}
+
+	lengths := blk.lengths
+	if blk.blockType != BlockTypeHuffman {
+		// 码表在之前的块中
+		tableBlk, err := z.readEntry(z.tableEntries[table])
+		if err != nil {
+			return nil, err
+		}
+		lengths = tableBlk.lengths
+	}
+	decoder, err := NewHuffmanDecoderFromLengths(lengths)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+	}
+	if len(z.decoders) >= maxCachedDecoders {
+		z.decoders = make(map[int]*HuffmanDecoder)
+	}
+	z.decoders[table] = decoder
+
+	return decoder, nil
+}
+
+// readEntry 读入并校验第i个块
+func (z *SeekableReader) readEntry(i int) (*rawBlock, error) {
+	e := &z.entries[i]
+	end := z.indexOffset
+	if i+1 < len(z.entries) {
+		end = z.entries[i+1].offset
+	}
+
+	blk, err := readBlock(io.NewSectionReader(z.r, int64(e.offset), int64(end-e.offset)))
+	if err != nil {
+		return nil, fmt.Errorf("block %d: %w", i, err)
+	}
+	if blk.blockType != e.blockType || blk.rawSize != e.rawSize {
+		return nil, fmt.Errorf("block %d: %w", i, ErrCorruptIndex)
+	}
+
+	return blk, nil
+}
@@ -0,0 +1,115 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeekableReader(t *testing.T) {
+	data := mixedData(1 << 19)
+
+	for _, interval := range []int{0, 1000, DefaultCheckpointInterval} {
+		for _, concurrency := range []int{1, 4} {
+			stream := compressStream(t, data, WithBlockSize(8192), WithSeekIndex(interval), WithConcurrency(concurrency))
+
+			// 顺序读取时忽略索引
+			r, err := NewReader(bytes.NewReader(stream))
+			require.Nil(t, err)
+			got, err := io.ReadAll(r)
+			require.Nil(t, err)
+			require.Equal(t, data, got)
+
+			sr, err := OpenSeekable(bytes.NewReader(stream))
+			require.Nil(t, err)
+			require.EqualValues(t, len(data), sr.Size())
+
+			rnd := rand.New(rand.NewSource(int64(interval)))
+			for i := 0; i < 200; i++ {
+				off := rnd.Intn(len(data))
+				buf := make([]byte, rnd.Intn(20000))
+				n, err := sr.ReadAt(buf, int64(off))
+				end := off + len(buf)
+				if end > len(data) {
+					end = len(data)
+					require.ErrorIs(t, err, io.EOF)
+				} else {
+					require.Nil(t, err)
+				}
+				require.Equal(t, end-off, n)
+				require.Equal(t, data[off:end], buf[:n])
+			}
+
+			require.Nil(t, iotest.TestReader(sr, data))
+		}
+	}
+}
+
+func TestSeekableReader_Concurrent(t *testing.T) {
+	data := mixedData(1 << 18)
+	stream := compressStream(t, data, WithBlockSize(4096), WithSeekIndex(512))
+	sr, err := OpenSeekable(bytes.NewReader(stream))
+	require.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for i := 0; i < 100; i++ {
+				off := rnd.Intn(len(data) - 5000)
+				buf := make([]byte, 5000)
+				_, err := sr.ReadAt(buf, int64(off))
+				require.Nil(t, err)
+				require.Equal(t, data[off:off+5000], buf)
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+}
+
+func TestSeekableReader_Invalid(t *testing.T) {
+	data := bytes.Repeat([]byte("go-huffman seekable reader "), 1000)
+
+	_, err := OpenSeekable(bytes.NewReader(compressStream(t, data)))
+	require.ErrorIs(t, err, ErrNoSeekIndex)
+
+	stream := compressStream(t, data, WithBlockSize(1000), WithSeekIndex(100))
+	_, err = OpenSeekable(io.NewSectionReader(bytes.NewReader(stream), 0, int64(len(stream))))
+	require.Nil(t, err)
+	_, err = OpenSeekable(struct{ io.ReaderAt }{bytes.NewReader(stream)})
+	require.ErrorIs(t, err, ErrUnknownSize)
+
+	// 索引被破坏
+	broken := append([]byte(nil), stream...)
+	broken[len(broken)-seekableTailSize-Uint32ByteSize-1] ^= 0xFF
+	_, err = OpenSeekable(bytes.NewReader(broken))
+	require.ErrorIs(t, err, ErrCorruptIndex)
+
+	// 第二个块被破坏，只有读取该块时出错
+	_, ends := blockTypes(t, stream)
+	broken = append([]byte(nil), stream...)
+	broken[ends[1]-Uint32ByteSize-1] ^= 0xFF
+	sr, err := OpenSeekable(bytes.NewReader(broken))
+	require.Nil(t, err)
+	buf := make([]byte, 500)
+	_, err = sr.ReadAt(buf, 1200)
+	require.ErrorIs(t, err, ErrChecksumNotMatched)
+	_, err = sr.ReadAt(buf, 2200)
+	require.Nil(t, err)
+	require.Equal(t, data[2200:2700], buf)
+
+	_, err = sr.Seek(-1, io.SeekStart)
+	require.ErrorIs(t, err, ErrNegativeOffset)
+	_, err = sr.Seek(0, 42)
+	require.ErrorIs(t, err, ErrInvalidWhence)
+
+	w := NewWriter(io.Discard, WithSeekIndex(-1))
+	require.ErrorIs(t, w.Close(), ErrInvalidCheckpointInterval)
+}
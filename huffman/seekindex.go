@@ -0,0 +1,166 @@
+package huffman
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+// 索引（INDEX DATA）格式如下：（大端序）
+//   - ENTRY NUM					4 bytes (uint32)
+//   - ENTRY 1 ... ENTRY N			每个块一项，按照块的顺序排列
+//     -- BLOCK TYPE				1 byte
+//     -- BLOCK OFFSET				8 bytes (uint64) 块在流中的字节偏移
+//     -- RAW OFFSET				8 bytes (uint64) 块在解压数据中的字节偏移
+//     -- RAW SIZE					4 bytes (uint32)
+//     -- CHECKPOINT NUM			4 bytes (uint32)
+//     -- CHECKPOINT 1 ... CHECKPOINT N
+//     --- BIT OFFSET				8 bytes (uint64) 块的DATA中的比特偏移
+//     --- RAW OFFSET				4 bytes (uint32) 块内解压数据的字节偏移
+//
+// 每个块的开头都可以看成一个检查点，块内的检查点只记录在使用码表编码的块中，
+// 随机访问时从目标位置之前最近的检查点开始解码；BlockTypeAdaptive、BlockTypeContext和BlockTypeLZ77类型的块只能从块的开头解码
+const (
+	// DefaultCheckpointInterval 是默认的块内检查点之间的字节数
+	DefaultCheckpointInterval = 64 << 10
+
+	indexEntrySize      = 1 + 2*Uint64ByteSize + 2*Uint32ByteSize
+	indexCheckpointSize = Uint64ByteSize + Uint32ByteSize
+)
+
+var (
+	ErrCorruptIndex = fmt.Errorf("corrupt seek index")
+)
+
+// checkpoint 是块内的一个检查点
+type checkpoint struct {
+	bitOffset uint64 // 块的DATA中的比特偏移
+	rawOffset uint32 // 块内解压数据的字节偏移
+}
+
+// indexEntry 是索引中的一项，对应流中的一个块
+type indexEntry struct {
+	blockType   byte
+	offset      uint64 // 块在流中的字节偏移
+	rawOffset   uint64 // 块在解压数据中的字节偏移
+	rawSize     uint32
+	checkpoints []checkpoint
+}
+
+// blockCheckpoints 计算使用给定编码长度压缩data时，每隔interval个字节的检查点
+func blockCheckpoints(data []byte, lengths []uint8, interval int) []checkpoint {
+	if interval <= 0 {
+		return nil
+	}
+
+	var checkpoints []checkpoint
+	var bits uint64 = 0
+	for i, b := range data {
+		if i > 0 && i%interval == 0 {
+			checkpoints = append(checkpoints, checkpoint{bitOffset: bits, rawOffset: uint32(i)})
+		}
+		bits += uint64(lengths[b])
+	}
+
+	return checkpoints
+}
+
+// blockTypeCheckpoints 返回给定类型的块的检查点，只有使用码表编码的块需要块内检查点
+func blockTypeCheckpoints(data []byte, blockType byte, table *blockTable, interval int) []checkpoint {
+	if blockType != BlockTypeHuffman && blockType != BlockTypeHuffmanRef && blockType != BlockTypePreset {
+		return nil
+	}
+	return blockCheckpoints(data, table.lengths, interval)
+}
+
+// appendIndexBlock 将索引序列化成BlockTypeIndex类型的块追加到buf中
+func appendIndexBlock(buf []byte, entries []indexEntry) []byte {
+	start := len(buf)
+	size := Uint32ByteSize
+	for _, e := range entries {
+		size += indexEntrySize + len(e.checkpoints)*indexCheckpointSize
+	}
+
+	buf = append(buf, BlockTypeIndex)
+	buf = writeUint32ToBytes(uint32(size), buf)
+	buf = writeUint32ToBytes(uint32(len(entries)), buf)
+	for _, e := range entries {
+		buf = append(buf, e.blockType)
+		buf = writeUint64ToBytes(e.offset, buf)
+		buf = writeUint64ToBytes(e.rawOffset, buf)
+		buf = writeUint32ToBytes(e.rawSize, buf)
+		buf = writeUint32ToBytes(uint32(len(e.checkpoints)), buf)
+		for _, c := range e.checkpoints {
+			buf = writeUint64ToBytes(c.bitOffset, buf)
+			buf = writeUint32ToBytes(c.rawOffset, buf)
+		}
+	}
+
+	return writeUint32ToBytes(crc32.Checksum(buf[start:], crc32q), buf)
+}
+
+// parseSeekIndex 解析INDEX DATA，并检查每一项是否和之前的项连续
+// indexOffset为索引在流中的字节偏移，所有的块都应该在索引之前
+func parseSeekIndex(data []byte, indexOffset uint64) ([]indexEntry, error) {
+	cursor := 0
+	num, err := readNextUint32(data, cursor)
+	if err != nil {
+		return nil, ErrCorruptIndex
+	}
+	cursor += Uint32ByteSize
+	if uint64(num)*indexEntrySize > uint64(len(data)-cursor) {
+		return nil, ErrCorruptIndex
+	}
+
+	entries := make([]indexEntry, num)
+	var rawOffset uint64 = 0
+	var offset uint64 = 0
+	for i := range entries {
+		if len(data)-cursor < indexEntrySize {
+			return nil, ErrCorruptIndex
+		}
+		e := &entries[i]
+		e.blockType = data[cursor]
+		cursor++
+		e.offset, _ = readNextUint64(data, cursor)
+		cursor += Uint64ByteSize
+		e.rawOffset, _ = readNextUint64(data, cursor)
+		cursor += Uint64ByteSize
+		e.rawSize, _ = readNextUint32(data, cursor)
+		cursor += Uint32ByteSize
+		checkpointNum, _ := readNextUint32(data, cursor)
+		cursor += Uint32ByteSize
+
+		switch e.blockType {
+		case BlockTypeStored, BlockTypeHuffman, BlockTypeHuffmanRef, BlockTypeAdaptive, BlockTypeContext, BlockTypePreset, BlockTypeLZ77:
+		default:
+			return nil, ErrCorruptIndex
+		}
+		if e.offset < offset || e.offset >= indexOffset || e.rawOffset != rawOffset || e.rawSize == 0 {
+			return nil, ErrCorruptIndex
+		}
+		offset = e.offset + 1
+		rawOffset += uint64(e.rawSize)
+
+		if uint64(checkpointNum)*indexCheckpointSize > uint64(len(data)-cursor) {
+			return nil, ErrCorruptIndex
+		}
+		e.checkpoints = make([]checkpoint, checkpointNum)
+		var last uint32 = 0
+		for j := range e.checkpoints {
+			c := &e.checkpoints[j]
+			c.bitOffset, _ = readNextUint64(data, cursor)
+			cursor += Uint64ByteSize
+			c.rawOffset, _ = readNextUint32(data, cursor)
+			cursor += Uint32ByteSize
+			if c.rawOffset <= last || c.rawOffset >= e.rawSize {
+				return nil, ErrCorruptIndex
+			}
+			last = c.rawOffset
+		}
+	}
+	if cursor != len(data) {
+		return nil, ErrCorruptIndex
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,402 @@
+package huffman
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+var (
+	ErrReaderClosed = fmt.Errorf("reader already closed")
+)
+
+// ReaderOption 用于配置Reader
+type ReaderOption func(r *Reader)
+
+// WithSkipCorruptBlocks 遇到校验和不匹配的块时不返回错误，而是用0填充该块并继续解压之后的块
+// 被跳过的块可以通过Reader.CorruptBlocks获得，此时不再检查整个流的校验和
+func WithSkipCorruptBlocks() ReaderOption {
+	return func(r *Reader) {
+		r.skipCorrupt = true
+	}
+}
+
+// WithReaderConcurrency 设置WriteTo时同时解码的块的最大数量，默认为1，小于1时NewReader返回ErrInvalidConcurrency
+func WithReaderConcurrency(n int) ReaderOption {
+	return func(r *Reader) {
+		if n < 1 {
+			r.err = ErrInvalidConcurrency
+			return
+		}
+		r.concurrency = n
+	}
+}
+
+// WithTableRegistry 设置解压时查找预置码表使用的TableRegistry，流中有使用预置码表的块时需要设置
+func WithTableRegistry(registry *TableRegistry) ReaderOption {
+	return func(r *Reader) {
+		r.registry = registry
+	}
+}
+
+// Reader 是一个流式的解压缩器，实现了io.ReadCloser接口
+// 每次只从底层的io.Reader中读入一个块，并在Read时把块中的数据解码到调用方的缓冲区中
+type Reader struct {
+	r           io.Reader
+	tables      blockTables
+	bits        *BitsReader
+	stored      []byte // BlockTypeStored或被跳过的块中还没有读出的数据
+	blockRemain uint32 // 当前块中还没有解码的字节数
+	blockNum    int
+	offset      int64 // 已经解压出的数据的字节数
+	corrupt     []int
+	skipCorrupt bool
+	flags       byte
+	concurrency int
+	registry    *TableRegistry
+	checksum    uint32
+	eof         bool
+	closed      bool
+	err         error
+}
+
+// NewReader 创建一个新的Reader，从r中读入压缩流
+// 创建时会读入并检查流头
+func NewReader(r io.Reader, opts ...ReaderOption) (*Reader, error) {
+	zr := &Reader{r: r}
+	for _, opt := range opts {
+		opt(zr)
+	}
+	if zr.err != nil {
+		return nil, zr.err
+	}
+
+	flags, err := readStreamHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	zr.flags = flags
+
+	return zr, nil
+}
+
+// Read 实现io.Reader接口
+func (z *Reader) Read(p []byte) (int, error) {
+	if z.closed {
+		return 0, ErrReaderClosed
+	}
+	if z.err != nil {
+		return 0, z.err
+	}
+
+	n := 0
+	// 已经计入校验和的字节数
+	summed := 0
+	for n < len(p) {
+		if z.blockRemain == 0 {
+			if z.eof {
+				break
+			}
+			// 读入下一个块（可能是流尾）之前，先把已经解码的数据计入校验和
+			z.checksum = crc32.Update(z.checksum, crc32q, p[summed:n])
+			summed = n
+			if err := z.nextBlock(); err != nil {
+				z.err = err
+				break
+			}
+			continue
+		}
+
+		if z.bits == nil {
+			copied := copy(p[n:], z.stored[:z.blockRemain])
+			z.stored = z.stored[copied:]
+			n += copied
+			z.blockRemain -= uint32(copied)
+			continue
+		}
+
+		b, err := z.bits.ReadByte()
+		if err != nil {
+			z.err = fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+			break
+		}
+		p[n] = b
+		n++
+		z.blockRemain--
+
+		// 块中的比特位应该刚好用完
+		if z.blockRemain == 0 && z.bits.remain != 0 {
+			z.err = ErrCorruptBlock
+			break
+		}
+	}
+	z.checksum = crc32.Update(z.checksum, crc32q, p[summed:n])
+	z.offset += int64(n)
+
+	if n > 0 {
+		return n, nil
+	}
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.eof {
+		return 0, io.EOF
+	}
+	return 0, nil
+}
+
+// Close 关闭Reader，不会关闭底层的io.Reader
+func (z *Reader) Close() error {
+	z.closed = true
+	return nil
+}
+
+// CorruptBlocks 返回因为校验和不匹配而被跳过的块的序号
+func (z *Reader) CorruptBlocks() []int {
+	return z.corrupt
+}
+
+// nextBlock 读入下一个块，遇到流尾时检查校验和
+func (z *Reader) nextBlock() error {
+	blk, decoder, err := z.readNextBlock()
+	if err != nil {
+		return err
+	}
+	if blk.blockType == BlockTypeEnd {
+		return z.readTail()
+	}
+
+	if isModelBlock(blk.blockType) {
+		// 自适应编码和上下文模型的块只能按顺序解码，一次解码整个块
+		data, err := decodeModelBlock(blk)
+		if err != nil {
+			return fmt.Errorf("block %d: %w", z.blockNum-1, err)
+		}
+		blk.payload = data
+	}
+
+	z.blockRemain = blk.rawSize
+	if decoder == nil {
+		z.bits = nil
+		z.stored = blk.payload
+		return nil
+	}
+	z.bits = NewBitsReaderWithDecoder(blk.payload, blk.bitLen, nil, decoder)
+
+	return nil
+}
+
+// readNextBlock 读入下一个块并记录其中的码表，返回块和解码该块使用的解码器
+// BlockTypeStored和isModelBlock类型的块没有解码器；跳过损坏的块时返回内容全为0的BlockTypeStored类型的块
+func (z *Reader) readNextBlock() (*rawBlock, *HuffmanDecoder, error) {
+	blk, err := readBlock(z.r)
+	if blk != nil && blk.blockType == BlockTypeHuffman {
+		// 损坏的块中的码表也要记录，保证之后的码表编号不变
+		z.tables.add(blk.lengths)
+	}
+	if err != nil {
+		if blk == nil || !z.skipCorrupt {
+			return nil, nil, fmt.Errorf("block %d: %w", z.blockNum, err)
+		}
+		if blk.blockType == BlockTypeIndex {
+			return z.readNextBlock()
+		}
+		z.corrupt = append(z.corrupt, z.blockNum)
+		z.blockNum++
+		return &rawBlock{
+			blockType: BlockTypeStored,
+			rawSize:   blk.rawSize,
+			payload:   make([]byte, blk.rawSize),
+		}, nil, nil
+	}
+
+	switch blk.blockType {
+	case BlockTypeEnd:
+		return blk, nil, nil
+	case BlockTypeIndex:
+		// 顺序读取时不需要索引
+		return z.readNextBlock()
+	}
+	z.blockNum++
+	if blk.blockType == BlockTypeStored || isModelBlock(blk.blockType) {
+		return blk, nil, nil
+	}
+
+	var decoder *HuffmanDecoder
+	if blk.blockType == BlockTypePreset {
+		decoder, err = z.registry.decoder(blk.presetID)
+	} else {
+		decoder, err = z.tables.decoderFor(blk)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("block %d: %w", z.blockNum-1, err)
+	}
+
+	return blk, decoder, nil
+}
+
+// readTail 读入流尾并检查所有数据的校验和，有块被跳过时不检查校验和
+func (z *Reader) readTail() error {
+	checksum := z.checksum
+	if len(z.corrupt) > 0 {
+		checksum = 0
+	}
+	if err := readStreamTail(z.r, z.flags, checksum); err != nil && (len(z.corrupt) == 0 || err != ErrChecksumNotMatched) {
+		return err
+	}
+	z.eof = true
+
+	return nil
+}
+
+// WriteTo 实现io.WriterTo接口，将剩余的数据全部解压到w中，io.Copy会自动使用该方法
+//
+// 通过WithReaderConcurrency设置并行数量后，多个块在不同的goroutine中并行解码：
+// w实现了io.WriterAt时，每个块解码后直接写入它在解压数据中的偏移位置，否则按照块的顺序写入w
+func (z *Reader) WriteTo(w io.Writer) (int64, error) {
+	if z.closed {
+		return 0, ErrReaderClosed
+	}
+
+	wa, _ := w.(io.WriterAt)
+	if z.concurrency <= 1 {
+		wa = nil
+	}
+	var written int64 = 0
+	// 先写出当前块中还没有读出的数据
+	if z.blockRemain > 0 {
+		buf := make([]byte, z.blockRemain)
+		offset := z.offset
+		n, err := z.Read(buf)
+		var m int
+		var werr error
+		if wa != nil {
+			m, werr = wa.WriteAt(buf[:n], offset)
+		} else {
+			m, werr = w.Write(buf[:n])
+		}
+		written += int64(m)
+		if err != nil {
+			return written, err
+		}
+		if werr != nil {
+			return written, werr
+		}
+	}
+
+	if z.concurrency <= 1 {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := z.Read(buf)
+			if n > 0 {
+				m, werr := w.Write(buf[:n])
+				written += int64(m)
+				if werr != nil {
+					return written, werr
+				}
+			}
+			if err == io.EOF {
+				return written, nil
+			}
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return z.writeToParallel(w, wa, written)
+}
+
+// writeToParallel 并行解码剩余的块，written为已经写入w的字节数
+// wa不为nil时每个块直接写入wa，否则按照块的顺序写入w
+func (z *Reader) writeToParallel(w io.Writer, wa io.WriterAt, written int64) (int64, error) {
+	if z.err != nil {
+		return written, z.err
+	}
+	if z.eof {
+		return written, nil
+	}
+
+	offset := z.offset
+	var pending []*decodeJob
+	// finish 等待最早的块解码完成，按照块的顺序计算校验和，w没有实现io.WriterAt时按顺序写出
+	finish := func() error {
+		job := pending[0]
+		pending = pending[1:]
+		<-job.done
+		if job.err != nil {
+			return job.err
+		}
+		z.checksum = crc32.Update(z.checksum, crc32q, job.data)
+		z.offset += int64(len(job.data))
+		if wa != nil {
+			written += int64(len(job.data))
+			return nil
+		}
+		n, err := w.Write(job.data)
+		written += int64(n)
+		return err
+	}
+
+	for z.err == nil && !z.eof {
+		if len(pending) == z.concurrency {
+			if err := finish(); err != nil {
+				z.err = err
+				break
+			}
+		}
+
+		blk, decoder, err := z.readNextBlock()
+		if err != nil {
+			z.err = err
+			break
+		}
+		if blk.blockType == BlockTypeEnd {
+			for len(pending) > 0 && z.err == nil {
+				z.err = finish()
+			}
+			if z.err == nil {
+				z.err = z.readTail()
+			}
+			break
+		}
+
+		job := &decodeJob{blk: blk, decoder: decoder, offset: offset, done: make(chan struct{})}
+		offset += int64(blk.rawSize)
+		pending = append(pending, job)
+		go job.run(wa)
+	}
+
+	// 出错时也要等待所有的块解码完成，保证返回之后不会再写入w
+	for _, job := range pending {
+		<-job.done
+	}
+
+	return written, z.err
+}
+
+// decodeJob 是一个并行解码的块
+type decodeJob struct {
+	blk     *rawBlock
+	decoder *HuffmanDecoder
+	offset  int64 // 块在输出中的偏移
+	done    chan struct{}
+	data    []byte
+	err     error
+}
+
+func (j *decodeJob) run(wa io.WriterAt) {
+	defer close(j.done)
+
+	switch {
+	case isModelBlock(j.blk.blockType):
+		j.data, j.err = decodeModelBlock(j.blk)
+	case j.decoder != nil:
+		j.data, j.err = decodeBlock(j.blk, j.decoder)
+	default:
+		j.data = j.blk.payload
+	}
+	if j.err == nil && wa != nil {
+		_, j.err = wa.WriteAt(j.data, j.offset)
+	}
+}
@@ -0,0 +1,222 @@
+package huffman
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// compressStream 使用Writer压缩data，返回压缩流
+func compressStream(t *testing.T, data []byte, opts ...WriterOption) []byte {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, opts...)
+	_, err := w.Write(data)
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func TestReader(t *testing.T) {
+	data, err := os.ReadFile("test/test_data.txt")
+	require.Nil(t, err)
+
+	for _, blockSize := range []int{DefaultBlockSize, 4096, 1000, 1} {
+		stream := compressStream(t, data, WithBlockSize(blockSize))
+
+		r, err := NewReader(bytes.NewReader(stream))
+		require.Nil(t, err)
+		got, err := io.ReadAll(r)
+		require.Nil(t, err)
+		require.Equal(t, data, got)
+		require.Nil(t, r.Close())
+	}
+}
+
+func TestReader_SmallReads(t *testing.T) {
+	data, err := os.ReadFile("test/test_data.txt")
+	require.Nil(t, err)
+	stream := compressStream(t, data, WithBlockSize(777))
+
+	// 底层每次只能读到一个字节，调用方每次只读一个字节
+	r, err := NewReader(iotest.OneByteReader(bytes.NewReader(stream)))
+	require.Nil(t, err)
+	got, err := io.ReadAll(iotest.OneByteReader(r))
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+
+	r, err = NewReader(bytes.NewReader(stream))
+	require.Nil(t, err)
+	require.Nil(t, iotest.TestReader(r, data))
+}
+
+func TestReader_Empty(t *testing.T) {
+	r, err := NewReader(bytes.NewReader(compressStream(t, nil)))
+	require.Nil(t, err)
+	got, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Empty(t, got)
+}
+
+func TestReader_Corrupted(t *testing.T) {
+	data := bytes.Repeat([]byte("go-huffman streaming reader "), 100)
+	stream := compressStream(t, data, WithBlockSize(512))
+
+	_, err := NewReader(bytes.NewReader([]byte{0x00, 0x01, 0x02, 0x03}))
+	require.ErrorIs(t, err, ErrInvalidStartFlag)
+
+	_, err = NewReader(bytes.NewReader(stream[:2]))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// 流被截断
+	r, err := NewReader(bytes.NewReader(stream[:len(stream)/2]))
+	require.Nil(t, err)
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// 最后一个块之后的校验和被破坏
+	broken := append([]byte(nil), stream...)
+	broken[len(broken)-5] ^= 0xFF
+	r, err = NewReader(bytes.NewReader(broken))
+	require.Nil(t, err)
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, ErrChecksumNotMatched)
+
+	// 关闭后不能再读
+	require.Nil(t, r.Close())
+	_, err = r.Read(make([]byte, 1))
+	require.ErrorIs(t, err, ErrReaderClosed)
+}
+
+// writerAtBuffer 是一个同时实现了io.Writer和io.WriterAt的内存缓冲区
+type writerAtBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *writerAtBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+func (b *writerAtBuffer) WriteAt(p []byte, off int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if end := int(off) + len(p); end > len(b.buf) {
+		b.buf = append(b.buf, make([]byte, end-len(b.buf))...)
+	}
+	copy(b.buf[off:], p)
+	return len(p), nil
+}
+
+func TestReader_WriteTo(t *testing.T) {
+	data := mixedData(1 << 19)
+	stream := compressStream(t, data, WithBlockSize(4096))
+
+	for _, concurrency := range []int{1, 2, 8} {
+		// 按顺序写入io.Writer
+		r, err := NewReader(bytes.NewReader(stream), WithReaderConcurrency(concurrency))
+		require.Nil(t, err)
+		var buf bytes.Buffer
+		n, err := io.Copy(&buf, r)
+		require.Nil(t, err)
+		require.EqualValues(t, len(data), n)
+		require.Equal(t, data, buf.Bytes())
+
+		// 写入io.WriterAt，先读出一部分数据
+		r, err = NewReader(bytes.NewReader(stream), WithReaderConcurrency(concurrency))
+		require.Nil(t, err)
+		var wa writerAtBuffer
+		_, err = io.CopyN(&wa, iotest.OneByteReader(r), 5000)
+		require.Nil(t, err)
+		n, err = r.WriteTo(&wa)
+		require.Nil(t, err)
+		require.EqualValues(t, len(data)-5000, n)
+		require.Equal(t, data, wa.buf)
+
+		n, err = r.WriteTo(&wa)
+		require.Nil(t, err)
+		require.Zero(t, n)
+	}
+
+	_, err := NewReader(bytes.NewReader(stream), WithReaderConcurrency(0))
+	require.ErrorIs(t, err, ErrInvalidConcurrency)
+	_, err = OpenSeekable(bytes.NewReader(stream), WithReaderConcurrency(-1))
+	require.ErrorIs(t, err, ErrInvalidConcurrency)
+}
+
+func TestReader_WriteToCorrupted(t *testing.T) {
+	text := bytes.Repeat([]byte("go-huffman parallel decoding "), 1000)
+	stream := compressStream(t, text, WithBlockSize(1000))
+	_, ends := blockTypes(t, stream)
+
+	broken := append([]byte(nil), stream...)
+	broken[ends[10]-Uint32ByteSize-1] ^= 0xFF
+
+	for _, concurrency := range []int{1, 4} {
+		r, err := NewReader(bytes.NewReader(broken), WithReaderConcurrency(concurrency))
+		require.Nil(t, err)
+		_, err = r.WriteTo(&writerAtBuffer{})
+		require.ErrorIs(t, err, ErrChecksumNotMatched)
+
+		r, err = NewReader(bytes.NewReader(broken), WithReaderConcurrency(concurrency), WithSkipCorruptBlocks())
+		require.Nil(t, err)
+		var wa writerAtBuffer
+		_, err = r.WriteTo(&wa)
+		require.Nil(t, err)
+		require.Equal(t, []int{10}, r.CorruptBlocks())
+		expected := append([]byte(nil), text...)
+		copy(expected[10000:11000], make([]byte, 1000))
+		require.Equal(t, expected, wa.buf)
+
+		// 流尾的校验和被破坏
+		broken := append([]byte(nil), stream...)
+		broken[len(broken)-5] ^= 0xFF
+		r, err = NewReader(bytes.NewReader(broken), WithReaderConcurrency(concurrency))
+		require.Nil(t, err)
+		_, err = r.WriteTo(io.Discard)
+		require.ErrorIs(t, err, ErrChecksumNotMatched)
+
+		// 下游写入失败
+		r, err = NewReader(bytes.NewReader(stream), WithReaderConcurrency(concurrency))
+		require.Nil(t, err)
+		_, err = r.WriteTo(&failingWriter{limit: 3000})
+		require.ErrorIs(t, err, errWriteFailed)
+	}
+}
+
+func BenchmarkReader_WriteTo(b *testing.B) {
+	data := mixedData(16 << 20)
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithBlockSize(1<<18))
+	if _, err := w.Write(data); err != nil {
+		b.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		b.Fatal(err)
+	}
+	stream := buf.Bytes()
+
+	for _, concurrency := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("concurrency-%d", concurrency), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				r, err := NewReader(bytes.NewReader(stream), WithReaderConcurrency(concurrency))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := r.WriteTo(io.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package huffman
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+var (
+	ErrWriterClosed              = fmt.Errorf("writer already closed")
+	ErrInvalidBlockSize          = fmt.Errorf("block size must be in range [1, %d]", MaxBlockSize)
+	ErrInvalidConcurrency        = fmt.Errorf("concurrency must be at least 1")
+	ErrInvalidCheckpointInterval = fmt.Errorf("checkpoint interval must not be negative")
+	ErrConflictingModels         = fmt.Errorf("only one of WithAdaptive, WithContextModeling and WithLZ77 can be used")
+)
+
+// WriterOption 用于配置Writer
+type WriterOption func(w *Writer)
+
+// WithBlockSize 设置每个块压缩前的字节数
+func WithBlockSize(size int) WriterOption {
+	return func(w *Writer) {
+		if size <= 0 || size > MaxBlockSize {
+			w.err = ErrInvalidBlockSize
+			return
+		}
+		w.blockSize = size
+	}
+}
+
+// WithConcurrency 设置同时压缩的块的最大数量，默认为1，即在调用Write的goroutine中依次压缩每个块
+// 大于1时每个块在单独的goroutine中压缩，无论并行数量是多少，压缩得到的数据都完全相同
+func WithConcurrency(n int) WriterOption {
+	return func(w *Writer) {
+		if n < 1 {
+			w.err = ErrInvalidConcurrency
+			return
+		}
+		w.concurrency = n
+	}
+}
+
+// WithSeekIndex 在流的末尾写入索引，压缩后的流可以通过OpenSeekable随机访问
+// interval为块内检查点之间的字节数，随机访问时最多需要多解码interval个字节；为0时只在每个块的开头记录检查点
+func WithSeekIndex(interval int) WriterOption {
+	return func(w *Writer) {
+		if interval < 0 {
+			w.err = ErrInvalidCheckpointInterval
+			return
+		}
+		w.flags |= StreamFlagSeekIndex
+		w.checkpointInterval = interval
+	}
+}
+
+// WithAdaptive 使用自适应Huffman编码压缩每个块，块中不需要存储码表，适合较小的数据
+// 压缩和解压时每个字节都要更新Huffman树，速度比默认的范式Huffman编码慢
+func WithAdaptive() WriterOption {
+	return func(w *Writer) {
+		w.setModel(BlockTypeAdaptive)
+	}
+}
+
+// WithContextModeling 使用order-1上下文模型压缩每个块，以前一个字节作为上下文，每个上下文使用各自的码表，
+// 出现次数少的上下文共用一个码表。文本和源代码等前后字节相关性强的数据压缩率更高，但是码表更大，适合较大的块
+func WithContextModeling() WriterOption {
+	return func(w *Writer) {
+		w.setModel(BlockTypeContext)
+	}
+}
+
+// WithLZ77 使用LZ77查找每个块中重复出现的字符串，字面量、匹配长度和匹配距离使用各自的Huffman码表压缩，
+// 日志、源代码等有大量重复字符串的数据压缩率远高于只统计字节频数的方式，但是压缩速度更慢
+func WithLZ77() WriterOption {
+	return func(w *Writer) {
+		w.setModel(BlockTypeLZ77)
+	}
+}
+
+// WithPresetTable 设置预置码表，每个块在该码表和根据块中数据构建的码表之间选择压缩后更小的一种，
+// 使用预置码表的块只存储码表的ID，解压时需要通过WithTableRegistry提供注册了该码表的TableRegistry。
+// table为带有转义码的EscapeEncTable时，块中有码表中没有的字节也可以使用预置码表
+func WithPresetTable(table ByteEncTable) WriterOption {
+	return func(w *Writer) {
+		preset, err := newPresetBlockTable(table)
+		if err != nil {
+			w.err = err
+			return
+		}
+		w.preset = preset
+	}
+}
+
+// Writer 是一个流式的压缩器，实现了io.WriteCloser接口
+// 写入的数据先缓存成块，每个块单独统计频数、构建Huffman码表并压缩后写入底层的io.Writer
+// 流的格式见container.go
+type Writer struct {
+	w           io.Writer
+	blockSize   int
+	buf         []byte
+	checksum    uint32
+	lastTable   *blockTable // 最近写出的码表
+	tableNum    uint32      // 已经写出的码表数量
+	concurrency int
+	pending     []*blockJob     // 正在并行压缩的块，按照块的顺序排列
+	chain       chan tableState // 最后一个并行压缩的块选择完码表后的状态
+	flags       byte
+	model       byte        // 不为0时每个块都使用该类型（BlockTypeAdaptive、BlockTypeContext或BlockTypeLZ77）压缩
+	preset      *blockTable // 预置码表
+	// 索引相关
+	checkpointInterval int
+	index              []indexEntry
+	written            uint64 // 已经写出的流的字节数
+	rawOffset          uint64 // 已经写出的块压缩前的字节数
+	wroteHeader        bool
+	closed             bool
+	err                error
+}
+
+// NewWriter 创建一个新的Writer，压缩后的数据写入w中
+// 调用方需要在写入完成后调用Close，Close不会关闭w
+func NewWriter(w io.Writer, opts ...WriterOption) *Writer {
+	zw := &Writer{
+		w:           w,
+		blockSize:   DefaultBlockSize,
+		concurrency: 1,
+	}
+	for _, opt := range opts {
+		opt(zw)
+	}
+
+	return zw
+}
+
+// setModel 设置每个块使用的压缩方式，WithAdaptive、WithContextModeling和WithLZ77同时使用时返回ErrConflictingModels
+func (z *Writer) setModel(model byte) {
+	if z.model != 0 && z.model != model {
+		z.err = ErrConflictingModels
+		return
+	}
+	z.model = model
+}
+
+// Write 实现io.Writer接口
+// 数据先写入内部缓冲区，缓冲区满一个块的时候压缩写出
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, ErrWriterClosed
+	}
+
+	n := 0
+	for len(p) > 0 {
+		room := z.blockSize - len(z.buf)
+		if room > len(p) {
+			room = len(p)
+		}
+		z.buf = append(z.buf, p[:room]...)
+		p = p[room:]
+		n += room
+
+		if len(z.buf) == z.blockSize {
+			if err := z.writeBlock(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Flush 将缓冲区中还没有写出的数据压缩成一个块写出，并等待所有正在并行压缩的块写出
+func (z *Writer) Flush() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return ErrWriterClosed
+	}
+	if len(z.buf) > 0 {
+		if err := z.writeBlock(); err != nil {
+			return err
+		}
+	}
+
+	return z.writePending(len(z.pending))
+}
+
+// Close 写出剩余的数据和流尾，不会关闭底层的io.Writer
+func (z *Writer) Close() error {
+	if z.closed {
+		return z.err
+	}
+	if err := z.Flush(); err != nil {
+		return err
+	}
+	if err := z.writeHeader(); err != nil {
+		return err
+	}
+	z.closed = true
+
+	var indexOffset uint64 = 0
+	if z.flags&StreamFlagSeekIndex != 0 {
+		indexOffset = z.written
+		if err := z.write(appendIndexBlock(nil, z.index)); err != nil {
+			return err
+		}
+	}
+
+	return z.write(appendStreamTail(nil, z.flags, z.checksum, indexOffset))
+}
+
+// writeHeader 写入流头
+func (z *Writer) writeHeader() error {
+	if z.wroteHeader {
+		return nil
+	}
+	z.wroteHeader = true
+
+	return z.write(appendStreamHeader(nil, z.flags))
+}
+
+// writeBlock 压缩缓冲区中的数据并写出
+func (z *Writer) writeBlock() error {
+	if err := z.writeHeader(); err != nil {
+		return err
+	}
+	z.checksum = crc32.Update(z.checksum, crc32q, z.buf)
+	if z.concurrency > 1 {
+		return z.writeBlockAsync()
+	}
+
+	if z.model != 0 {
+		block, err := buildModelBlock(z.buf, z.model)
+		if err != nil {
+			z.err = err
+			return err
+		}
+		z.buf = z.buf[:0]
+		return z.writeEncodedBlock(block, nil)
+	}
+
+	blockType, table, next := chooseBlock(planBlock(z.buf), len(z.buf), z.lastTable, z.tableNum, z.preset)
+	block, err := buildBlock(z.buf, blockType, table)
+	if err != nil {
+		z.err = err
+		return err
+	}
+	if next != z.lastTable {
+		z.lastTable = next
+		z.tableNum++
+	}
+	checkpoints := blockTypeCheckpoints(z.buf, blockType, table, z.checkpointInterval)
+	z.buf = z.buf[:0]
+
+	return z.writeEncodedBlock(block, checkpoints)
+}
+
+// writeEncodedBlock 写出压缩完成的块，需要索引时记录块的位置
+func (z *Writer) writeEncodedBlock(block []byte, checkpoints []checkpoint) error {
+	if z.flags&StreamFlagSeekIndex != 0 && z.err == nil {
+		rawSize, _ := readNextUint32(block, 1)
+		z.index = append(z.index, indexEntry{
+			blockType:   block[0],
+			offset:      z.written,
+			rawOffset:   z.rawOffset,
+			rawSize:     rawSize,
+			checkpoints: checkpoints,
+		})
+		z.rawOffset += uint64(rawSize)
+	}
+
+	return z.write(block)
+}
+
+// writeBlockAsync 在新的goroutine中压缩缓冲区中的数据，压缩完成的块由writePending按照顺序写出
+func (z *Writer) writeBlockAsync() error {
+	// 正在压缩的块达到上限时，先等待最早的块压缩完成并写出
+	if len(z.pending) == z.concurrency {
+		if err := z.writePending(1); err != nil {
+			return err
+		}
+	}
+
+	if z.chain == nil {
+		z.chain = make(chan tableState, 1)
+		z.chain <- tableState{last: z.lastTable, num: z.tableNum}
+	}
+	job := &blockJob{
+		data:     z.buf,
+		prev:     z.chain,
+		next:     make(chan tableState, 1),
+		done:     make(chan struct{}),
+		interval: z.checkpointInterval,
+		model:    z.model,
+		preset:   z.preset,
+	}
+	z.chain = job.next
+	z.pending = append(z.pending, job)
+	z.buf = nil
+	go job.run()
+
+	return nil
+}
+
+// writePending 按照顺序写出最早的n个正在并行压缩的块
+func (z *Writer) writePending(n int) error {
+	for ; n > 0; n-- {
+		job := z.pending[0]
+		<-job.done
+		z.pending = z.pending[1:]
+		if job.err != nil && z.err == nil {
+			z.err = job.err
+		}
+		if err := z.writeEncodedBlock(job.block, job.checkpoints); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tableState 是依次选择码表时在块之间传递的状态
+type tableState struct {
+	last *blockTable // 最近写出的码表
+	num  uint32      // 已经写出的码表数量
+}
+
+// blockJob 是一个并行压缩的块
+// 统计频数和压缩在各自的goroutine中并行进行，只有选择码表需要等待前一个块的选择结果
+type blockJob struct {
+	data     []byte
+	prev     <-chan tableState
+	next     chan tableState
+	done     chan struct{}
+	interval int // 块内检查点之间的字节数，不需要索引时为0
+	model    byte
+	preset   *blockTable
+
+	block       []byte
+	checkpoints []checkpoint
+	err         error
+}
+
+func (j *blockJob) run() {
+	defer close(j.done)
+
+	if j.model != 0 {
+		// 不使用流中的码表，直接传递前一个块的状态
+		j.next <- <-j.prev
+		j.block, j.err = buildModelBlock(j.data, j.model)
+		return
+	}
+
+	plan := planBlock(j.data)
+	state := <-j.prev
+	blockType, table, last := chooseBlock(plan, len(j.data), state.last, state.num, j.preset)
+	next := tableState{last: last, num: state.num}
+	if last != state.last {
+		next.num++
+	}
+	j.next <- next
+
+	j.block, j.err = buildBlock(j.data, blockType, table)
+	j.checkpoints = blockTypeCheckpoints(j.data, blockType, table, j.interval)
+}
+
+// write 写入底层的io.Writer，出错后的写入都直接返回错误
+func (z *Writer) write(p []byte) error {
+	if z.err != nil {
+		return z.err
+	}
+	n, err := z.w.Write(p)
+	z.written += uint64(n)
+	if err != nil {
+		z.err = err
+		return err
+	}
+	return nil
+}
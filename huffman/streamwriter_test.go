@@ -0,0 +1,238 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// parseStream 按照流格式逐块解压，返回解压后的数据和块的数量
+func parseStream(t *testing.T, stream []byte) ([]byte, int) {
+	r := bytes.NewReader(stream)
+	flags, err := readStreamHeader(r)
+	require.Nil(t, err)
+
+	var data []byte
+	var tables blockTables
+	blocks := 0
+	for {
+		blk, err := readBlock(r)
+		require.Nil(t, err)
+		if blk.blockType == BlockTypeEnd {
+			break
+		}
+		if blk.blockType == BlockTypeIndex {
+			continue
+		}
+
+		var block []byte
+		if blk.blockType == BlockTypeStored {
+			block = blk.payload
+		} else if isModelBlock(blk.blockType) {
+			block, err = decodeModelBlock(blk)
+			require.Nil(t, err)
+		} else {
+			if blk.blockType == BlockTypeHuffman {
+				tables.add(blk.lengths)
+			}
+			decoder, err := tables.decoderFor(blk)
+			require.Nil(t, err)
+			block, err = decoder.Decode(blk.payload, blk.bitLen)
+			require.Nil(t, err)
+		}
+		require.EqualValues(t, blk.rawSize, len(block))
+
+		data = append(data, block...)
+		blocks++
+	}
+
+	require.Nil(t, readStreamTail(r, flags, crc32.Checksum(data, crc32q)))
+	require.Equal(t, 0, r.Len())
+
+	return data, blocks
+}
+
+func TestWriter(t *testing.T) {
+	data, err := os.ReadFile("test/test_data.txt")
+	require.Nil(t, err)
+
+	testCases := []struct {
+		BlockSize int
+		ChunkSize int
+	}{
+		{BlockSize: DefaultBlockSize, ChunkSize: len(data)},
+		{BlockSize: 1024, ChunkSize: 1},
+		{BlockSize: 1000, ChunkSize: 333},
+		{BlockSize: 4096, ChunkSize: 5000},
+	}
+
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, WithBlockSize(tc.BlockSize))
+		for i := 0; i < len(data); i += tc.ChunkSize {
+			end := i + tc.ChunkSize
+			if end > len(data) {
+				end = len(data)
+			}
+			n, err := w.Write(data[i:end])
+			require.Nil(t, err)
+			require.Equal(t, end-i, n)
+		}
+		require.Nil(t, w.Close())
+
+		got, blocks := parseStream(t, buf.Bytes())
+		require.Equal(t, data, got)
+		require.Equal(t, (len(data)+tc.BlockSize-1)/tc.BlockSize, blocks)
+	}
+}
+
+func TestWriter_EmptyAndFlush(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.Nil(t, w.Close())
+	got, blocks := parseStream(t, buf.Bytes())
+	require.Empty(t, got)
+	require.Zero(t, blocks)
+
+	buf.Reset()
+	w = NewWriter(&buf)
+	_, err := io.WriteString(w, "hello ")
+	require.Nil(t, err)
+	require.Nil(t, w.Flush())
+	_, err = io.WriteString(w, "huffman")
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	got, blocks = parseStream(t, buf.Bytes())
+	require.Equal(t, "hello huffman", string(got))
+	require.Equal(t, 2, blocks)
+
+	// 关闭后不能再写入
+	_, err = w.Write([]byte("more"))
+	require.ErrorIs(t, err, ErrWriterClosed)
+	require.Nil(t, w.Close())
+}
+
+func TestWriter_InvalidBlockSize(t *testing.T) {
+	w := NewWriter(io.Discard, WithBlockSize(0))
+	_, err := w.Write([]byte("data"))
+	require.ErrorIs(t, err, ErrInvalidBlockSize)
+	require.ErrorIs(t, w.Close(), ErrInvalidBlockSize)
+}
+
+// mixedData 生成分布不断变化的数据，既有新码表，也有引用码表和直接存储的块
+func mixedData(size int) []byte {
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 0, size)
+	for len(data) < size {
+		n := 1 + rnd.Intn(5000)
+		switch rnd.Intn(3) {
+		case 0:
+			for i := 0; i < n; i++ {
+				data = append(data, byte(rnd.Intn(256)))
+			}
+		case 1:
+			alphabet := 2 + rnd.Intn(30)
+			for i := 0; i < n; i++ {
+				data = append(data, 'a'+byte(rnd.Intn(alphabet)))
+			}
+		default:
+			data = append(data, bytes.Repeat([]byte("go-huffman "), n/11+1)...)
+		}
+	}
+	return data[:size]
+}
+
+func TestWriter_Concurrency(t *testing.T) {
+	data := mixedData(1 << 20)
+	expected := compressStream(t, data, WithBlockSize(4096))
+
+	for _, concurrency := range []int{1, 2, 3, 8, 64} {
+		// 分多次写入并在中间Flush，输出仍然和串行压缩一致
+		var buf bytes.Buffer
+		w := NewWriter(&buf, WithBlockSize(4096), WithConcurrency(concurrency))
+		_, err := w.Write(data[:100000])
+		require.Nil(t, err)
+		require.Nil(t, w.Flush())
+		_, err = w.Write(data[100000:])
+		require.Nil(t, err)
+		require.Nil(t, w.Close())
+
+		got, _ := parseStream(t, buf.Bytes())
+		require.Equal(t, data, got)
+
+		stream := compressStream(t, data, WithBlockSize(4096), WithConcurrency(concurrency))
+		require.Equal(t, expected, stream)
+	}
+}
+
+// failingWriter 写入limit个字节后返回错误
+type failingWriter struct {
+	limit int
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > f.limit {
+		return 0, errWriteFailed
+	}
+	f.limit -= len(p)
+	return len(p), nil
+}
+
+func TestWriter_ConcurrencyError(t *testing.T) {
+	data := mixedData(1 << 18)
+
+	w := NewWriter(&failingWriter{limit: 20000}, WithBlockSize(1024), WithConcurrency(4))
+	_, err := w.Write(data)
+	require.ErrorIs(t, err, errWriteFailed)
+	require.ErrorIs(t, w.Close(), errWriteFailed)
+
+	w = NewWriter(io.Discard, WithConcurrency(0))
+	_, err = w.Write(data)
+	require.ErrorIs(t, err, ErrInvalidConcurrency)
+}
+
+func TestWriter_ConflictingModels(t *testing.T) {
+	for _, opts := range [][]WriterOption{
+		{WithAdaptive(), WithContextModeling()},
+		{WithContextModeling(), WithLZ77()},
+		{WithLZ77(), WithAdaptive()},
+	} {
+		w := NewWriter(io.Discard, opts...)
+		_, err := w.Write([]byte("data"))
+		require.ErrorIs(t, err, ErrConflictingModels)
+		require.ErrorIs(t, w.Close(), ErrConflictingModels)
+	}
+
+	// 重复使用同一个选项不算冲突
+	w := NewWriter(io.Discard, WithLZ77(), WithLZ77())
+	_, err := w.Write([]byte("data"))
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+}
+
+func BenchmarkWriter(b *testing.B) {
+	data := mixedData(16 << 20)
+	for _, concurrency := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("concurrency-%d", concurrency), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				w := NewWriter(io.Discard, WithBlockSize(1<<18), WithConcurrency(concurrency))
+				if _, err := w.Write(data); err != nil {
+					b.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -11,23 +11,56 @@ type huffmanDeserializer interface {
 	ItemNum() int
 }
 
-// Huffman编码码表
+// ByteEncTable 是以字节为符号的编码表，HuffmanEncTable、WideHuffmanEncTable和EscapeEncTable都实现了该接口
+// 压缩和序列化只通过它读取编码，HuffmanEncTable直接使用24位的HuffmanCode，不需要先转换成WideHuffmanEncTable
+type ByteEncTable interface {
+	ItemNum() int
+	// Code 返回字节对应的编码，字节不在编码表中时ok为false
+	Code(key byte) (code HuffmanCodeInterface, ok bool)
+}
+
+// ByteDecTable 是以字节为符号的解码表，HuffmanDecTable和WideHuffmanDecTable都实现了该接口
+type ByteDecTable interface {
+	ItemNum() int
+	// Lookup 返回编码对应的字节
+	Lookup(code HuffmanCodeInterface) (byte, bool)
+	// Range 对解码表中的每一项调用fn
+	Range(fn func(code HuffmanCodeInterface, b byte))
+}
+
+var (
+	_ ByteEncTable = HuffmanEncTable(nil)
+	_ ByteEncTable = WideHuffmanEncTable(nil)
+	_ ByteEncTable = (*EscapeEncTable)(nil)
+	_ ByteDecTable = HuffmanDecTable(nil)
+	_ ByteDecTable = WideHuffmanDecTable(nil)
+)
+
+// Huffman编码码表，编码不超过MaxHuffmanCodeBitLen比特
 type HuffmanEncTable map[byte]*HuffmanCode
 
 // Huffman解码码表
 type HuffmanDecTable map[HuffmanCode]byte
 
+// 宽编码的Huffman编码码表，编码最长MaxWideHuffmanCodeBitLen比特，是EncTable[byte]的特化版本
+type WideHuffmanEncTable map[byte]*WideHuffmanCode
+
+// 宽编码的Huffman解码码表，是DecTable[byte]的特化版本
+type WideHuffmanDecTable map[WideHuffmanCode]byte
+
 const (
-	HuffmanEncTableSerStartFlag uint32 = 0x48464553 // "HFES"
-	HuffmanEncTableSerEndFlag   uint32 = 0x48464545 // "HFEE"
-	ChecksumPoly                       = 0xD5828281
+	HuffmanEncTableSerStartFlag     uint32 = 0x48464553 // "HFES"
+	HuffmanEncTableSerWideStartFlag uint32 = 0x48464557 // "HFEW"
+	HuffmanEncTableSerEndFlag       uint32 = 0x48464545 // "HFEE"
+	ChecksumPoly                           = 0xD5828281
 )
 
 const (
 	MetaSize               = 4            // flag or numbder size
 	MinHuffmanTableSerSize = 4 * MetaSize // bytes
 
-	TableItemSize = 5 // bytes
+	TableItemSize     = 5  // bytes
+	WideTableItemSize = 10 // bytes
 )
 
 var (
@@ -37,19 +70,25 @@ var (
 	ErrCursorOverflow     = fmt.Errorf("cursor overflow")
 	ErrChecksumNotMatched = fmt.Errorf("checksum not matched")
 	ErrDeserialize        = fmt.Errorf("parse error")
+	ErrCodeTooLong        = fmt.Errorf("huffman code exceeds %d bits", MaxHuffmanCodeBitLen)
 )
 
 var (
 	crc32q = crc32.MakeTable(ChecksumPoly)
 )
 
-func NewHuffmanEncTable(tree *HuffmanTree) HuffmanEncTable {
+// NewHuffmanEncTable 根据Huffman树创建编码表
+// 存在超过MaxHuffmanCodeBitLen比特的编码时返回ErrCodeTooLong，这时需要使用NewWideHuffmanEncTable
+func NewHuffmanEncTable(tree *HuffmanTree) (HuffmanEncTable, error) {
 	table := make(HuffmanEncTable, len(tree.Leaves))
 	for _, leaf := range tree.Leaves {
+		if leaf.Code == nil {
+			return nil, fmt.Errorf("%w: byte %d has %d bits", ErrCodeTooLong, leaf.Byte, leaf.WideCode.BitLen())
+		}
 		table[leaf.Byte] = leaf.Code
 	}
 
-	return table
+	return table, nil
 }
 
 // Get 获取HuffmanEncTable中的编码
@@ -65,6 +104,15 @@ func (h HuffmanEncTable) ItemNum() int {
 	return len(h)
 }
 
+// Code 返回字节对应的编码
+func (h HuffmanEncTable) Code(key byte) (HuffmanCodeInterface, bool) {
+	code, ok := h[key]
+	if !ok {
+		return nil, false
+	}
+	return code, true
+}
+
 // Equals 判断两个HuffmanEncTable是否相同
 func (h HuffmanEncTable) Equals(other HuffmanEncTable) bool {
 	if len(h) != len(other) {
@@ -83,13 +131,22 @@ func (h HuffmanEncTable) Equals(other HuffmanEncTable) bool {
 }
 
 func (h HuffmanEncTable) PrettyString() string {
-	prettyStringBuilder := strings.Builder{}
-	prettyStringBuilder.Grow(1024)
+	return prettyString(h)
+}
+
+// Serialize 将HuffmanEncTable序列化到字节切片中，格式见WideHuffmanEncTable.Serialize
+func (h HuffmanEncTable) Serialize() ([]byte, error) {
+	return serializeEncTable(h), nil
+}
+
+// Wide 把编码表转换成WideHuffmanEncTable
+func (h HuffmanEncTable) Wide() WideHuffmanEncTable {
+	table := make(WideHuffmanEncTable, len(h))
 	for k, v := range h {
-		prettyStringBuilder.WriteString(fmt.Sprintf("%d(%#X)[%c]: %s(len=%d)\n", k, k, k, v.String(), len(v.String())))
+		table[k] = newCode(v.Value(), v.BitLen())
 	}
 
-	return prettyStringBuilder.String()
+	return table
 }
 
 func NewHuffmanDecTable(n int) HuffmanDecTable {
@@ -107,7 +164,136 @@ func (h HuffmanDecTable) ItemNum() int {
 	return len(h)
 }
 
-// Serialize 将HuffmanEncTable序列化到字节切片中
+// Lookup 返回编码对应的字节，超过MaxHuffmanCodeBitLen比特的编码一定不在解码表中
+func (h HuffmanDecTable) Lookup(code HuffmanCodeInterface) (byte, bool) {
+	if c, ok := code.(*HuffmanCode); ok {
+		v, ok := h[*c]
+		return v, ok
+	}
+	if code.BitLen() > MaxHuffmanCodeBitLen {
+		return 0, false
+	}
+	v, ok := h[*newHuffmanCode(uint32(code.Value()), code.BitLen())]
+	return v, ok
+}
+
+// Range 对解码表中的每一项调用fn
+func (h HuffmanDecTable) Range(fn func(code HuffmanCodeInterface, b byte)) {
+	for k, v := range h {
+		k := k
+		fn(&k, v)
+	}
+}
+
+// Wide 把解码表转换成WideHuffmanDecTable
+func (h HuffmanDecTable) Wide() WideHuffmanDecTable {
+	table := make(WideHuffmanDecTable, len(h))
+	for k, v := range h {
+		table[wideKey(newCode(k.Value(), k.BitLen()))] = v
+	}
+
+	return table
+}
+
+// NewWideHuffmanEncTable 根据Huffman树创建宽编码的编码表
+func NewWideHuffmanEncTable(tree *HuffmanTree) WideHuffmanEncTable {
+	table := make(WideHuffmanEncTable, len(tree.Leaves))
+	for _, leaf := range tree.Leaves {
+		table[leaf.Byte] = leaf.WideCode
+	}
+
+	return table
+}
+
+// Get 获取WideHuffmanEncTable中的编码
+func (h WideHuffmanEncTable) Get(key byte) *WideHuffmanCode {
+	return EncTable[byte](h).Get(key)
+}
+
+// ItemNum 返回WideHuffmanEncTable中表项的数量
+func (h WideHuffmanEncTable) ItemNum() int {
+	return len(h)
+}
+
+// Code 返回字节对应的编码
+func (h WideHuffmanEncTable) Code(key byte) (HuffmanCodeInterface, bool) {
+	code, ok := h[key]
+	if !ok {
+		return nil, false
+	}
+	return code, true
+}
+
+// Equals 判断两个WideHuffmanEncTable是否相同
+func (h WideHuffmanEncTable) Equals(other WideHuffmanEncTable) bool {
+	if len(h) != len(other) {
+		return false
+	}
+	for k, v := range h {
+		ov, ok := other[k]
+		if !ok {
+			return false
+		}
+		if ov.BitLen() != v.BitLen() || ov.Value() != v.Value() {
+			return false
+		}
+	}
+	return true
+}
+
+func (h WideHuffmanEncTable) PrettyString() string {
+	return prettyString(h)
+}
+
+// prettyString 按字节顺序列出编码表中的每一项
+func prettyString(h ByteEncTable) string {
+	prettyStringBuilder := strings.Builder{}
+	prettyStringBuilder.Grow(1024)
+	for i := 0; i < MaxSymbolNum; i++ {
+		k := byte(i)
+		v, ok := h.Code(k)
+		if !ok {
+			continue
+		}
+		prettyStringBuilder.WriteString(fmt.Sprintf("%d(%#X)[%c]: %s(len=%d)\n", k, k, k, v.String(), len(v.String())))
+	}
+
+	return prettyStringBuilder.String()
+}
+
+func NewWideHuffmanDecTable(n int) WideHuffmanDecTable {
+	return make(WideHuffmanDecTable, n)
+}
+
+// Get 获取某个编码所对应的字节
+func (h WideHuffmanDecTable) Get(key *WideHuffmanCode) (byte, bool) {
+	return DecTable[byte](h).Get(key)
+}
+
+// ItemNum 返回WideHuffmanDecTable中表项的数量
+func (h WideHuffmanDecTable) ItemNum() int {
+	return len(h)
+}
+
+// Lookup 返回编码对应的字节
+func (h WideHuffmanDecTable) Lookup(code HuffmanCodeInterface) (byte, bool) {
+	if c, ok := code.(*WideHuffmanCode); ok {
+		v, ok := h[*c]
+		return v, ok
+	}
+	v, ok := h[WideHuffmanCode{bits: code.Value(), bitLen: uint8(code.BitLen())}]
+	return v, ok
+}
+
+// Range 对解码表中的每一项调用fn
+func (h WideHuffmanDecTable) Range(fn func(code HuffmanCodeInterface, b byte)) {
+	for k, v := range h {
+		k := k
+		fn(&k, v)
+	}
+}
+
+// Serialize 将WideHuffmanEncTable序列化到字节切片中
 // 序列化格式如下（大端序：高位放在低地址，低位放在高地址）
 // START_FLAG				4 bytes
 // NUMBER OF TABLE ITEMS	4 bytes (uint32)
@@ -117,27 +303,59 @@ func (h HuffmanDecTable) ItemNum() int {
 // TABLE_ITEM_N(BYTE+CODE)	1+4=5 bytes
 // CRC32					4 bytes
 // END_FLAG					4 bytes
-func (h HuffmanEncTable) Serialize() ([]byte, error) {
-	n := len(h)
-	size := MinHuffmanTableSerSize + 5*n
+//
+// 如果存在超过24位的编码，则开始标志为HuffmanEncTableSerWideStartFlag，表项格式为
+// TABLE_ITEM(BYTE+BITLEN+CODE)	1+1+8=10 bytes，其中CODE为右对齐的比特位
+func (h WideHuffmanEncTable) Serialize() ([]byte, error) {
+	return serializeEncTable(h), nil
+}
+
+// serializeEncTable 将编码表序列化到字节切片中，格式见WideHuffmanEncTable.Serialize
+func serializeEncTable(h ByteEncTable) []byte {
+	n := h.ItemNum()
+	wide := isWideTable(h)
+	itemSize := TableItemSize
+	startFlag := HuffmanEncTableSerStartFlag
+	if wide {
+		itemSize = WideTableItemSize
+		startFlag = HuffmanEncTableSerWideStartFlag
+	}
+	size := MinHuffmanTableSerSize + itemSize*n
 	ser := make([]byte, 0, size)
 
 	// 写入开始标志
-	ser = writeUint32ToBytes(HuffmanEncTableSerStartFlag, ser)
+	ser = writeUint32ToBytes(startFlag, ser)
 	// 写入数量
 	ser = writeUint32ToBytes(uint32(n), ser)
 	// 写入表项
-	for key, code := range h {
-		ser = append(ser, key)
-		ser = writeUint32ToBytes(code.AllBits(), ser)
-	}
+	ser = appendTableItems(ser, h, wide)
 	// 写入前面内容的校验和
 	checksum := crc32.Checksum(ser, crc32q)
 	ser = writeUint32ToBytes(checksum, ser)
 
 	// 写入结束标志
-	ser = writeUint32ToBytes(HuffmanEncTableSerEndFlag, ser)
-	return ser, nil
+	return writeUint32ToBytes(HuffmanEncTableSerEndFlag, ser)
+}
+
+// appendTableItems 将表项追加到ser中，按字节顺序写入保证序列化结果稳定
+func appendTableItems(ser []byte, h ByteEncTable, wide bool) []byte {
+	for i := 0; i < MaxSymbolNum; i++ {
+		key := byte(i)
+		code, ok := h.Code(key)
+		if !ok {
+			continue
+		}
+		ser = append(ser, key)
+		if wide {
+			ser = append(ser, byte(code.BitLen()))
+			ser = writeUint64ToBytes(code.Value(), ser)
+		} else if c, ok := code.(*HuffmanCode); ok {
+			ser = writeUint32ToBytes(c.AllBits(), ser)
+		} else {
+			ser = writeUint32ToBytes(newHuffmanCode(uint32(code.Value()), code.BitLen()).AllBits(), ser)
+		}
+	}
+	return ser
 }
 
 func parseFlag(data []byte, cursor int, flag uint32) (int, error) {
@@ -154,14 +372,20 @@ func parseFlag(data []byte, cursor int, flag uint32) (int, error) {
 	return cursor, nil
 }
 
-func parseStartFlag(data []byte, cursor int) (int, error) {
-	// 读开始标志
-	cursor, err := parseFlag(data, cursor, HuffmanEncTableSerStartFlag)
+// parseStartFlag 读开始标志，同时返回表项是否为宽编码格式
+func parseStartFlag(data []byte, cursor int) (int, bool, error) {
+	got, err := readNextUint32(data, cursor)
 	if err != nil {
-		return 0, ErrInvalidStartFlag
+		return 0, false, err
+	}
+	switch got {
+	case HuffmanEncTableSerStartFlag:
+		return cursor + MetaSize, false, nil
+	case HuffmanEncTableSerWideStartFlag:
+		return cursor + MetaSize, true, nil
 	}
 
-	return cursor, nil
+	return 0, false, ErrInvalidStartFlag
 }
 
 func parseEndFlag(data []byte, cursor int) (int, error) {
@@ -185,16 +409,16 @@ func parseItemNum(data []byte, cursor int) (int, int, error) {
 	return int(itemNum), cursor, nil
 }
 
-func parseEncTable(data []byte, cursor int, itemNum int) (HuffmanEncTable, int, error) {
-	retHuff := make(HuffmanEncTable, itemNum)
+func parseEncTable(data []byte, cursor int, itemNum int, wide bool) (WideHuffmanEncTable, int, error) {
+	retHuff := make(WideHuffmanEncTable, itemNum)
 
 	for i := 0; i < int(itemNum); i++ {
-		key, code, err := readNextTableItem(data, cursor)
+		key, code, size, err := readNextTableItem(data, cursor, wide)
 		if err != nil {
 			return nil, 0, err
 		}
-		cursor += TableItemSize
-		retHuff[key] = &HuffmanCode{bits: code}
+		cursor += size
+		retHuff[key] = code
 	}
 
 	return retHuff, cursor, nil
@@ -216,22 +440,22 @@ func validateChecksum(data []byte, cursor int) (int, error) {
 	return cursor, nil
 }
 
-func parseDecTable(data []byte, cursor int, itemNum int) (HuffmanDecTable, int, error) {
-	retHuff := make(HuffmanDecTable, itemNum)
+func parseDecTable(data []byte, cursor int, itemNum int, wide bool) (WideHuffmanDecTable, int, error) {
+	retHuff := make(WideHuffmanDecTable, itemNum)
 
 	for i := 0; i < int(itemNum); i++ {
-		key, code, err := readNextTableItem(data, cursor)
+		key, code, size, err := readNextTableItem(data, cursor, wide)
 		if err != nil {
 			return nil, 0, err
 		}
-		cursor += TableItemSize
-		retHuff[HuffmanCode{bits: code}] = key
+		cursor += size
+		retHuff[wideKey(code)] = key
 	}
 
 	return retHuff, cursor, nil
 }
 
-type huffTableItemParser func(data []byte, cursor int, itemNum int) (huffmanDeserializer, int, error)
+type huffTableItemParser func(data []byte, cursor int, itemNum int, wide bool) (huffmanDeserializer, int, error)
 
 // 反序列化字节切片
 func deserialize(data []byte, parser huffTableItemParser) (huffmanDeserializer, error) {
@@ -242,7 +466,7 @@ func deserialize(data []byte, parser huffTableItemParser) (huffmanDeserializer,
 
 	// 读开始标志
 	cursor := 0
-	cursor, err := parseStartFlag(data, cursor)
+	cursor, wide, err := parseStartFlag(data, cursor)
 	if err != nil {
 		return nil, err
 	}
@@ -254,7 +478,7 @@ func deserialize(data []byte, parser huffTableItemParser) (huffmanDeserializer,
 	}
 
 	// 解析表项内容
-	huffTable, cursor, err := parser(data, cursor, itemNum)
+	huffTable, cursor, err := parser(data, cursor, itemNum, wide)
 	if err != nil {
 		return nil, err
 	}
@@ -275,51 +499,119 @@ func deserialize(data []byte, parser huffTableItemParser) (huffmanDeserializer,
 }
 
 // DeserializeHuffmanEncTable 将字节切片反序列回HuffmanEncTable
+// 存在超过MaxHuffmanCodeBitLen比特的编码时返回ErrCodeTooLong
 func DeserializeHuffmanEncTable(data []byte) (HuffmanEncTable, error) {
-	huffTable, err := deserialize(data, func(data []byte, cursor, itemNum int) (huffmanDeserializer, int, error) {
-		return parseEncTable(data, cursor, itemNum)
+	wide, err := DeserializeWideHuffmanEncTable(data)
+	if err != nil {
+		return nil, err
+	}
+
+	table := make(HuffmanEncTable, len(wide))
+	for k, v := range wide {
+		if v.BitLen() > MaxHuffmanCodeBitLen {
+			return nil, fmt.Errorf("%w: byte %d has %d bits", ErrCodeTooLong, k, v.BitLen())
+		}
+		table[k] = newHuffmanCode(uint32(v.Value()), v.BitLen())
+	}
+
+	return table, nil
+}
+
+// DeserializeHuffmanDecTable 将字节切片反序列回HuffmanDecTable
+// 存在超过MaxHuffmanCodeBitLen比特的编码时返回ErrCodeTooLong
+func DeserializeHuffmanDecTable(data []byte) (HuffmanDecTable, error) {
+	wide, err := DeserializeWideHuffmanDecTable(data)
+	if err != nil {
+		return nil, err
+	}
+
+	table := make(HuffmanDecTable, len(wide))
+	for k, v := range wide {
+		if k.BitLen() > MaxHuffmanCodeBitLen {
+			return nil, fmt.Errorf("%w: byte %d has %d bits", ErrCodeTooLong, v, k.BitLen())
+		}
+		table[*newHuffmanCode(uint32(k.Value()), k.BitLen())] = v
+	}
+
+	return table, nil
+}
+
+// DeserializeWideHuffmanEncTable 将字节切片反序列回WideHuffmanEncTable，两种序列化格式都可以读取
+func DeserializeWideHuffmanEncTable(data []byte) (WideHuffmanEncTable, error) {
+	huffTable, err := deserialize(data, func(data []byte, cursor, itemNum int, wide bool) (huffmanDeserializer, int, error) {
+		return parseEncTable(data, cursor, itemNum, wide)
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	if encTable, ok := huffTable.(HuffmanEncTable); ok {
+	if encTable, ok := huffTable.(WideHuffmanEncTable); ok {
 		return encTable, nil
 	}
 	return nil, ErrDeserialize
 }
 
-// DeserializeHuffmanDecTable 将字节切片反序列回HuffmanDecTable
-func DeserializeHuffmanDecTable(data []byte) (HuffmanDecTable, error) {
-	huffTable, err := deserialize(data, func(data []byte, cursor, itemNum int) (huffmanDeserializer, int, error) {
-		return parseDecTable(data, cursor, itemNum)
+// DeserializeWideHuffmanDecTable 将字节切片反序列回WideHuffmanDecTable，两种序列化格式都可以读取
+func DeserializeWideHuffmanDecTable(data []byte) (WideHuffmanDecTable, error) {
+	huffTable, err := deserialize(data, func(data []byte, cursor, itemNum int, wide bool) (huffmanDeserializer, int, error) {
+		return parseDecTable(data, cursor, itemNum, wide)
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	if decTable, ok := huffTable.(HuffmanDecTable); ok {
+	if decTable, ok := huffTable.(WideHuffmanDecTable); ok {
 		return decTable, nil
 	}
 	return nil, ErrDeserialize
 }
 
-// readNextTableItem 读下一个表项
-func readNextTableItem(buf []byte, start int) (byte, uint32, error) {
+// readNextTableItem 读下一个表项，返回表项的字节、编码和表项占用的字节数
+func readNextTableItem(buf []byte, start int, wide bool) (byte, *WideHuffmanCode, int, error) {
+	itemSize := TableItemSize
+	if wide {
+		itemSize = WideTableItemSize
+	}
 	n := len(buf)
-	if n < TableItemSize {
-		return 0, 0, ErrInvalidSize
+	if n < itemSize {
+		return 0, nil, 0, ErrInvalidSize
 	}
-	if start+TableItemSize-1 > n {
-		return 0, 0, ErrCursorOverflow
+	if start+itemSize > n {
+		return 0, nil, 0, ErrCursorOverflow
 	}
 
 	key := buf[start]
-	code, err := readNextUint32(buf, start+1)
+	if !wide {
+		code, err := readNextUint32(buf, start+1)
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		hc := &HuffmanCode{bits: code}
+		if hc.BitLen() > MaxHuffmanCodeBitLen {
+			return 0, nil, 0, ErrDeserialize
+		}
+		return key, newCode(hc.Value(), hc.BitLen()), itemSize, nil
+	}
+
+	bitLen := int(buf[start+1])
+	if bitLen > MaxWideHuffmanCodeBitLen {
+		return 0, nil, 0, ErrDeserialize
+	}
+	code, err := readNextUint64(buf, start+2)
 	if err != nil {
-		return 0, 0, err
+		return 0, nil, 0, err
+	}
+	return key, newCode(code, bitLen), itemSize, nil
+}
+
+// isWideTable 判断编码表中是否存在超过24位的编码
+func isWideTable(h ByteEncTable) bool {
+	for i := 0; i < MaxSymbolNum; i++ {
+		if code, ok := h.Code(byte(i)); ok && code.BitLen() > MaxHuffmanCodeBitLen {
+			return true
+		}
 	}
-	return key, code, nil
+	return false
 }
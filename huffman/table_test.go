@@ -3,6 +3,7 @@ package huffman
 import (
 	"io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -19,7 +20,8 @@ func TestHuffmanTable_SerializeAndDeserialize(t *testing.T) {
 	// 获得HuffmanTable
 	freq := CountFrequencies(data)
 	tree := NewHuffmanTree(freq)
-	table := NewHuffmanEncTable(tree)
+	table, err := NewHuffmanEncTable(tree)
+	require.Nil(t, err)
 	// 序列化
 	ser, err := table.Serialize()
 	require.Nil(t, err)
@@ -40,3 +42,108 @@ func TestHuffmanTable_SerializeAndDeserialize(t *testing.T) {
 	require.True(t, deTable.Equals(table))
 	require.True(t, table.Equals(deTable))
 }
+
+// 存在超过24位的编码时，使用宽编码格式序列化
+func TestHuffmanTable_SerializeAndDeserializeWide(t *testing.T) {
+	table := NewWideHuffmanEncTable(NewHuffmanTree(fibonacciFrequencies(48), MaxWideHuffmanCodeBitLen))
+	require.True(t, isWideTable(table))
+
+	ser, err := table.Serialize()
+	require.Nil(t, err)
+	require.Equal(t, MinHuffmanTableSerSize+WideTableItemSize*table.ItemNum(), len(ser))
+
+	deTable, err := DeserializeWideHuffmanEncTable(ser)
+	require.Nil(t, err)
+	require.True(t, deTable.Equals(table))
+
+	decTable, err := DeserializeWideHuffmanDecTable(ser)
+	require.Nil(t, err)
+	require.Equal(t, table.ItemNum(), decTable.ItemNum())
+	for k, code := range table {
+		got, ok := decTable.Get(code)
+		require.True(t, ok)
+		require.Equal(t, k, got)
+	}
+}
+
+// 24位的码表和宽编码码表可以互相转换，超过24位的编码不能放进24位的码表
+func TestHuffmanTable_Wide(t *testing.T) {
+	tree := NewHuffmanTree(CountFrequencies([]byte("aaaabbbccd")))
+	table, err := NewHuffmanEncTable(tree)
+	require.Nil(t, err)
+	require.True(t, table.Wide().Equals(NewWideHuffmanEncTable(tree)))
+
+	ser, err := table.Serialize()
+	require.Nil(t, err)
+	wideSer, err := NewWideHuffmanEncTable(tree).Serialize()
+	require.Nil(t, err)
+	require.Equal(t, wideSer, ser)
+
+	decTable, err := DeserializeHuffmanDecTable(ser)
+	require.Nil(t, err)
+	wideDecTable, err := DeserializeWideHuffmanDecTable(ser)
+	require.Nil(t, err)
+	require.Equal(t, wideDecTable, decTable.Wide())
+
+	wideTree := NewHuffmanTree(fibonacciFrequencies(30), MaxWideHuffmanCodeBitLen)
+	_, err = NewHuffmanEncTable(wideTree)
+	require.ErrorIs(t, err, ErrCodeTooLong)
+	ser, err = NewWideHuffmanEncTable(wideTree).Serialize()
+	require.Nil(t, err)
+	_, err = DeserializeHuffmanEncTable(ser)
+	require.ErrorIs(t, err, ErrCodeTooLong)
+	_, err = DeserializeHuffmanDecTable(ser)
+	require.ErrorIs(t, err, ErrCodeTooLong)
+}
+
+// 24位的码表和宽编码码表都通过ByteEncTable和ByteDecTable压缩和解压，结果相同
+func TestHuffmanTable_ByteTables(t *testing.T) {
+	data, err := os.ReadFile("test/test_data.txt")
+	require.Nil(t, err)
+	tree := NewHuffmanTree(CountFrequencies(data))
+	table, err := NewHuffmanEncTable(tree)
+	require.Nil(t, err)
+	wideTable := NewWideHuffmanEncTable(tree)
+
+	compressed, bitLen, err := compressBytesWith(data, table)
+	require.Nil(t, err)
+	wideCompressed, wideBitLen, err := compressBytesWith(data, wideTable)
+	require.Nil(t, err)
+	require.Equal(t, wideBitLen, bitLen)
+	require.Equal(t, wideCompressed, compressed)
+	require.Equal(t, wideTable.PrettyString(), table.PrettyString())
+
+	ser, err := table.Serialize()
+	require.Nil(t, err)
+	decTable, err := DeserializeHuffmanDecTable(ser)
+	require.Nil(t, err)
+	wideDecTable, err := DeserializeWideHuffmanDecTable(ser)
+	require.Nil(t, err)
+	for _, dec := range []ByteDecTable{decTable, wideDecTable} {
+		recovered, err := DecompressBytes(compressed, bitLen, dec)
+		require.Nil(t, err)
+		require.Equal(t, data, recovered)
+		// 逐比特查表
+		recovered, err = NewBitsReaderWithDecoder(compressed, bitLen, dec, nil).ReadAll()
+		require.Nil(t, err)
+		require.Equal(t, data, recovered)
+
+		// 两种编码都可以在两种解码表中查找
+		code := wideTable.Get(data[0])
+		b, ok := dec.Lookup(code)
+		require.True(t, ok)
+		require.Equal(t, data[0], b)
+		b, ok = dec.Lookup(table.Get(data[0]))
+		require.True(t, ok)
+		require.Equal(t, data[0], b)
+		_, ok = dec.Lookup(NewWideHuffmanCodeFromString(strings.Repeat("1", MaxHuffmanCodeBitLen+1)))
+		require.False(t, ok)
+
+		n := 0
+		dec.Range(func(code HuffmanCodeInterface, b byte) {
+			require.Equal(t, wideTable.Get(b).String(), code.String())
+			n++
+		})
+		require.Equal(t, wideTable.ItemNum(), n)
+	}
+}
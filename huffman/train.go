@@ -0,0 +1,98 @@
+package huffman
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	ErrInvalidHoldout = fmt.Errorf("holdout must be in range [0, 1)")
+	ErrNoTrainingData = fmt.Errorf("no training data")
+)
+
+// TrainResult 是训练预置码表的结果
+type TrainResult struct {
+	Table WideHuffmanEncTable // 范式Huffman码表，包含所有256个字节
+	Freq  Frequencies         // 训练集的频数，每个字节都额外加了1
+
+	TrainBytes         uint64  // 训练集的字节数
+	HoldoutBytes       uint64  // 留出集的字节数
+	TrainBitsPerByte   float64 // 码表在训练集上平均每个字节的比特数
+	HoldoutBitsPerByte float64 // 码表在留出集上平均每个字节的比特数，没有留出集时为0
+}
+
+// TrainTable 汇总样本文件中的字节频数，构建可以通过WithPresetTable使用的预置码表
+// 每个文件最后holdout比例的数据作为留出集，不参与训练，只用于评估码表在没有见过的数据上的效果。
+// 所有256个字节都至少有1的权重，保证码表可以编码任何数据
+func TrainTable(files []string, holdout float64) (*TrainResult, error) {
+	if holdout < 0 || holdout >= 1 {
+		return nil, ErrInvalidHoldout
+	}
+
+	var train, held [MaxSymbolNum]uint64
+	for _, filename := range files {
+		if err := countFileSample(filename, holdout, &train, &held); err != nil {
+			return nil, err
+		}
+	}
+
+	ret := &TrainResult{Freq: make(Frequencies, MaxSymbolNum)}
+	for b := range train {
+		ret.TrainBytes += train[b]
+		ret.HoldoutBytes += held[b]
+		ret.Freq[byte(b)] = train[b] + 1
+	}
+	if ret.TrainBytes == 0 {
+		return nil, ErrNoTrainingData
+	}
+	ret.Table = NewCanonicalHuffmanEncTable(NewHuffmanTree(ret.Freq))
+
+	lengths := ret.Table.CodeLengths()
+	ret.TrainBitsPerByte = float64(countsCost(&train, lengths)) / float64(ret.TrainBytes)
+	if ret.HoldoutBytes > 0 {
+		ret.HoldoutBitsPerByte = float64(countsCost(&held, lengths)) / float64(ret.HoldoutBytes)
+	}
+
+	return ret, nil
+}
+
+// countFileSample 统计一个样本文件的频数，文件开头的部分计入train，最后holdout比例的部分计入held
+func countFileSample(filename string, holdout float64, train, held *[MaxSymbolNum]uint64) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	trainSize := info.Size() - int64(float64(info.Size())*holdout)
+
+	if err := countReader(io.LimitReader(f, trainSize), train); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	if err := countReader(f, held); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// countReader 统计r中每个字节的频数
+func countReader(r io.Reader, counts *[MaxSymbolNum]uint64) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			counts[b]++
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
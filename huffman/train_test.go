@@ -0,0 +1,72 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrainTable(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	var all []byte
+	for i := 0; i < 5; i++ {
+		var data []byte
+		for j := i * 100; j < i*100+100; j++ {
+			data = append(data, jsonMessage(j)...)
+		}
+		all = append(all, data...)
+		filename := filepath.Join(dir, string(rune('a'+i))+".json")
+		require.Nil(t, os.WriteFile(filename, data, 0644))
+		files = append(files, filename)
+	}
+
+	result, err := TrainTable(files, 0.2)
+	require.Nil(t, err)
+	require.Len(t, result.Table, MaxSymbolNum)
+	require.EqualValues(t, len(all), result.TrainBytes+result.HoldoutBytes)
+	require.InDelta(t, float64(len(all))*0.2, float64(result.HoldoutBytes), 5)
+	require.Greater(t, result.TrainBitsPerByte, 0.0)
+	require.Less(t, result.TrainBitsPerByte, 8.0)
+	require.Less(t, result.HoldoutBitsPerByte, 8.0)
+	for b := 0; b < MaxSymbolNum; b++ {
+		require.NotZero(t, result.Freq[byte(b)])
+	}
+
+	// 训练得到的码表可以压缩任意数据
+	random := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(random)
+	registry := NewTableRegistry()
+	_, err = registry.RegisterTable(result.Table)
+	require.Nil(t, err)
+	for _, data := range [][]byte{jsonMessage(1000), random} {
+		stream := compressStream(t, data, WithPresetTable(result.Table))
+		r, err := NewReader(bytes.NewReader(stream), WithTableRegistry(registry))
+		require.Nil(t, err)
+		got, err := io.ReadAll(r)
+		require.Nil(t, err)
+		require.Equal(t, data, got)
+	}
+
+	result, err = TrainTable(files, 0)
+	require.Nil(t, err)
+	require.EqualValues(t, len(all), result.TrainBytes)
+	require.Zero(t, result.HoldoutBytes)
+	require.Zero(t, result.HoldoutBitsPerByte)
+}
+
+func TestTrainTable_Invalid(t *testing.T) {
+	_, err := TrainTable([]string{s1}, 1)
+	require.ErrorIs(t, err, ErrInvalidHoldout)
+	_, err = TrainTable([]string{s1}, -0.1)
+	require.ErrorIs(t, err, ErrInvalidHoldout)
+	_, err = TrainTable(nil, 0)
+	require.ErrorIs(t, err, ErrNoTrainingData)
+	_, err = TrainTable([]string{filepath.Join(t.TempDir(), "missing")}, 0)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,333 @@
+package huffman
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// 预变换：Huffman编码只利用了字节的频数，先对数据做可逆的变换（例如差分、move-to-front）往往可以让频数分布更集中。
+// 压缩时通过WithTransforms指定按顺序执行的变换链，CompressFile把变换链中每个变换的ID记录在文件头中，
+// DecompressFile根据ID找到变换并按照相反的顺序执行逆变换，自定义的变换需要先通过RegisterTransform注册。
+//
+// 变换以帧为单位进行，每个帧为最多transformFrameSize字节的原始数据，帧之间互不依赖。
+// 变换后的帧不能超过maxTransformedFrameSize字节，即变换最多把数据扩大到2倍。变换后的帧格式如下：（大端序）
+//   - FRAME SIZE					4 bytes (uint32) 变换后的字节数，不超过maxTransformedFrameSize
+//   - FRAME DATA					FRAME SIZE bytes
+
+const (
+	// transformFrameSize 是每个帧变换前的最大字节数
+	transformFrameSize = DefaultBlockSize
+	// maxTransformedFrameSize 是每个帧变换后的最大字节数，还原时FRAME SIZE来自不可信的输入，超过该值的帧视为损坏
+	maxTransformedFrameSize = 2 * transformFrameSize
+	// MaxTransformNum 是变换链中变换的最大数量
+	MaxTransformNum = 255
+)
+
+// 内置变换的ID，自定义变换的ID不能和它们相同
+const (
+	TransformIDDelta       byte = 1 // 差分
+	TransformIDMoveToFront byte = 2 // move-to-front
+)
+
+var (
+	ErrUnknownTransform   = fmt.Errorf("unknown transform")
+	ErrInvalidTransform   = fmt.Errorf("invalid transform")
+	ErrTooManyTransforms  = fmt.Errorf("at most %d transforms", MaxTransformNum)
+	ErrCorruptTransform   = fmt.Errorf("corrupt transform frame")
+	ErrTransformWriterEOF = fmt.Errorf("transform writer already closed")
+)
+
+// Transform 是压缩前对数据做的可逆变换
+// Forward和Inverse不能修改传入的切片，Inverse(Forward(data))应该得到和data相同的数据
+type Transform interface {
+	// ID 是变换在文件头中的标识，不能为0
+	ID() byte
+	// Forward 变换一个帧的数据
+	Forward(data []byte) ([]byte, error)
+	// Inverse 还原Forward变换后的数据
+	Inverse(data []byte) ([]byte, error)
+}
+
+var (
+	transformsMu sync.RWMutex
+	transforms   = map[byte]Transform{
+		TransformIDDelta:       DeltaTransform{},
+		TransformIDMoveToFront: MoveToFrontTransform{},
+	}
+)
+
+// RegisterTransform 注册一个自定义变换，DecompressFile根据文件头中的ID找到该变换
+// ID为0或者已经被注册时返回ErrInvalidTransform
+func RegisterTransform(t Transform) error {
+	transformsMu.Lock()
+	defer transformsMu.Unlock()
+
+	id := t.ID()
+	if _, ok := transforms[id]; ok || id == 0 {
+		return fmt.Errorf("%w: id %d", ErrInvalidTransform, id)
+	}
+	transforms[id] = t
+	return nil
+}
+
+// lookupTransforms 根据ID找到注册的变换
+func lookupTransforms(ids []byte) ([]Transform, error) {
+	transformsMu.RLock()
+	defer transformsMu.RUnlock()
+
+	chain := make([]Transform, 0, len(ids))
+	for _, id := range ids {
+		t, ok := transforms[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: id %d", ErrUnknownTransform, id)
+		}
+		chain = append(chain, t)
+	}
+	return chain, nil
+}
+
+// transformIDs 返回变换链中每个变换的ID
+func transformIDs(chain []Transform) []byte {
+	ids := make([]byte, 0, len(chain))
+	for _, t := range chain {
+		ids = append(ids, t.ID())
+	}
+	return ids
+}
+
+// forwardTransforms 依次执行变换链中的每个变换
+func forwardTransforms(chain []Transform, data []byte) ([]byte, error) {
+	var err error
+	for _, t := range chain {
+		if data, err = t.Forward(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inverseTransforms 按照相反的顺序执行变换链中每个变换的逆变换
+func inverseTransforms(chain []Transform, data []byte) ([]byte, error) {
+	var err error
+	for i := len(chain) - 1; i >= 0; i-- {
+		if data, err = chain[i].Inverse(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// TransformWriter 对写入的数据执行变换链，变换后的帧写入底层的io.Writer
+type TransformWriter struct {
+	w      io.Writer
+	chain  []Transform
+	buf    []byte
+	closed bool
+	err    error
+}
+
+// NewTransformWriter 创建一个TransformWriter，变换后的数据写入w中
+// 调用方需要在写入完成后调用Close写出最后一个帧，Close不会关闭w
+func NewTransformWriter(w io.Writer, chain ...Transform) *TransformWriter {
+	return &TransformWriter{w: w, chain: chain}
+}
+
+// Write 实现io.Writer接口，数据满一个帧的时候变换写出
+func (tw *TransformWriter) Write(p []byte) (int, error) {
+	if tw.closed {
+		return 0, ErrTransformWriterEOF
+	}
+	if tw.err != nil {
+		return 0, tw.err
+	}
+
+	n := 0
+	for len(p) > 0 {
+		m := transformFrameSize - len(tw.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		tw.buf = append(tw.buf, p[:m]...)
+		p = p[m:]
+		n += m
+		if len(tw.buf) == transformFrameSize {
+			if tw.err = tw.writeFrame(); tw.err != nil {
+				return n, tw.err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close 写出缓冲区中剩下的数据
+func (tw *TransformWriter) Close() error {
+	if tw.closed {
+		return tw.err
+	}
+	tw.closed = true
+	if tw.err == nil && len(tw.buf) > 0 {
+		tw.err = tw.writeFrame()
+	}
+	return tw.err
+}
+
+func (tw *TransformWriter) writeFrame() error {
+	frame, err := forwardTransforms(tw.chain, tw.buf)
+	if err != nil {
+		return err
+	}
+	tw.buf = tw.buf[:0]
+	if len(frame) > maxTransformedFrameSize {
+		return fmt.Errorf("%w: frame of %d bytes", ErrInvalidTransform, len(frame))
+	}
+
+	if _, err := tw.w.Write(writeUint32ToBytes(uint32(len(frame)), nil)); err != nil {
+		return err
+	}
+	_, err = tw.w.Write(frame)
+	return err
+}
+
+// InverseTransformWriter 解析写入的帧，执行逆变换后把原始数据写入底层的io.Writer
+// 以io.Writer的形式实现，可以直接作为Reader.WriteTo的目标
+type InverseTransformWriter struct {
+	w      io.Writer
+	chain  []Transform
+	buf    []byte
+	closed bool
+	err    error
+}
+
+// NewInverseTransformWriter 创建一个InverseTransformWriter，还原后的数据写入w中
+// 调用方需要在写入完成后调用Close检查数据是否完整，Close不会关闭w
+func NewInverseTransformWriter(w io.Writer, chain ...Transform) *InverseTransformWriter {
+	return &InverseTransformWriter{w: w, chain: chain}
+}
+
+// Write 实现io.Writer接口，每凑齐一个帧就执行逆变换并写出
+func (iw *InverseTransformWriter) Write(p []byte) (int, error) {
+	if iw.closed {
+		return 0, ErrTransformWriterEOF
+	}
+	if iw.err != nil {
+		return 0, iw.err
+	}
+
+	iw.buf = append(iw.buf, p...)
+	consumed := 0
+	for {
+		size, err := readNextUint32(iw.buf, consumed)
+		if err != nil {
+			break
+		}
+		if size > maxTransformedFrameSize {
+			iw.err = fmt.Errorf("%w: frame of %d bytes exceeds %d", ErrCorruptTransform, size, maxTransformedFrameSize)
+			return 0, iw.err
+		}
+		end := consumed + Uint32ByteSize + int(size)
+		if end > len(iw.buf) {
+			break
+		}
+		if iw.err = iw.writeFrame(iw.buf[consumed+Uint32ByteSize : end]); iw.err != nil {
+			return 0, iw.err
+		}
+		consumed = end
+	}
+	iw.buf = append(iw.buf[:0], iw.buf[consumed:]...)
+
+	return len(p), nil
+}
+
+// Close 检查最后一个帧是否完整
+func (iw *InverseTransformWriter) Close() error {
+	if iw.closed {
+		return iw.err
+	}
+	iw.closed = true
+	if iw.err == nil && len(iw.buf) > 0 {
+		iw.err = fmt.Errorf("%w: %d trailing bytes", ErrCorruptTransform, len(iw.buf))
+	}
+	return iw.err
+}
+
+func (iw *InverseTransformWriter) writeFrame(frame []byte) error {
+	data, err := inverseTransforms(iw.chain, frame)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptTransform, err)
+	}
+	_, err = iw.w.Write(data)
+	return err
+}
+
+// DeltaTransform 把每个字节替换为它和前一个字节的差（模256），第一个字节和0相减
+// 适合缓慢变化的数值数据，例如音频采样和传感器读数
+type DeltaTransform struct{}
+
+func (DeltaTransform) ID() byte {
+	return TransformIDDelta
+}
+
+func (DeltaTransform) Forward(data []byte) ([]byte, error) {
+	ret := make([]byte, len(data))
+	var prev byte = 0
+	for i, b := range data {
+		ret[i] = b - prev
+		prev = b
+	}
+	return ret, nil
+}
+
+func (DeltaTransform) Inverse(data []byte) ([]byte, error) {
+	ret := make([]byte, len(data))
+	var prev byte = 0
+	for i, d := range data {
+		prev += d
+		ret[i] = prev
+	}
+	return ret, nil
+}
+
+// MoveToFrontTransform 把每个字节替换为它在最近使用列表中的位置，然后把它移到列表的最前面
+// 最近重复出现的字节变换成较小的数，适合局部重复性强的数据
+type MoveToFrontTransform struct{}
+
+func (MoveToFrontTransform) ID() byte {
+	return TransformIDMoveToFront
+}
+
+func (MoveToFrontTransform) Forward(data []byte) ([]byte, error) {
+	order := newMoveToFrontOrder()
+	ret := make([]byte, len(data))
+	for i, b := range data {
+		j := 0
+		for order[j] != b {
+			j++
+		}
+		copy(order[1:j+1], order[:j])
+		order[0] = b
+		ret[i] = byte(j)
+	}
+	return ret, nil
+}
+
+func (MoveToFrontTransform) Inverse(data []byte) ([]byte, error) {
+	order := newMoveToFrontOrder()
+	ret := make([]byte, len(data))
+	for i, j := range data {
+		b := order[j]
+		copy(order[1:int(j)+1], order[:j])
+		order[0] = b
+		ret[i] = b
+	}
+	return ret, nil
+}
+
+// newMoveToFrontOrder 返回初始的最近使用列表，按照字节从小到大排列
+func newMoveToFrontOrder() *[MaxSymbolNum]byte {
+	order := new([MaxSymbolNum]byte)
+	for i := range order {
+		order[i] = byte(i)
+	}
+	return order
+}
@@ -0,0 +1,192 @@
+package huffman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// xorTransform 是测试用的自定义变换
+type xorTransform struct{}
+
+func (xorTransform) ID() byte { return 200 }
+
+func (xorTransform) Forward(data []byte) ([]byte, error) {
+	ret := make([]byte, len(data))
+	for i, b := range data {
+		ret[i] = b ^ 0x5A
+	}
+	return ret, nil
+}
+
+func (t xorTransform) Inverse(data []byte) ([]byte, error) {
+	return t.Forward(data)
+}
+
+// repeatTransform 是测试用的把每个字节重复3次的变换
+type repeatTransform struct{}
+
+func (repeatTransform) ID() byte { return 201 }
+
+func (repeatTransform) Forward(data []byte) ([]byte, error) {
+	ret := make([]byte, 0, 3*len(data))
+	for _, b := range data {
+		ret = append(ret, b, b, b)
+	}
+	return ret, nil
+}
+
+func (repeatTransform) Inverse(data []byte) ([]byte, error) {
+	ret := make([]byte, 0, len(data)/3)
+	for i := 0; i+2 < len(data); i += 3 {
+		ret = append(ret, data[i])
+	}
+	return ret, nil
+}
+
+func TestTransform_Builtin(t *testing.T) {
+	data := []byte{10, 12, 12, 9, 255, 0}
+	delta, err := DeltaTransform{}.Forward(data)
+	require.Nil(t, err)
+	require.Equal(t, []byte{10, 2, 0, 253, 246, 1}, delta)
+	got, err := DeltaTransform{}.Inverse(delta)
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+
+	data = []byte("bananaaa")
+	mtf, err := MoveToFrontTransform{}.Forward(data)
+	require.Nil(t, err)
+	require.Equal(t, []byte{'b', 'b', 'n', 1, 1, 1, 0, 0}, mtf)
+	got, err = MoveToFrontTransform{}.Inverse(mtf)
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+
+	data = mixedData(100000)
+	for _, tr := range []Transform{DeltaTransform{}, MoveToFrontTransform{}} {
+		forward, err := tr.Forward(data)
+		require.Nil(t, err)
+		got, err := tr.Inverse(forward)
+		require.Nil(t, err)
+		require.Equal(t, data, got)
+	}
+}
+
+func TestTransformWriter(t *testing.T) {
+	data := mixedData(3*transformFrameSize + 1234)
+	chain := []Transform{DeltaTransform{}, MoveToFrontTransform{}, xorTransform{}}
+
+	var transformed bytes.Buffer
+	tw := NewTransformWriter(&transformed, chain...)
+	for i := 0; i < len(data); i += 100003 {
+		end := i + 100003
+		if end > len(data) {
+			end = len(data)
+		}
+		_, err := tw.Write(data[i:end])
+		require.Nil(t, err)
+	}
+	require.Nil(t, tw.Close())
+	require.Equal(t, len(data)+4*Uint32ByteSize, transformed.Len())
+	_, err := tw.Write([]byte{1})
+	require.ErrorIs(t, err, ErrTransformWriterEOF)
+
+	// 每次写入任意长度的数据
+	var recovered bytes.Buffer
+	iw := NewInverseTransformWriter(&recovered, chain...)
+	stream := transformed.Bytes()
+	for i := 0; i < len(stream); i += 7777 {
+		end := i + 7777
+		if end > len(stream) {
+			end = len(stream)
+		}
+		_, err := iw.Write(stream[i:end])
+		require.Nil(t, err)
+	}
+	require.Nil(t, iw.Close())
+	require.Equal(t, data, recovered.Bytes())
+
+	// 最后一个帧不完整
+	iw = NewInverseTransformWriter(&recovered, chain...)
+	_, err = iw.Write(stream[:len(stream)-1])
+	require.Nil(t, err)
+	require.ErrorIs(t, iw.Close(), ErrCorruptTransform)
+}
+
+func TestTransformWriter_FrameSize(t *testing.T) {
+	// 变换后超过maxTransformedFrameSize的帧无法写出
+	var transformed bytes.Buffer
+	tw := NewTransformWriter(&transformed, repeatTransform{})
+	_, err := tw.Write(make([]byte, transformFrameSize))
+	require.ErrorIs(t, err, ErrInvalidTransform)
+	// 小的帧仍然可以变换和还原
+	tw = NewTransformWriter(&transformed, repeatTransform{})
+	_, err = tw.Write([]byte("abc"))
+	require.Nil(t, err)
+	require.Nil(t, tw.Close())
+	var recovered bytes.Buffer
+	iw := NewInverseTransformWriter(&recovered, repeatTransform{})
+	_, err = iw.Write(transformed.Bytes())
+	require.Nil(t, err)
+	require.Nil(t, iw.Close())
+	require.Equal(t, []byte("abc"), recovered.Bytes())
+
+	// 最大的帧只有帧头时等待后面的数据
+	iw = NewInverseTransformWriter(&recovered)
+	_, err = iw.Write(writeUint32ToBytes(maxTransformedFrameSize, nil))
+	require.Nil(t, err)
+	require.ErrorIs(t, iw.Close(), ErrCorruptTransform)
+
+	// 损坏的FRAME SIZE不会导致缓存大量的数据
+	iw = NewInverseTransformWriter(&recovered)
+	_, err = iw.Write(writeUint32ToBytes(maxTransformedFrameSize+1, nil))
+	require.ErrorIs(t, err, ErrCorruptTransform)
+	_, err = iw.Write([]byte{1, 2, 3})
+	require.ErrorIs(t, err, ErrCorruptTransform)
+	require.ErrorIs(t, iw.Close(), ErrCorruptTransform)
+	iw = NewInverseTransformWriter(&recovered)
+	_, err = iw.Write([]byte{0xff, 0xff, 0xff, 0xff, 0})
+	require.ErrorIs(t, err, ErrCorruptTransform)
+}
+
+func TestCompressFile_Transforms(t *testing.T) {
+	data, err := os.ReadFile(s1)
+	require.Nil(t, err)
+	dir := t.TempDir()
+	compressedname := filepath.Join(dir, "transform.huf")
+	recovername := filepath.Join(dir, "recover.txt")
+
+	// 没有注册的变换可以压缩，但是解压时找不到
+	require.Nil(t, CompressFile(s1, compressedname, WithTransforms(MoveToFrontTransform{}, xorTransform{})))
+	compressed, err := os.ReadFile(compressedname)
+	require.Nil(t, err)
+	require.Equal(t, FileVersion3, compressed[Uint16ByteSize])
+	headerSize := Uint16ByteSize + 1 + Uint16ByteSize + 2*Uint64ByteSize + len("test_data.txt")
+	require.Equal(t, []byte{2, TransformIDMoveToFront, 200}, compressed[headerSize:headerSize+3])
+	require.ErrorIs(t, DecompressFile(compressedname, recovername), ErrUnknownTransform)
+
+	require.Nil(t, RegisterTransform(xorTransform{}))
+	require.ErrorIs(t, RegisterTransform(xorTransform{}), ErrInvalidTransform)
+	require.ErrorIs(t, RegisterTransform(DeltaTransform{}), ErrInvalidTransform)
+	require.Nil(t, DecompressFile(compressedname, recovername, WithReaderConcurrency(4)))
+	got, err := os.ReadFile(recovername)
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+
+	// 和其它选项一起使用
+	require.Nil(t, CompressFile(s1, compressedname, WithTransforms(DeltaTransform{}), WithBlockSize(1024), WithContextModeling()))
+	require.Nil(t, DecompressFile(compressedname, recovername))
+	got, err = os.ReadFile(recovername)
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+
+	// 不使用变换时仍然是FileVersion2
+	require.Nil(t, CompressFile(s1, compressedname, WithTransforms()))
+	compressed, err = os.ReadFile(compressedname)
+	require.Nil(t, err)
+	require.Equal(t, FileVersion2, compressed[Uint16ByteSize])
+
+	require.ErrorIs(t, CompressFile(s1, compressedname, WithTransforms(nil)), ErrInvalidTransform)
+}
@@ -1,13 +1,25 @@
 package huffman
 
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+)
+
 // HuffmanNode 表示一个Huffman树的节点
+// HuffmanTree中的节点由Tree[byte]的节点转换得到，AdaptiveHuffmanTree直接使用HuffmanNode
 type HuffmanNode struct {
 	Weight uint64
 	Parent *HuffmanNode
 	Left   *HuffmanNode
 	Right  *HuffmanNode
 	Byte   byte
-	Code   *HuffmanCode
+	// Code 为节点的Huffman编码，编码长度超过MaxHuffmanCodeBitLen时为nil
+	Code *HuffmanCode
+	// WideCode 为节点的Huffman编码，最长MaxWideHuffmanCodeBitLen比特
+	WideCode *WideHuffmanCode
+	// 节点在自适应Huffman树中的编号
+	order int
 }
 
 // IsLeaf 判断当前节点是否为叶子节点
@@ -31,26 +43,28 @@ func (nd *HuffmanNode) IsRight() bool {
 	return false
 }
 
-// setCode 设置这个节点的Huffman编码
-// 设置思路：从叶子节点不断往上，追加比特位，最后将所有比特位逆序
-func (nd *HuffmanNode) setCode() {
-	cur := nd
-	huffmanBits := &HuffmanCode{}
-	for cur != nil {
-		if cur.IsLeft() {
-			huffmanBits.AppendZero()
-		} else if cur.IsRight() {
-			huffmanBits.AppendOne()
-		}
-		cur = cur.Parent
+// setWideCode 设置节点的编码，编码不超过MaxHuffmanCodeBitLen时同时设置Code
+func (nd *HuffmanNode) setWideCode(code *WideHuffmanCode) {
+	nd.WideCode = code
+	nd.Code = nil
+	if code.BitLen() <= MaxHuffmanCodeBitLen {
+		nd.Code = newHuffmanCode(uint32(code.Value()), code.BitLen())
 	}
-	nd.Code = huffmanBits.ReverseNew()
 }
 
 // WeightLength 计算带权路径长度
-// 这个方法仅在nd.Code被设置了后才能得到有效值
+// 这个方法仅在nd.WideCode被设置了后才能得到有效值
 func (nd *HuffmanNode) WeightLength() int {
-	return int(nd.Weight) * nd.Code.BitLen()
+	return int(nd.Weight) * nd.WideCode.BitLen()
+}
+
+// depth 返回节点到根节点的距离
+func (nd *HuffmanNode) depth() int {
+	d := 0
+	for cur := nd; cur.Parent != nil; cur = cur.Parent {
+		d++
+	}
+	return d
 }
 
 // HuffmanTree 表示了一棵Huffman树
@@ -61,8 +75,9 @@ type HuffmanTree struct {
 }
 
 // NewHuffmanTree 根据指定频率构建一棵新的Huffman树
-func NewHuffmanTree(freq Frequencies) *HuffmanTree {
-	root, leaves := ConstructHuffmanTree(freq)
+// maxBitLen为可选参数，指定编码的最大比特长度，默认为MaxHuffmanCodeBitLen，最大为MaxWideHuffmanCodeBitLen
+func NewHuffmanTree(freq Frequencies, maxBitLen ...int) *HuffmanTree {
+	root, leaves := ConstructHuffmanTree(freq, maxBitLen...)
 	tree := &HuffmanTree{
 		Freq:   freq,
 		Root:   root,
@@ -73,45 +88,79 @@ func NewHuffmanTree(freq Frequencies) *HuffmanTree {
 }
 
 // ConstructHuffmanTree 根据频率创建一棵Huffman树
-// 返回Huffman树的根节点和所有叶子节点
-func ConstructHuffmanTree(freq Frequencies) (*HuffmanNode, []*HuffmanNode) {
-	// 单独处理只有一个数据的情况
-	if len(freq) == 1 {
-		var k byte
-		var v uint64
-		for k, v = range freq {
+// 返回Huffman树的根节点和按字节顺序排列的所有叶子节点
+//
+// 树由NewTree[byte]构建（包括长度受限时的处理，见NewTree），这里只把它的节点转换成HuffmanNode
+func ConstructHuffmanTree(freq Frequencies, maxBitLen ...int) (*HuffmanNode, []*HuffmanNode) {
+	tree := NewTree(freq, Less[byte], maxBitLen...)
+
+	leaves := make([]*HuffmanNode, len(tree.Leaves))
+	var convert func(nd *Node[byte], parent *HuffmanNode) *HuffmanNode
+	convert = func(nd *Node[byte], parent *HuffmanNode) *HuffmanNode {
+		if nd == nil {
+			return nil
 		}
-		root := &HuffmanNode{}
-		left := &HuffmanNode{Parent: root, Weight: v, Byte: k}
+		hn := &HuffmanNode{Weight: nd.Weight, Parent: parent}
+		if nd.IsLeaf() {
+			hn.Byte = nd.Symbol
+			hn.setWideCode(nd.Code)
+			leaves[nd.index] = hn
+			return hn
+		}
+		hn.Left = convert(nd.Left, hn)
+		hn.Right = convert(nd.Right, hn)
+		return hn
+	}
+
+	return convert(tree.Root, nil), leaves
+}
+
+// byteCodeLengths 返回根据频率构建的Huffman树中每个字节的编码长度，格式和HuffmanTree.CodeLengths相同
+// 只需要编码长度时不必把节点转换成HuffmanNode
+func byteCodeLengths(freq Frequencies, maxBitLen ...int) []uint8 {
+	tree := NewTree(freq, Less[byte], maxBitLen...)
+	lengths := make([]uint8, MaxSymbolNum)
+	for _, leaf := range tree.Leaves {
+		lengths[leaf.Symbol] = uint8(leaf.Code.BitLen())
+	}
+
+	return lengths
+}
+
+// buildTree 根据叶子节点构建Huffman树并给叶子节点编码，返回根节点
+// leaves需要按照符号顺序排列，权重相同的节点按照在leaves中的下标合并，并且编码长度不超过limit
+func buildTree[S comparable](leaves []*Node[S], limit int) *Node[S] {
+	// 单独处理只有一个数据的情况
+	if len(leaves) == 1 {
+		root := &Node[S]{}
+		left := leaves[0]
+		left.Parent = root
 		root.Left = left
 
-		left.Code = NewHuffmanCodeFromString("0")
-		return root, []*HuffmanNode{left}
+		left.Code = newCode(0, 1)
+		return root
 	}
 
 	// 1. 构建优先级队列
-	pq := NewHuffmanPQ()
+	pq := &nodeHeap[S]{}
 
 	// 插入所有叶子节点
-	var leaves []*HuffmanNode = make([]*HuffmanNode, 0, len(freq))
-	for k, v := range freq {
-		node := &HuffmanNode{Weight: v, Byte: k}
-		leaves = append(leaves, node)
-		pq.Push(node)
+	for _, node := range leaves {
+		heap.Push(pq, node)
 	}
 
-	pq.UpdateOrder()
+	heap.Init(pq)
 
 	// 2. 开始构建Huffman树
-	for pq.Size() > 1 {
+	for pq.Len() > 1 {
 		// pop出weight最小的两个节点
-		nodeA := pq.Pop()
-		nodeB := pq.Pop()
-		if (nodeA.Weight == nodeB.Weight) && (nodeA.Byte > nodeB.Byte) {
+		nodeA := heap.Pop(pq).(*Node[S])
+		nodeB := heap.Pop(pq).(*Node[S])
+		if (nodeA.Weight == nodeB.Weight) && (nodeA.index > nodeB.index) {
 			nodeA, nodeB = nodeB, nodeA
 		}
 		// 新增一个根节点合并这个节点
-		nodeRoot := &HuffmanNode{
+		nodeRoot := &Node[S]{
 			Left:   nodeA,
 			Right:  nodeB,
 			Weight: nodeA.Weight + nodeB.Weight,
@@ -119,14 +168,121 @@ func ConstructHuffmanTree(freq Frequencies) (*HuffmanNode, []*HuffmanNode) {
 		nodeA.Parent = nodeRoot
 		nodeB.Parent = nodeRoot
 		// 将新增的节点重新插回优先级队列中
-		pq.Push(nodeRoot)
+		heap.Push(pq, nodeRoot)
+	}
+
+	root := (*pq)[0]
+
+	// 3. 树的高度超过限制时，按照长度受限的编码长度重建Huffman树
+	if treeDepth(leaves) > limit {
+		weights := make([]uint64, len(leaves))
+		for i, leaf := range leaves {
+			weights[i] = leaf.Weight
+		}
+		root = constructTreeFromLengths(leaves, limitedCodeLengths(weights, limit))
 	}
 
 	// 给叶子节点编码
 	for _, leaf := range leaves {
-		// fmt.Println(i)
 		leaf.setCode()
 	}
 
-	return pq.Peek(), leaves
+	return root
+}
+
+// resolveMaxBitLen 确定编码的最大比特长度
+// 最大比特长度不能超过MaxWideHuffmanCodeBitLen，也要能容纳所有的n个叶子节点
+func resolveMaxBitLen(n int, maxBitLen []int) int {
+	limit := MaxHuffmanCodeBitLen
+	if len(maxBitLen) > 0 {
+		limit = maxBitLen[0]
+	}
+	if limit <= 0 || limit > MaxWideHuffmanCodeBitLen {
+		panic(fmt.Sprintf("max bit length must be in range [1, %d], but found %d", MaxWideHuffmanCodeBitLen, limit))
+	}
+	if limit < 32 && n > 1<<limit {
+		panic(fmt.Sprintf("max bit length %d is too small for %d symbols", limit, n))
+	}
+
+	return limit
+}
+
+// treeDepth 返回叶子节点中的最大深度
+func treeDepth[S comparable](leaves []*Node[S]) int {
+	maxDepth := 0
+	for _, leaf := range leaves {
+		if d := leaf.depth(); d > maxDepth {
+			maxDepth = d
+		}
+	}
+	return maxDepth
+}
+
+// constructTreeFromLengths 根据每个叶子节点的编码长度重建Huffman树，返回新的根节点
+// 同一长度内按叶子节点的下标从小到大依次分配连续的编码（即范式Huffman编码的分配方式）
+func constructTreeFromLengths[S comparable](leaves []*Node[S], lengths []int) *Node[S] {
+	order := make([]int, len(leaves))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if lengths[a] != lengths[b] {
+			return lengths[a] < lengths[b]
+		}
+		return a < b
+	})
+
+	root := &Node[S]{}
+	var code uint64 = 0
+	prevLen := 0
+	for i, idx := range order {
+		length := lengths[idx]
+		if i > 0 {
+			code++
+		}
+		code <<= length - prevLen
+		prevLen = length
+
+		// 从根节点开始按照编码的比特位往下走，缺少的中间节点直接创建
+		cur := root
+		for bit := length - 1; bit > 0; bit-- {
+			if (code>>bit)&1 == 0 {
+				if cur.Left == nil {
+					cur.Left = &Node[S]{Parent: cur}
+				}
+				cur = cur.Left
+			} else {
+				if cur.Right == nil {
+					cur.Right = &Node[S]{Parent: cur}
+				}
+				cur = cur.Right
+			}
+		}
+
+		leaf := leaves[idx]
+		leaf.Parent = cur
+		leaf.Left, leaf.Right = nil, nil
+		if code&1 == 0 {
+			cur.Left = leaf
+		} else {
+			cur.Right = leaf
+		}
+	}
+
+	updateWeight(root)
+
+	return root
+}
+
+// updateWeight 重新计算非叶子节点的权重
+func updateWeight[S comparable](nd *Node[S]) uint64 {
+	if nd == nil {
+		return 0
+	}
+	if nd.IsLeaf() {
+		return nd.Weight
+	}
+	nd.Weight = updateWeight(nd.Left) + updateWeight(nd.Right)
+	return nd.Weight
 }
@@ -2,8 +2,10 @@ package huffman
 
 import (
 	// "fmt"
+	"strings"
 	"testing"
-	// "github.com/stretchr/testify/require"
+
+	"github.com/stretchr/testify/require"
 )
 
 // 测试创建Huffman树
@@ -79,3 +81,63 @@ func TestConstructHuffmanTreeFreq_AllFreqEqual(t *testing.T) {
 	// }
 	// fmt.Println()
 }
+
+// fibonacciFrequencies 生成n个字节的斐波那契频数，普通Huffman树的高度为n-1
+func fibonacciFrequencies(n int) Frequencies {
+	freq := make(Frequencies, n)
+	var a, b uint64 = 1, 1
+	for i := 0; i < n; i++ {
+		freq[byte(i)] = a
+		a, b = b, a+b
+	}
+	return freq
+}
+
+// requirePrefixFree 检查叶子节点的编码互相不为前缀
+func requirePrefixFree(t *testing.T, leaves []*HuffmanNode) {
+	for i, a := range leaves {
+		for j, b := range leaves {
+			if i == j {
+				continue
+			}
+			require.False(t, strings.HasPrefix(b.Code.String(), a.Code.String()))
+		}
+	}
+}
+
+func TestConstructHuffmanTree_LengthLimited(t *testing.T) {
+	testCases := []struct {
+		Freq      Frequencies
+		MaxBitLen []int
+		Limit     int
+	}{
+		{Freq: fibonacciFrequencies(40), Limit: MaxHuffmanCodeBitLen},
+		{Freq: fibonacciFrequencies(40), MaxBitLen: []int{12}, Limit: 12},
+		{Freq: fibonacciFrequencies(64), MaxBitLen: []int{6}, Limit: 6},
+		{Freq: fibonacciFrequencies(90), MaxBitLen: []int{16}, Limit: 16},
+		{Freq: Frequencies{'a': 1, 'b': 1, 'c': 2, 'd': 4}, MaxBitLen: []int{2}, Limit: 2},
+	}
+
+	for _, tc := range testCases {
+		root, leaves := ConstructHuffmanTree(tc.Freq, tc.MaxBitLen...)
+		require.Equal(t, len(tc.Freq), len(leaves))
+		for _, leaf := range leaves {
+			require.LessOrEqual(t, leaf.Code.BitLen(), tc.Limit)
+			require.Equal(t, leaf.depth(), leaf.Code.BitLen())
+			require.Equal(t, tc.Freq[leaf.Byte], leaf.Weight)
+		}
+		requirePrefixFree(t, leaves)
+
+		var total uint64 = 0
+		for _, w := range tc.Freq {
+			total += w
+		}
+		require.Equal(t, total, root.Weight)
+	}
+}
+
+func TestConstructHuffmanTree_InvalidMaxBitLen(t *testing.T) {
+	require.Panics(t, func() { ConstructHuffmanTree(fibonacciFrequencies(40), 0) })
+	require.Panics(t, func() { ConstructHuffmanTree(fibonacciFrequencies(40), MaxWideHuffmanCodeBitLen+1) })
+	require.Panics(t, func() { ConstructHuffmanTree(fibonacciFrequencies(40), 5) })
+}
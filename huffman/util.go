@@ -16,9 +16,17 @@ const (
 
 // CountFrequencies 统计输入字节切片中每个字节的出现频数
 func CountFrequencies(data []byte) Frequencies {
-	frequency := make(Frequencies)
+	// 先在数组中计数，避免每个字节都查一次map
+	var counts [MaxSymbolNum]uint64
 	for _, d := range data {
-		frequency[d] += 1
+		counts[d]++
+	}
+
+	frequency := make(Frequencies)
+	for b, cnt := range counts {
+		if cnt != 0 {
+			frequency[byte(b)] = cnt
+		}
 	}
 
 	return frequency
@@ -90,7 +98,7 @@ func readNextUint32(buf []byte, start int) (uint32, error) {
 	if n < Uint32ByteSize {
 		return 0, ErrInvalidSize
 	}
-	if start+Uint32ByteSize-1 > n {
+	if start+Uint32ByteSize > n {
 		return 0, ErrCursorOverflow
 	}
 
@@ -115,7 +123,7 @@ func readNextUint16(buf []byte, start int) (uint16, error) {
 	if n < Uint16ByteSize {
 		return 0, ErrInvalidSize
 	}
-	if start+Uint16ByteSize-1 > n {
+	if start+Uint16ByteSize > n {
 		return 0, ErrCursorOverflow
 	}
 
@@ -136,7 +144,7 @@ func readNextUint64(buf []byte, start int) (uint64, error) {
 	if n < Uint64ByteSize {
 		return 0, ErrInvalidSize
 	}
-	if start+Uint64ByteSize-1 > n {
+	if start+Uint64ByteSize > n {
 		return 0, ErrCursorOverflow
 	}
 
@@ -21,3 +21,16 @@ func TestCountFrequencies(t *testing.T) {
 		require.EqualValues(t, tc.Expect, have)
 	}
 }
+
+func TestReadNextUint_Overflow(t *testing.T) {
+	buf := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	v, err := readNextUint64(buf, 1)
+	require.Nil(t, err)
+	require.EqualValues(t, 0x0203040506070809, v)
+	_, err = readNextUint64(buf, 2)
+	require.ErrorIs(t, err, ErrCursorOverflow)
+	_, err = readNextUint32(buf, 6)
+	require.ErrorIs(t, err, ErrCursorOverflow)
+	_, err = readNextUint16(buf, 8)
+	require.ErrorIs(t, err, ErrCursorOverflow)
+}
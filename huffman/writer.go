@@ -1,12 +1,14 @@
 package huffman
 
 import (
+	"encoding/binary"
 	"errors"
 )
 
 const (
 	MaxUint16Len = 16
 	MaxUint32Len = 32
+	MaxUint64Len = 64
 )
 
 var (
@@ -14,76 +16,123 @@ var (
 )
 
 // BitsWriter 定义了比特的写入方式
+// 写入的比特先放进一个64位的累加器中，累加器满64位后整体写入缓冲区
+//
+// 默认每个字节从最高位开始填充，每次写入的值也从最高位开始写；
+// 通过WithLSBFirst可以改成DEFLATE等格式使用的方式：每个字节从最低位开始填充，每次写入的值也从最低位开始写
 type BitsWriter struct {
-	// 存放比特流的缓冲区
+	// 存放比特流的缓冲区，只包含已经写满的字节
 	buf []byte
-	// 当前字节索引
-	idx uint64
-	// 当前比特索引
-	slot uint64
+	// 累加器，未写入缓冲区的比特位右对齐存放；lsb为true时先写入的比特位在低位
+	acc uint64
+	// 累加器中的比特数
+	nacc uint
+	lsb  bool
 }
 
-func NewBitsWriter() *BitsWriter {
-	return &BitsWriter{
-		buf:  make([]byte, 1),
-		idx:  0,
-		slot: 0,
+// BitsWriterOption 用于配置BitsWriter
+type BitsWriterOption func(w *BitsWriter)
+
+// WithLSBFirst 每个字节从最低位开始填充，WriteBits写入的值也从最低位开始写
+func WithLSBFirst() BitsWriterOption {
+	return func(w *BitsWriter) {
+		w.lsb = true
 	}
 }
 
-func (w *BitsWriter) updateCursor() {
-	w.slot = (w.slot + 1) % 8
-	if w.slot == 0 {
-		w.idx++
-		w.buf = append(w.buf, 0)
+func NewBitsWriter(opts ...BitsWriterOption) *BitsWriter {
+	w := &BitsWriter{
+		buf: make([]byte, 0, 64),
+	}
+	for _, opt := range opts {
+		opt(w)
 	}
+	return w
 }
 
-func (w *BitsWriter) appendOne() {
-	mask := uint8(1 << (7 - w.slot))
-	w.buf[w.idx] |= mask
-	w.updateCursor()
+// Grow 预留至少n个比特的缓冲区空间
+func (w *BitsWriter) Grow(n uint64) {
+	need := int((n+7)/8) + Uint64ByteSize
+	if cap(w.buf)-len(w.buf) < need {
+		buf := make([]byte, len(w.buf), len(w.buf)+need)
+		copy(buf, w.buf)
+		w.buf = buf
+	}
 }
 
-func (w *BitsWriter) appendZero() {
-	w.updateCursor()
+// WriteBits 将v的低n位比特写入，从高位开始写（WithLSBFirst时从低位开始写），最多写入64位
+func (w *BitsWriter) WriteBits(v uint64, n uint) error {
+	if n > MaxUint64Len {
+		return ErrMaxLenExceeded
+	}
+	if n < MaxUint64Len {
+		v &= 1<<n - 1
+	}
+	w.writeBits(v, n)
+
+	return nil
 }
 
-// WriteUint16 将n位比特写入，从高位开始写，最多写入16位
-func (w *BitsWriter) WriteUint16(a uint16, n uint8) error {
-	if n > MaxUint16Len {
-		return ErrMaxLenExceeded
+// writeBits 将v的低n位比特写入，调用方保证n不超过64并且v没有超过n位
+func (w *BitsWriter) writeBits(v uint64, n uint) {
+	if w.lsb {
+		w.writeBitsLSB(v, n)
+		return
 	}
+	// 累加器放得下时直接写入累加器
+	if n < MaxUint64Len-w.nacc {
+		w.acc = w.acc<<n | v
+		w.nacc += n
+		return
+	}
+	w.flushBits(v, n)
+}
 
-	// 特殊情况处理
-	if w.slot == 0 && (n == 8 || n == 16) {
-		high := byte((a & 0xFF00) >> 8)
-		if n == 8 {
-			w.buf = append(w.buf, 0, 0)
-			w.buf[w.idx] = high
-			w.idx += 1
-		} else if n == 16 {
-			low := byte(a & 0x00FF)
-			w.buf = append(w.buf, 0, 0, 0)
-			w.buf[w.idx] = high
-			w.idx += 1
-			w.buf[w.idx] = low
-			w.idx += 1
-		}
-		return nil
+// flushBits 先用v的高位填满累加器，整体写入缓冲区，剩下的低位留在累加器中
+// 累加器中只有低nacc位是有效的，更高的比特位会在之后移出累加器
+//
+//go:noinline
+func (w *BitsWriter) flushBits(v uint64, n uint) {
+	free := MaxUint64Len - w.nacc
+	rest := n - free
+	w.acc = w.acc<<free | v>>rest
+	w.buf = binary.BigEndian.AppendUint64(w.buf, w.acc)
+	w.acc = v
+	w.nacc = rest
+}
+
+// writeBitsLSB 将v的低n位比特从低位开始写入，先写入的比特位放在累加器的低位
+func (w *BitsWriter) writeBitsLSB(v uint64, n uint) {
+	if n < MaxUint64Len-w.nacc {
+		w.acc |= v << w.nacc
+		w.nacc += n
+		return
 	}
+	// 用v的低位填满累加器，剩下的高位留在累加器中
+	free := MaxUint64Len - w.nacc
+	w.acc |= v << w.nacc
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, w.acc)
+	w.acc = 0
+	if free < MaxUint64Len {
+		w.acc = v >> free
+	}
+	w.nacc = n - free
+}
 
-	// slot != 0 or n % 8 != 0
-	var mask uint16 = 0x8000
-	for i := 0; i < int(n); i++ {
-		if (a<<i)&mask == 0 {
-			w.appendZero()
-		} else {
-			w.appendOne()
-		}
+// AlignByte 写入0直到字节边界
+func (w *BitsWriter) AlignByte() {
+	if pad := (8 - w.nacc%8) % 8; pad > 0 {
+		w.writeBits(0, pad)
+	}
+}
+
+// WriteUint16 将n位比特写入，从高位开始写，最多写入16位
+func (w *BitsWriter) WriteUint16(a uint16, n uint8) error {
+	if n > MaxUint16Len {
+		return ErrMaxLenExceeded
 	}
 
-	return nil
+	return w.WriteBits(uint64(a)>>(MaxUint16Len-n), uint(n))
 }
 
 // WriteUint32 将n位比特写入，从高位开始写，最多写入32位
@@ -92,71 +141,50 @@ func (w *BitsWriter) WriteUint32(a uint32, n uint8) error {
 		return ErrMaxLenExceeded
 	}
 
-	// 特殊情况处理，可能有刚好是1、2、3、4个字节
-	if w.slot == 0 && (n == 8 || n == 16 || n == 24 || n == 32) {
-		high := byte((a & 0xFF000000) >> 24) // 32位的高八位
-		if n == 8 {
-			w.buf = append(w.buf, 0, 0)
-			w.buf[w.idx] = high
-			w.idx += 1
-		} else if n == 16 {
-			middleLeft := byte((a & 0x00FF0000) >> 16)
-			w.buf = append(w.buf, 0, 0, 0)
-			w.buf[w.idx] = high
-			w.idx += 1
-			w.buf[w.idx] = middleLeft
-			w.idx += 1
-		} else if n == 24 {
-			middleLeft := byte((a & 0x00FF0000) >> 16)
-			middleRight := byte((a & 0x0000FF00) >> 8)
-			w.buf = append(w.buf, 0, 0, 0, 0)
-			w.buf[w.idx] = high
-			w.idx += 1
-			w.buf[w.idx] = middleLeft
-			w.idx += 1
-			w.buf[w.idx] = middleRight
-			w.idx += 1
-		} else { // n == 32
-			middleLeft := byte((a & 0x00FF0000) >> 16)
-			middleRight := byte((a & 0x0000FF00) >> 8)
-			low := byte(a & 0x000000FF)
-			w.buf = append(w.buf, 0, 0, 0, 0, 0)
-			w.buf[w.idx] = high
-			w.idx += 1
-			w.buf[w.idx] = middleLeft
-			w.idx += 1
-			w.buf[w.idx] = middleRight
-			w.idx += 1
-			w.buf[w.idx] = low
-			w.idx += 1
-		}
+	return w.WriteBits(uint64(a)>>(MaxUint32Len-n), uint(n))
+}
+
+// WriteUint64 将n位比特写入，从高位开始写，最多写入64位
+func (w *BitsWriter) WriteUint64(a uint64, n uint8) error {
+	if n > MaxUint64Len {
+		return ErrMaxLenExceeded
+	}
+	if n == 0 {
 		return nil
 	}
 
-	// 一般情况，写入n个比特
-	var mask uint32 = 0x80000000
-	for i := 0; i < int(n); i++ {
-		if (a<<i)&mask == 0 {
-			w.appendZero()
-		} else {
-			w.appendOne()
-		}
-	}
+	return w.WriteBits(a>>(MaxUint64Len-n), uint(n))
+}
 
-	return nil
+// BitLen 返回已经写入的比特数
+func (w *BitsWriter) BitLen() uint64 {
+	return uint64(len(w.buf))*8 + uint64(w.nacc)
 }
 
 // Buf 返回底层比特位缓冲区的拷贝
 func (w *BitsWriter) Buf() []byte {
-	// 这里仅需要拷贝有效的数据，而不是整个w.buf缓冲区，否则的话数据中会包含大量的无效0
-	var validByteLen int
-	if w.slot == 0 {
-		validByteLen = int(w.idx)
-	} else {
-		validByteLen = int(w.idx) + 1
-	}
-	cp := make([]byte, validByteLen)
+	// 这里仅需要拷贝有效的数据，累加器中不足一个字节的比特位在低位补0
+	accBytes := int((w.nacc + 7) / 8)
+	cp := make([]byte, len(w.buf), len(w.buf)+accBytes)
 	copy(cp, w.buf)
 
+	if w.nacc > 0 {
+		var tail [Uint64ByteSize]byte
+		if w.lsb {
+			binary.LittleEndian.PutUint64(tail[:], w.acc)
+		} else {
+			binary.BigEndian.PutUint64(tail[:], w.acc<<(MaxUint64Len-w.nacc))
+		}
+		cp = append(cp, tail[:accBytes]...)
+	}
+
 	return cp
 }
+
+// takeFull 取出缓冲区中已经写满的字节，累加器中的比特位保留，之后继续写入
+// 用于边写入边输出比特流，返回的切片在下一次写入之前有效
+func (w *BitsWriter) takeFull() []byte {
+	full := w.buf
+	w.buf = w.buf[:0]
+	return full
+}
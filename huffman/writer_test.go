@@ -2,6 +2,7 @@ package huffman
 
 import (
 	"fmt"
+	"os"
 	"strings"
 	"testing"
 
@@ -74,3 +75,99 @@ func TestBitsWriter_Uint32_WithError(t *testing.T) {
 	w := NewBitsWriter()
 	require.NotNil(t, w.WriteUint32(0x9600, 40))
 }
+
+func TestBitsWriter_Uint64(t *testing.T) {
+	tests := []struct {
+		Codes []string
+	}{
+		{Codes: []string{"1010101010100101010101010101010101010", "0", "111"}},
+		{Codes: []string{"101", "1111111111111111111111111111111111111111111111111111111111111111", "01"}},
+		{Codes: []string{"0000000011111111000000001111111100000000", "10101010101010101010101010101010"}},
+	}
+
+	for _, tc := range tests {
+		w := NewBitsWriter()
+		expect := strings.Builder{}
+		var total int = 0
+		for _, s := range tc.Codes {
+			expect.WriteString(s)
+			huff := NewWideHuffmanCodeFromString(s)
+			bitlen := uint8(huff.BitLen())
+			total += int(bitlen)
+			require.Nil(t, w.WriteUint64(huff.Bits(), bitlen))
+		}
+		b := w.Buf()
+
+		require.EqualValues(t, expect.String(), BytesToString(b, total))
+	}
+
+	require.NotNil(t, NewBitsWriter().WriteUint64(0x9600, 65))
+}
+
+func TestBitsWriter_WriteBits(t *testing.T) {
+	tests := []struct {
+		Codes []string
+	}{
+		{Codes: []string{"1", "0", "1", "1"}},
+		{Codes: []string{"1010101010100101010101010101010101010", "0", "111", "0000000000000000000000000001"}},
+		{Codes: []string{"1111111111111111111111111111111111111111111111111111111111111111", "1"}},
+		{Codes: []string{"0", "1111111111111111111111111111111111111111111111111111111111111111", "0", "10"}},
+		{Codes: []string{"1100110011001100110011001100110011001100110011001100110011001", "101", "01010101010101010101"}},
+	}
+
+	for _, tc := range tests {
+		w := NewBitsWriter()
+		expect := strings.Builder{}
+		var total uint64 = 0
+		for _, s := range tc.Codes {
+			expect.WriteString(s)
+			huff := NewWideHuffmanCodeFromString(s)
+			total += uint64(huff.BitLen())
+			// 高于n位的比特位会被忽略
+			require.Nil(t, w.WriteBits(huff.Value()|^uint64(0)<<uint(huff.BitLen()%64), uint(huff.BitLen())))
+			require.Equal(t, total, w.BitLen())
+		}
+		b := w.Buf()
+
+		require.Equal(t, int((total+7)/8), len(b))
+		require.EqualValues(t, expect.String(), BytesToString(b, int(total)))
+	}
+
+	require.NotNil(t, NewBitsWriter().WriteBits(0x9600, 65))
+}
+
+func BenchmarkCompressBytesWith(b *testing.B) {
+	data, err := os.ReadFile("test/test_data2.txt")
+	require.Nil(b, err)
+	table := NewCanonicalHuffmanEncTable(NewHuffmanTree(CountFrequencies(data)))
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := compressBytesWith(data, table); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBitsWriter_LSBFirst(t *testing.T) {
+	w := NewBitsWriter(WithLSBFirst())
+	w.WriteBits(1, 1)
+	w.WriteBits(2, 2)
+	w.AlignByte()
+	w.WriteBits(0xABCD, 16)
+	w.WriteBits(0x5, 3)
+	require.EqualValues(t, 27, w.BitLen())
+	require.Equal(t, []byte{0x05, 0xCD, 0xAB, 0x05}, w.Buf())
+
+	// 跨越累加器边界
+	w = NewBitsWriter(WithLSBFirst())
+	var want []byte
+	for i := 0; i < 100; i++ {
+		w.WriteBits(uint64(i)|uint64(i)<<8|uint64(i)<<16, 24)
+		want = append(want, byte(i), byte(i), byte(i))
+	}
+	w.WriteBits(0x0102030405060708, 64)
+	want = append(want, 8, 7, 6, 5, 4, 3, 2, 1)
+	require.Equal(t, want, w.Buf())
+}
@@ -1,26 +1,62 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/ryanreadbooks/go-huffman/huffman"
 )
 
-// 压缩或解压缩文件
+// 压缩或解压缩文件，或者根据样本文件训练预置码表
 func main() {
 	performCompress := flag.Bool("compress", false, "compress given file")
 	performDecompress := flag.Bool("decompress", false, "decompress given file")
 	inputFile := flag.String("input", "", "input filename")
 	outputFile := flag.String("output", "", "output filename")
+	concurrency := flag.Int("concurrency", runtime.NumCPU(), "number of blocks compressed or decompressed in parallel")
+	adaptive := flag.Bool("adaptive", false, "compress with adaptive huffman coding, no table is stored")
+	context := flag.Bool("context", false, "compress with order-1 context modeling, one table per preceding byte")
+	lz77 := flag.Bool("lz77", false, "compress with LZ77 matching, literals, lengths and distances use separate tables")
+	performTrain := flag.Bool("train", false, "train a preset table from sample files (input and remaining arguments)")
+	holdout := flag.Float64("holdout", 0.1, "fraction at the end of each sample file held out from training")
+	tableFile := flag.String("table", "", "preset table file written by -train, used to compress and decompress")
+	gzipFormat := flag.Bool("gzip", false, "compress into a standard gzip file instead of the .huf format")
+	transforms := flag.String("transform", "", "comma separated transforms applied before compression, in order: delta, mtf")
+	metadata := flag.Bool("metadata", false, "store file mode, mtime and owner when compressing, restore them when decompressing")
+	performArchive := flag.Bool("archive", false, "pack the input directory into an archive")
+	performExtract := flag.Bool("extract", false, "extract the input archive into the output directory")
+	listArchive := flag.Bool("list", false, "list the files in the input archive")
+	entry := flag.String("entry", "", "extract only this file (slash separated path) from the archive")
 
 	flag.Parse()
 
+	if *performTrain {
+		samples := flag.Args()
+		if *inputFile != "" {
+			samples = append([]string{*inputFile}, samples...)
+		}
+		if len(samples) == 0 || *outputFile == "" {
+			fmt.Println("please specify the sample files and the output filename")
+			os.Exit(0)
+		}
+		train(samples, *holdout, *outputFile)
+		return
+	}
+
 	if *inputFile == "" {
 		fmt.Println("please specify the input filename")
 		os.Exit(0)
 	}
+	if *listArchive {
+		list(*inputFile)
+		return
+	}
 	if *outputFile == "" {
 		fmt.Println("please specify the output filename")
 		os.Exit(0)
@@ -29,10 +65,96 @@ func main() {
 		fmt.Println("compress flag and decompress can not be both true")
 		os.Exit(0)
 	}
+	models := 0
+	for _, set := range []bool{*adaptive, *context, *lz77} {
+		if set {
+			models++
+		}
+	}
+	if models > 1 {
+		fmt.Println("only one of -adaptive, -context and -lz77 can be specified")
+		os.Exit(1)
+	}
+
+	// 压缩和打包共用的压缩流选项
+	writerOptions := func() []huffman.WriterOption {
+		opts := []huffman.WriterOption{huffman.WithConcurrency(*concurrency)}
+		if *adaptive {
+			opts = append(opts, huffman.WithAdaptive())
+		}
+		if *context {
+			opts = append(opts, huffman.WithContextModeling())
+		}
+		if *lz77 {
+			opts = append(opts, huffman.WithLZ77())
+		}
+		if *tableFile != "" {
+			table, err := loadTable(*tableFile)
+			if err != nil {
+				fmt.Printf("load table failed: %v\n", err)
+				os.Exit(1)
+			}
+			opts = append(opts, huffman.WithPresetTable(table))
+		}
+		return opts
+	}
+
+	// 解压和解包共用的压缩流选项
+	readerOptions := func() []huffman.ReaderOption {
+		opts := []huffman.ReaderOption{huffman.WithReaderConcurrency(*concurrency)}
+		if *tableFile != "" {
+			registry, err := loadRegistry(*tableFile)
+			if err != nil {
+				fmt.Printf("load table failed: %v\n", err)
+				os.Exit(1)
+			}
+			opts = append(opts, huffman.WithTableRegistry(registry))
+		}
+		return opts
+	}
+
+	if *performArchive {
+		fmt.Println("performing archiving...")
+		if err := huffman.CreateArchive(*inputFile, *outputFile, writerOptions()...); err != nil {
+			fmt.Printf("archiving failed: %v\n", err)
+		} else {
+			fmt.Println("archiving ok")
+		}
+		return
+	}
+	if *performExtract {
+		fmt.Println("performing extraction...")
+		if err := extract(*inputFile, *outputFile, *entry, readerOptions()...); err != nil {
+			fmt.Printf("extraction failed: %v\n", err)
+		} else {
+			fmt.Println("extraction ok")
+		}
+		return
+	}
 
 	if *performCompress {
 		fmt.Println("performing compression...")
-		err := huffman.CompressFile(*inputFile, *outputFile)
+		var opts []huffman.CompressFileOption
+		for _, opt := range writerOptions() {
+			opts = append(opts, opt)
+		}
+		if *transforms != "" {
+			chain, err := parseTransforms(*transforms)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			opts = append(opts, huffman.WithTransforms(chain...))
+		}
+		if *metadata {
+			opts = append(opts, huffman.WithFileMetadata())
+		}
+		var err error
+		if *gzipFormat {
+			err = compressGzip(*inputFile, *outputFile)
+		} else {
+			err = huffman.CompressFile(*inputFile, *outputFile, opts...)
+		}
 		if err != nil {
 			fmt.Printf("compression failed: %v\n", err)
 		} else {
@@ -41,7 +163,14 @@ func main() {
 	}
 	if *performDecompress {
 		fmt.Println("performing decompression...")
-		err := huffman.DecompressFile(*inputFile, *outputFile)
+		var opts []huffman.DecompressFileOption
+		for _, opt := range readerOptions() {
+			opts = append(opts, opt)
+		}
+		if *metadata {
+			opts = append(opts, huffman.WithRestoreMetadata())
+		}
+		err := huffman.DecompressFile(*inputFile, *outputFile, opts...)
 		if err != nil {
 			fmt.Printf("decompression failed: %v\n", err)
 		} else {
@@ -49,3 +178,125 @@ func main() {
 		}
 	}
 }
+
+// train 根据样本文件训练预置码表并写入output中
+func train(samples []string, holdout float64, output string) {
+	fmt.Println("performing training...")
+	result, err := huffman.TrainTable(samples, holdout)
+	if err != nil {
+		fmt.Printf("training failed: %v\n", err)
+		return
+	}
+	ser, err := result.Table.Serialize()
+	if err == nil {
+		err = os.WriteFile(output, ser, 0644)
+	}
+	if err != nil {
+		fmt.Printf("training failed: %v\n", err)
+		return
+	}
+
+	fmt.Printf("training set: %d bytes, %.4f bits/byte\n", result.TrainBytes, result.TrainBitsPerByte)
+	if result.HoldoutBytes > 0 {
+		fmt.Printf("held-out set: %d bytes, %.4f bits/byte\n", result.HoldoutBytes, result.HoldoutBitsPerByte)
+	}
+	fmt.Printf("table id: %016x\n", huffman.TableID(ser))
+	fmt.Println("training ok")
+}
+
+// loadTable 读入-train写出的码表，也可以是带有转义码的码表
+func loadTable(filename string) (huffman.ByteEncTable, error) {
+	ser, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	table, err := huffman.DeserializeEscapeEncTable(ser)
+	if errors.Is(err, huffman.ErrInvalidStartFlag) {
+		return huffman.DeserializeWideHuffmanEncTable(ser)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// loadRegistry 读入-train写出的码表并注册到TableRegistry中，用于解压使用了预置码表的数据
+func loadRegistry(filename string) (*huffman.TableRegistry, error) {
+	ser, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	registry := huffman.NewTableRegistry()
+	if _, err = registry.Register(ser); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// list 列出归档中的文件
+func list(input string) {
+	a, err := huffman.OpenArchive(input)
+	if err != nil {
+		fmt.Printf("open archive failed: %v\n", err)
+		os.Exit(1)
+	}
+	defer a.Close()
+
+	for _, e := range a.Entries() {
+		fmt.Printf("%12d %12d  %08x  %s\n", e.OriginalSize, e.CompressedSize, e.Checksum, e.Name)
+	}
+}
+
+// extract 把归档解压到output目录下，entry不为空时只解压该文件
+func extract(input, output, entry string, opts ...huffman.ReaderOption) error {
+	a, err := huffman.OpenArchive(input, opts...)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	if entry == "" {
+		return a.ExtractAll(output)
+	}
+	return a.Extract(entry, filepath.Join(output, filepath.FromSlash(entry)))
+}
+
+// compressGzip 把input压缩成gzip格式，可以通过gzip等标准工具解压
+func compressGzip(input, output string) (err error) {
+	src, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := dst.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	zw := huffman.NewGzipWriter(dst)
+	if _, err = io.Copy(zw, src); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// parseTransforms 解析-transform指定的变换链
+func parseTransforms(names string) ([]huffman.Transform, error) {
+	var chain []huffman.Transform
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "delta":
+			chain = append(chain, huffman.DeltaTransform{})
+		case "mtf":
+			chain = append(chain, huffman.MoveToFrontTransform{})
+		default:
+			return nil, fmt.Errorf("unknown transform %q", name)
+		}
+	}
+	return chain, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// runMain 以args为命令行参数运行一次main
+func runMain(args ...string) {
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = append([]string{oldArgs[0]}, args...)
+	main()
+}
+
+// 使用预置码表打包的归档，解包时通过-table提供同一个码表
+func TestCLI_ArchiveWithTable(t *testing.T) {
+	data, err := os.ReadFile("huffman/test/test_data.txt")
+	require.Nil(t, err)
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	files := map[string][]byte{
+		"a.txt":     data,
+		"sub/b.txt": data[:len(data)/2],
+	}
+	for name, content := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		require.Nil(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.Nil(t, os.WriteFile(p, content, 0644))
+	}
+
+	table := filepath.Join(dir, "table.hft")
+	archive := filepath.Join(dir, "out.hfa")
+	runMain("-train", "-holdout", "0", "-input", filepath.Join(src, "a.txt"), "-output", table)
+	runMain("-archive", "-table", table, "-input", src, "-output", archive)
+
+	// 没有码表时无法解包
+	missing := filepath.Join(dir, "missing")
+	runMain("-extract", "-input", archive, "-output", missing)
+	_, err = os.Stat(filepath.Join(missing, "a.txt"))
+	require.True(t, os.IsNotExist(err))
+
+	out := filepath.Join(dir, "out")
+	runMain("-extract", "-table", table, "-input", archive, "-output", out)
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		require.Nil(t, err)
+		require.Equal(t, content, got)
+	}
+
+	single := filepath.Join(dir, "single")
+	runMain("-extract", "-table", table, "-entry", "sub/b.txt", "-input", archive, "-output", single)
+	got, err := os.ReadFile(filepath.Join(single, "sub", "b.txt"))
+	require.Nil(t, err)
+	require.Equal(t, files["sub/b.txt"], got)
+}